@@ -1,10 +1,16 @@
 package conf
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	cli "github.com/urfave/cli/v2"
 	yaml "gopkg.in/yaml.v3"
@@ -15,13 +21,91 @@ const (
 	AppPort                                   = "3000"
 	AppHost                                   = "http://127.0.0.1"
 	HealthCheckRoute                          = "/healthcheck"
+	MetricsRoute                              = "/metrics"
 	HerokuIntegrationSalesforceAuthPath       = "/invocations/authentication"
 	HerokuIntegrationDataActionTargetAuthPath = "/data_action_targets/authenticate"
 	YamlFileName                              = "heroku-integration-service-mesh.yaml"
+	IdentityTokenAlgorithmHS256               = "HS256"
+	IdentityTokenAlgorithmEdDSA               = "EdDSA"
+	IdentityTokenHeader                       = "x-heroku-integration-mesh-token"
+	IdentityTokenIssuer                       = "heroku-integration-service-mesh"
+	IdentityTokenSecretEnvVar                 = "HEROKU_INTEGRATION_SERVICE_MESH_TOKEN_SECRET"
+	IdentityTokenTTL                          = time.Minute
+	ConcurrencyQueueTimeout                   = 10 * time.Second
+	ConcurrencyDecreaseFactor                 = 0.9
+	ConcurrencyAdaptiveWindow                 = time.Second
+	CoreJWTClockSkew                          = 30 * time.Second
+	ReplayProtectionWindow                    = 5 * time.Minute
+	ReplayProtectionMaxEntries                = 10000
+	AsyncDeliveryDir                          = ".heroku-integration-service-mesh/queue"
+	DeadLetterDir                             = ".heroku-integration-service-mesh/dead-letter"
+	DeadLetterMaxEntries                      = 1000
+	AsyncDeliveryMaxAttempts                  = 5
+	AsyncDeliveryInitialBackoff               = time.Second
+	AsyncDeliveryMaxBackoff                   = 5 * time.Minute
+	AsyncDeliveryTimeout                      = 30 * time.Second
+	AsyncDeliveryMaxParallel                  = 4
+	AsyncDeliveryMaxQueued                    = 10000
+	FanOutMaxParallel                         = 4
+	IdempotencyKeyByHeader                    = "header"
+	IdempotencyKeyByJSONPath                  = "jsonPath"
+	IdempotencyKeyByDigest                    = "digest"
+	IdempotencyHeader                         = "Idempotency-Key"
+	IdempotencyTTL                            = time.Hour
+	IdempotencyMaxEntries                     = 10000
+	IdempotencyMaxResponseBytes               = 1 << 20
+	CompressionEncodingGzip                   = "gzip"
+	CompressionEncodingBrotli                 = "br"
+	CompressionMaxBytes                       = 10 << 20
+	CompressionMaxRatio                       = 100
+	CompressionMinBytes                       = 1024
+	UpgradeProtocolWebSocket                  = "websocket"
+	UpgradeIdleTimeout                        = 5 * time.Minute
+	HTTP2MaxConcurrentStreams                 = 250
+	ValidationVerbosityMinimal                = "minimal"
+	ValidationVerbosityDetailed               = "detailed"
 )
 
+// Default mesh-owned headers forwarding the verified identity to the app
+const (
+	IdentityHeaderOrgID        = "x-heroku-integration-mesh-org-id"
+	IdentityHeaderOrgDomainUrl = "x-heroku-integration-mesh-org-domain-url"
+	IdentityHeaderAppUUID      = "x-heroku-integration-mesh-app-uuid"
+	IdentityHeaderContextType  = "x-heroku-integration-mesh-context-type"
+	IdentityHeaderResource     = "x-heroku-integration-mesh-resource"
+	IdentityHeaderRequestType  = "x-heroku-integration-mesh-request-type"
+	IdentityHeaderAuthOutcome  = "x-heroku-integration-mesh-verdict"
+)
+
+// Request types that a route may allow
+const (
+	RequestTypeSalesforce       = "salesforce"
+	RequestTypeDataActionTarget = "dataActionTarget"
+	RequestTypeNone             = "none"
+)
+
+var RequestTypes = []string{RequestTypeSalesforce, RequestTypeDataActionTarget, RequestTypeNone}
+
+// Optional rate limit keys, in addition to org ID
+const (
+	RateLimitKeyRoute       = "route"
+	RateLimitKeyRequestType = "requestType"
+)
+
+var RateLimitKeys = []string{RateLimitKeyRoute, RateLimitKeyRequestType}
+
 type Authentication struct {
-	BypassRoutes []string `yaml:"bypassRoutes"`
+	BypassRoutes         []string             `yaml:"bypassRoutes"`
+	ReportOnly           bool                 `yaml:"reportOnly"`
+	CoreJWTPreValidation CoreJWTPreValidation `yaml:"coreJwtPreValidation"`
+}
+
+// CoreJWTPreValidation rejects malformed, expired or mismatched Salesforce core JWTs locally,
+// before authenticating with the Heroku Integration service.  ClockSkew is the allowed
+// difference between the mesh's and Salesforce's clocks.
+type CoreJWTPreValidation struct {
+	Enable    bool          `yaml:"enable"`
+	ClockSkew time.Duration `yaml:"clockSkew"`
 }
 
 type HealthCheck struct {
@@ -29,14 +113,241 @@ type HealthCheck struct {
 	Route  string `yaml:"route"`
 }
 
+// IdentityHeaders are the names of mesh-owned headers forwarding the verified identity
+// to the app.  Client-supplied copies are always removed.
+type IdentityHeaders struct {
+	Enable       string `yaml:"enable"`
+	OrgID        string `yaml:"orgId"`
+	OrgDomainUrl string `yaml:"orgDomainUrl"`
+	AppUUID      string `yaml:"appUuid"`
+	ContextType  string `yaml:"contextType"`
+	Resource     string `yaml:"resource"`
+	RequestType  string `yaml:"requestType"`
+	AuthOutcome  string `yaml:"authOutcome"`
+}
+
+// IdentityToken is a short-lived JWT, signed by the mesh, containing the verified identity.
+// HS256 tokens are signed with a per-dyno secret passed to the app in the
+// HEROKU_INTEGRATION_SERVICE_MESH_TOKEN_SECRET config var; EdDSA tokens are signed with
+// the Ed25519 private key in KeyFile and verified with keys published on the private port.
+type IdentityToken struct {
+	Enable    bool          `yaml:"enable"`
+	Algorithm string        `yaml:"algorithm"`
+	KeyFile   string        `yaml:"keyFile"`
+	Header    string        `yaml:"header"`
+	Issuer    string        `yaml:"issuer"`
+	TTL       time.Duration `yaml:"ttl"`
+}
+
+// ReplayProtection rejects Data Action Target requests whose signature and payload were seen,
+// per org, within Window; up to MaxEntries requests are remembered per org.  When TimestampPath,
+// a dot-separated JSON path into the payload, is set, requests older than MaxAge are rejected.
+type ReplayProtection struct {
+	Enable        bool          `yaml:"enable"`
+	Window        time.Duration `yaml:"window"`
+	MaxEntries    int           `yaml:"maxEntries"`
+	TimestampPath string        `yaml:"timestampPath"`
+	MaxAge        time.Duration `yaml:"maxAge"`
+}
+
+// Idempotency returns the app's cached response for duplicate Data Action Target requests rather
+// than forwarding them.  Requests are keyed, per org, by KeyBy: the Header value, the value at Path,
+// a dot-separated JSON path into the payload, or a digest of the payload.  Up to MaxEntries
+// responses of up to MaxResponseBytes are remembered per org for TTL.
+type Idempotency struct {
+	Enable           bool          `yaml:"enable"`
+	KeyBy            string        `yaml:"keyBy"`
+	Header           string        `yaml:"header"`
+	Path             string        `yaml:"path"`
+	TTL              time.Duration `yaml:"ttl"`
+	MaxEntries       int           `yaml:"maxEntries"`
+	MaxResponseBytes int           `yaml:"maxResponseBytes"`
+}
+
+// PayloadValidation validates authenticated Data Action Target payloads against the JSON Schema
+// for the request's apiName, <apiName>.json in SchemaDir.  When Strict, payloads for apiNames
+// without a schema are rejected.
+type PayloadValidation struct {
+	Enable    bool   `yaml:"enable"`
+	SchemaDir string `yaml:"schemaDir"`
+	Strict    bool   `yaml:"strict"`
+}
+
+// OpenAPI validates authenticated Salesforce requests against the app's OpenAPI 3 document in
+// SpecFile.  When ValidateResponses, the app's responses are also validated, reporting violations only.
+type OpenAPI struct {
+	Enable            bool   `yaml:"enable"`
+	SpecFile          string `yaml:"specFile"`
+	ValidateResponses bool   `yaml:"validateResponses"`
+}
+
+// Compression configures request decompression and response compression
+type Compression struct {
+	Requests  RequestCompression  `yaml:"requests"`
+	Responses ResponseCompression `yaml:"responses"`
+}
+
+// RequestCompression decompresses gzip and deflate request bodies before validation and
+// authentication.  Bodies decompressing to more than MaxBytes, or MaxRatio times their
+// compressed size, are rejected.
+type RequestCompression struct {
+	Enable   bool `yaml:"enable"`
+	MaxBytes int  `yaml:"maxBytes"`
+	MaxRatio int  `yaml:"maxRatio"`
+}
+
+// ResponseCompression compresses app responses of at least MinBytes whose content type matches
+// ContentTypes, eg application/json or text/*, with the client's preferred of Encodings.
+type ResponseCompression struct {
+	Enable       bool     `yaml:"enable"`
+	Encodings    []string `yaml:"encodings"`
+	ContentTypes []string `yaml:"contentTypes"`
+	MinBytes     int      `yaml:"minBytes"`
+}
+
+// Streaming flushes app responses whose content type is text/event-stream or matches ContentTypes,
+// eg application/x-ndjson or text/*, to the client as each chunk is received
+type Streaming struct {
+	ContentTypes []string `yaml:"contentTypes"`
+}
+
+// HTTP2 serves HTTP/2 cleartext, h2c, on the public port alongside HTTP/1.1, allowing up to
+// MaxConcurrentStreams concurrent requests per connection
+type HTTP2 struct {
+	Enable               bool   `yaml:"enable"`
+	MaxConcurrentStreams uint32 `yaml:"maxConcurrentStreams"`
+}
+
+// Upgrade proxies authenticated HTTP Upgrade requests for Protocols, eg WebSocket handshakes, to
+// the app, splicing the connection until either side closes it or it is idle for IdleTimeout
+type Upgrade struct {
+	Enable      bool          `yaml:"enable"`
+	Protocols   []string      `yaml:"protocols"`
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+}
+
+// AsyncDelivery configures delivery of requests to async routes.  Requests are persisted in Dir,
+// acknowledged with 202 Accepted and delivered to the app with up to MaxAttempts attempts, backing
+// off exponentially from InitialBackoff to MaxBackoff, up to MaxParallel requests at a time.
+// Requests not delivered are moved to DeadLetterDir.  Requests are rejected with 503 Service
+// Unavailable once MaxQueued requests are queued.
+type AsyncDelivery struct {
+	Dir            string        `yaml:"dir"`
+	DeadLetterDir  string        `yaml:"deadLetterDir"`
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxParallel    int           `yaml:"maxParallel"`
+	MaxQueued      int           `yaml:"maxQueued"`
+	// Synchronous Data Action Target requests the app fails to handle are also captured in
+	// DeadLetterDir, see mesh.DeadLetterCapture
+	CaptureFailed bool `yaml:"captureFailed"`
+	// Captured requests are dropped once DeadLetterDir holds MaxDeadLetters requests
+	MaxDeadLetters int `yaml:"maxDeadLetters"`
+}
+
+// Validation configures request validation error responses.  With Verbosity "detailed", every
+// validation failure is returned to the client; "minimal", the default, returns a generic message.
+type Validation struct {
+	Verbosity string `yaml:"verbosity"`
+}
+
+// App is the app the mesh forwards requests to.  When HTTP2, requests are forwarded over HTTP/2:
+// h2c, with prior knowledge, to http hosts or negotiated over TLS with https hosts.
 type App struct {
-	Port string `yaml:"port"`
-	Host string `yaml:"host"`
+	Port  string `yaml:"port"`
+	Host  string `yaml:"host"`
+	HTTP2 bool   `yaml:"http2"`
+}
+
+// RateLimit is a token bucket rate limit keyed by org ID and, optionally, route and
+// request type.  RequestsPerSecond is the sustained rate; Burst is the bucket size.
+type RateLimit struct {
+	Enable            bool     `yaml:"enable"`
+	RequestsPerSecond float64  `yaml:"requestsPerSecond"`
+	Burst             int      `yaml:"burst"`
+	KeyBy             []string `yaml:"keyBy"`
+}
+
+// Concurrency limits requests in flight to the app, globally and per org.  Requests
+// exceeding the limits wait in a bounded queue for up to QueueTimeout; requests
+// arriving when the queue is full are shed.
+type Concurrency struct {
+	Enable            bool                `yaml:"enable"`
+	MaxInFlight       int                 `yaml:"maxInFlight"`
+	MaxInFlightPerOrg int                 `yaml:"maxInFlightPerOrg"`
+	QueueSize         int                 `yaml:"queueSize"`
+	QueueTimeout      time.Duration       `yaml:"queueTimeout"`
+	Adaptive          AdaptiveConcurrency `yaml:"adaptive"`
+}
+
+// AdaptiveConcurrency adjusts the global limit between MinLimit and MaxInFlight by
+// additive increase, multiplicative decrease (AIMD) of observed app latency.  The limit
+// decreases at most once per Window.
+type AdaptiveConcurrency struct {
+	Enable           bool          `yaml:"enable"`
+	MinLimit         int           `yaml:"minLimit"`
+	LatencyThreshold time.Duration `yaml:"latencyThreshold"`
+	DecreaseFactor   float64       `yaml:"decreaseFactor"`
+	Window           time.Duration `yaml:"window"`
+}
+
+// Route is an authentication policy for requests matching Path.  Path uses the
+// same matching rules as Authentication.BypassRoutes.  Empty lists allow all values.
+type Route struct {
+	Path         string     `yaml:"path"`
+	RequestTypes []string   `yaml:"requestTypes"`
+	OrgIDs       []string   `yaml:"orgIds"`
+	DenyOrgIDs   []string   `yaml:"denyOrgIds"`
+	ContextTypes []string   `yaml:"contextTypes"`
+	Resources    []string   `yaml:"resources"`
+	Namespaces   []string   `yaml:"namespaces"`
+	Methods      []string   `yaml:"methods"`
+	RateLimit    *RateLimit `yaml:"rateLimit"`
+	ReportOnly   *bool      `yaml:"reportOnly"`
+	// Async Data Action Target requests are acknowledged and delivered in the background, see AsyncDelivery
+	Async  bool    `yaml:"async"`
+	FanOut *FanOut `yaml:"fanOut"`
+}
+
+// FanOut splits Data Action Target payloads' events array, forwarding each event as its own request
+// to the app, up to MaxParallel at a time or, when Ordered, one at a time in batch order.
+type FanOut struct {
+	Enable      bool `yaml:"enable"`
+	MaxParallel int  `yaml:"maxParallel"`
+	Ordered     bool `yaml:"ordered"`
+}
+
+// Orgs are global org allow and deny lists.  Lists are merged with org IDs found
+// in AllowFile and DenyFile, one org ID per line, and the comma-separated
+// HEROKU_INTEGRATION_SERVICE_MESH_ORG_ALLOWLIST and HEROKU_INTEGRATION_SERVICE_MESH_ORG_DENYLIST config vars.
+type Orgs struct {
+	Allow     []string `yaml:"allow"`
+	Deny      []string `yaml:"deny"`
+	AllowFile string   `yaml:"allowFile"`
+	DenyFile  string   `yaml:"denyFile"`
 }
 
 type Mesh struct {
-	Authentication Authentication `yaml:"authentication"`
-	HealthCheck    HealthCheck    `yaml:"healthcheck"`
+	Authentication    Authentication    `yaml:"authentication"`
+	HealthCheck       HealthCheck       `yaml:"healthcheck"`
+	IdentityHeaders   IdentityHeaders   `yaml:"identityHeaders"`
+	IdentityToken     IdentityToken     `yaml:"identityToken"`
+	Orgs              Orgs              `yaml:"orgs"`
+	RateLimit         RateLimit         `yaml:"rateLimit"`
+	Concurrency       Concurrency       `yaml:"concurrency"`
+	Validation        Validation        `yaml:"validation"`
+	ReplayProtection  ReplayProtection  `yaml:"replayProtection"`
+	Idempotency       Idempotency       `yaml:"idempotency"`
+	PayloadValidation PayloadValidation `yaml:"payloadValidation"`
+	OpenAPI           OpenAPI           `yaml:"openApi"`
+	Compression       Compression       `yaml:"compression"`
+	Upgrade           Upgrade           `yaml:"upgrade"`
+	Streaming         Streaming         `yaml:"streaming"`
+	HTTP2             HTTP2             `yaml:"http2"`
+	AsyncDelivery     AsyncDelivery     `yaml:"asyncDelivery"`
+	Routes            []Route           `yaml:"routes"`
 }
 
 type YamlConfig struct {
@@ -52,6 +363,7 @@ type Config struct {
 	PrivatePort                               string
 	PublicPort                                string
 	ShouldBypassAllRoutes                     bool
+	IdentityTokenSecret                       []byte
 	Version                                   string
 	YamlConfig                                *YamlConfig
 }
@@ -87,16 +399,25 @@ var defaultConfig = sync.OnceValue(func() *Config {
 		log.Fatalf("Invalid YAML config: %v", err)
 	}
 
+	var identityTokenSecret []byte
+	if yamlConfig.Mesh.IdentityToken.Enable && yamlConfig.Mesh.IdentityToken.Algorithm == IdentityTokenAlgorithmHS256 {
+		identityTokenSecret, err = initIdentityTokenSecret()
+		if err != nil {
+			log.Fatalf("Unable to generate identity token secret: %v", err)
+		}
+	}
+
 	return &Config{
+		IdentityTokenSecret:                       identityTokenSecret,
 		HerokuInvocationToken:                     herokuIntegrationToken,
 		HerokuIntegrationUrl:                      herokuIntegrationUrl,
 		HerokuInvocationSalesforceAuthPath:        HerokuIntegrationSalesforceAuthPath,
 		HerokuIntegrationDataActionTargetAuthPath: HerokuIntegrationDataActionTargetAuthPath,
-		PrivatePort:           "8071",
-		PublicPort:            "8070",
-		ShouldBypassAllRoutes: shouldBypassAllRoutes,
-		Version:               VERSION,
-		YamlConfig:            yamlConfig,
+		PrivatePort:                               "8071",
+		PublicPort:                                "8070",
+		ShouldBypassAllRoutes:                     shouldBypassAllRoutes,
+		Version:                                   VERSION,
+		YamlConfig:                                yamlConfig,
 	}
 })
 
@@ -129,6 +450,15 @@ func InitYamlConfig(yamlFileName string) (*YamlConfig, error) {
 		yamlConfig.App.Port = appPort
 	}
 
+	reportOnly, _ := strconv.ParseBool(os.Getenv("HEROKU_INTEGRATION_SERVICE_MESH_REPORT_ONLY"))
+	if reportOnly {
+		yamlConfig.Mesh.Authentication.ReportOnly = true
+	}
+
+	if yamlConfig.Mesh.Authentication.CoreJWTPreValidation.ClockSkew <= 0 {
+		yamlConfig.Mesh.Authentication.CoreJWTPreValidation.ClockSkew = CoreJWTClockSkew
+	}
+
 	if yamlConfig.App.Host == "" {
 		yamlConfig.App.Host = AppHost
 	}
@@ -141,9 +471,425 @@ func InitYamlConfig(yamlFileName string) (*YamlConfig, error) {
 		yamlConfig.Mesh.HealthCheck.Route = HealthCheckRoute
 	}
 
+	initIdentityHeaders(&yamlConfig.Mesh.IdentityHeaders)
+
+	if err := initIdentityToken(&yamlConfig.Mesh.IdentityToken); err != nil {
+		return nil, err
+	}
+
+	if err := initOrgs(&yamlConfig.Mesh.Orgs); err != nil {
+		return nil, err
+	}
+
+	if err := initRateLimit("mesh", &yamlConfig.Mesh.RateLimit); err != nil {
+		return nil, err
+	}
+
+	if err := initConcurrency(&yamlConfig.Mesh.Concurrency); err != nil {
+		return nil, err
+	}
+
+	initReplayProtection(&yamlConfig.Mesh.ReplayProtection)
+	initAsyncDelivery(&yamlConfig.Mesh.AsyncDelivery)
+
+	if err := initIdempotency(&yamlConfig.Mesh.Idempotency); err != nil {
+		return nil, err
+	}
+
+	if yamlConfig.Mesh.PayloadValidation.Enable && yamlConfig.Mesh.PayloadValidation.SchemaDir == "" {
+		return nil, fmt.Errorf("payloadValidation schemaDir is required")
+	}
+
+	if yamlConfig.Mesh.OpenAPI.Enable && yamlConfig.Mesh.OpenAPI.SpecFile == "" {
+		return nil, fmt.Errorf("openApi specFile is required")
+	}
+
+	if err := initCompression(&yamlConfig.Mesh.Compression); err != nil {
+		return nil, err
+	}
+
+	initUpgrade(&yamlConfig.Mesh.Upgrade)
+
+	if yamlConfig.Mesh.HTTP2.MaxConcurrentStreams == 0 {
+		yamlConfig.Mesh.HTTP2.MaxConcurrentStreams = HTTP2MaxConcurrentStreams
+	}
+
+	if err := initValidation(&yamlConfig.Mesh.Validation); err != nil {
+		return nil, err
+	}
+
+	if err := initRoutes(yamlConfig.Mesh.Routes); err != nil {
+		return nil, err
+	}
+
 	return yamlConfig, nil
 }
 
+// initReplayProtection applies replay protection defaults; MaxAge defaults to Window
+func initReplayProtection(replayProtection *ReplayProtection) {
+	if replayProtection.Window <= 0 {
+		replayProtection.Window = ReplayProtectionWindow
+	}
+
+	if replayProtection.MaxEntries <= 0 {
+		replayProtection.MaxEntries = ReplayProtectionMaxEntries
+	}
+
+	if replayProtection.MaxAge <= 0 {
+		replayProtection.MaxAge = replayProtection.Window
+	}
+
+	// Requests younger than MaxAge must be remembered to detect replays
+	if replayProtection.TimestampPath != "" && replayProtection.Window < replayProtection.MaxAge {
+		replayProtection.Window = replayProtection.MaxAge
+	}
+}
+
+// initCompression applies compression defaults and validates response encodings
+func initCompression(compression *Compression) error {
+	if compression.Requests.MaxBytes <= 0 {
+		compression.Requests.MaxBytes = CompressionMaxBytes
+	}
+
+	if compression.Requests.MaxRatio <= 0 {
+		compression.Requests.MaxRatio = CompressionMaxRatio
+	}
+
+	responses := &compression.Responses
+	if len(responses.Encodings) == 0 {
+		responses.Encodings = []string{CompressionEncodingBrotli, CompressionEncodingGzip}
+	}
+
+	if len(responses.ContentTypes) == 0 {
+		responses.ContentTypes = []string{"application/json", "application/problem+json", "application/xml", "text/*"}
+	}
+
+	if responses.MinBytes <= 0 {
+		responses.MinBytes = CompressionMinBytes
+	}
+
+	for _, encoding := range responses.Encodings {
+		if encoding != CompressionEncodingGzip && encoding != CompressionEncodingBrotli {
+			return fmt.Errorf("invalid compression encoding %s, must be %s or %s", encoding,
+				CompressionEncodingBrotli, CompressionEncodingGzip)
+		}
+	}
+
+	return nil
+}
+
+// initUpgrade applies upgrade defaults, normalizing protocols to lowercase
+func initUpgrade(upgrade *Upgrade) {
+	if len(upgrade.Protocols) == 0 {
+		upgrade.Protocols = []string{UpgradeProtocolWebSocket}
+	}
+
+	for i, protocol := range upgrade.Protocols {
+		upgrade.Protocols[i] = strings.ToLower(protocol)
+	}
+
+	if upgrade.IdleTimeout <= 0 {
+		upgrade.IdleTimeout = UpgradeIdleTimeout
+	}
+}
+
+// initAsyncDelivery applies async delivery defaults
+func initAsyncDelivery(asyncDelivery *AsyncDelivery) {
+	if asyncDelivery.Dir == "" {
+		asyncDelivery.Dir = AsyncDeliveryDir
+	}
+
+	if asyncDelivery.DeadLetterDir == "" {
+		asyncDelivery.DeadLetterDir = DeadLetterDir
+	}
+
+	if asyncDelivery.MaxAttempts <= 0 {
+		asyncDelivery.MaxAttempts = AsyncDeliveryMaxAttempts
+	}
+
+	if asyncDelivery.InitialBackoff <= 0 {
+		asyncDelivery.InitialBackoff = AsyncDeliveryInitialBackoff
+	}
+
+	if asyncDelivery.MaxBackoff <= 0 {
+		asyncDelivery.MaxBackoff = AsyncDeliveryMaxBackoff
+	}
+
+	if asyncDelivery.MaxBackoff < asyncDelivery.InitialBackoff {
+		asyncDelivery.MaxBackoff = asyncDelivery.InitialBackoff
+	}
+
+	if asyncDelivery.Timeout <= 0 {
+		asyncDelivery.Timeout = AsyncDeliveryTimeout
+	}
+
+	if asyncDelivery.MaxParallel <= 0 {
+		asyncDelivery.MaxParallel = AsyncDeliveryMaxParallel
+	}
+
+	if asyncDelivery.MaxQueued <= 0 {
+		asyncDelivery.MaxQueued = AsyncDeliveryMaxQueued
+	}
+
+	if asyncDelivery.MaxDeadLetters <= 0 {
+		asyncDelivery.MaxDeadLetters = DeadLetterMaxEntries
+	}
+}
+
+// initIdempotency validates enabled idempotency keys and applies defaults
+func initIdempotency(idempotency *Idempotency) error {
+	if idempotency.KeyBy == "" {
+		idempotency.KeyBy = IdempotencyKeyByDigest
+	}
+
+	if idempotency.Header == "" {
+		idempotency.Header = IdempotencyHeader
+	}
+
+	if idempotency.TTL <= 0 {
+		idempotency.TTL = IdempotencyTTL
+	}
+
+	if idempotency.MaxEntries <= 0 {
+		idempotency.MaxEntries = IdempotencyMaxEntries
+	}
+
+	if idempotency.MaxResponseBytes <= 0 {
+		idempotency.MaxResponseBytes = IdempotencyMaxResponseBytes
+	}
+
+	if !idempotency.Enable {
+		return nil
+	}
+
+	switch idempotency.KeyBy {
+	case IdempotencyKeyByHeader, IdempotencyKeyByDigest:
+	case IdempotencyKeyByJSONPath:
+		if idempotency.Path == "" {
+			return fmt.Errorf("idempotency path is required for keyBy %s", IdempotencyKeyByJSONPath)
+		}
+	default:
+		return fmt.Errorf("invalid idempotency keyBy '%s', expected %s, %s or %s", idempotency.KeyBy,
+			IdempotencyKeyByHeader, IdempotencyKeyByJSONPath, IdempotencyKeyByDigest)
+	}
+
+	return nil
+}
+
+// initValidation applies the HEROKU_INTEGRATION_SERVICE_MESH_VALIDATION_VERBOSITY config var
+// and default verbosity
+func initValidation(validation *Validation) error {
+	if verbosity := os.Getenv("HEROKU_INTEGRATION_SERVICE_MESH_VALIDATION_VERBOSITY"); verbosity != "" {
+		validation.Verbosity = verbosity
+	}
+
+	if validation.Verbosity == "" {
+		validation.Verbosity = ValidationVerbosityMinimal
+	}
+
+	if validation.Verbosity != ValidationVerbosityMinimal && validation.Verbosity != ValidationVerbosityDetailed {
+		return fmt.Errorf("invalid validation verbosity '%s', expected %s or %s",
+			validation.Verbosity, ValidationVerbosityMinimal, ValidationVerbosityDetailed)
+	}
+
+	return nil
+}
+
+// initIdentityHeaders applies default identity header names
+func initIdentityHeaders(identityHeaders *IdentityHeaders) {
+	if identityHeaders.Enable == "" {
+		identityHeaders.Enable = "true"
+	}
+
+	defaults := []struct {
+		name         *string
+		defaultValue string
+	}{
+		{&identityHeaders.OrgID, IdentityHeaderOrgID},
+		{&identityHeaders.OrgDomainUrl, IdentityHeaderOrgDomainUrl},
+		{&identityHeaders.AppUUID, IdentityHeaderAppUUID},
+		{&identityHeaders.ContextType, IdentityHeaderContextType},
+		{&identityHeaders.Resource, IdentityHeaderResource},
+		{&identityHeaders.RequestType, IdentityHeaderRequestType},
+		{&identityHeaders.AuthOutcome, IdentityHeaderAuthOutcome},
+	}
+	for _, header := range defaults {
+		if *header.name == "" {
+			*header.name = header.defaultValue
+		}
+	}
+}
+
+// initIdentityToken validates an enabled identity token and applies defaults
+func initIdentityToken(identityToken *IdentityToken) error {
+	// Client-supplied tokens are stripped even when tokens are disabled
+	if identityToken.Header == "" {
+		identityToken.Header = IdentityTokenHeader
+	}
+
+	if !identityToken.Enable {
+		return nil
+	}
+
+	if identityToken.Algorithm == "" {
+		identityToken.Algorithm = IdentityTokenAlgorithmHS256
+	}
+
+	switch identityToken.Algorithm {
+	case IdentityTokenAlgorithmHS256:
+	case IdentityTokenAlgorithmEdDSA:
+		if identityToken.KeyFile == "" {
+			return fmt.Errorf("identity token keyFile is required for algorithm %s", IdentityTokenAlgorithmEdDSA)
+		}
+	default:
+		return fmt.Errorf("invalid identity token algorithm '%s', expected %s or %s",
+			identityToken.Algorithm, IdentityTokenAlgorithmHS256, IdentityTokenAlgorithmEdDSA)
+	}
+
+	if identityToken.Issuer == "" {
+		identityToken.Issuer = IdentityTokenIssuer
+	}
+
+	if identityToken.TTL <= 0 {
+		identityToken.TTL = IdentityTokenTTL
+	}
+
+	return nil
+}
+
+// initIdentityTokenSecret generates the dyno's identity token secret, setting it in the
+// environment inherited by the app
+func initIdentityTokenSecret() ([]byte, error) {
+	if encodedSecret := os.Getenv(IdentityTokenSecretEnvVar); encodedSecret != "" {
+		return base64.RawURLEncoding.DecodeString(encodedSecret)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return secret, os.Setenv(IdentityTokenSecretEnvVar, base64.RawURLEncoding.EncodeToString(secret))
+}
+
+// initOrgs merges org allow and deny lists from config vars and files
+func initOrgs(orgs *Orgs) error {
+	orgs.Allow = append(orgs.Allow, splitList(os.Getenv("HEROKU_INTEGRATION_SERVICE_MESH_ORG_ALLOWLIST"))...)
+	orgs.Deny = append(orgs.Deny, splitList(os.Getenv("HEROKU_INTEGRATION_SERVICE_MESH_ORG_DENYLIST"))...)
+
+	if orgs.AllowFile != "" {
+		allow, err := readListFile(orgs.AllowFile)
+		if err != nil {
+			return err
+		}
+		orgs.Allow = append(orgs.Allow, allow...)
+	}
+
+	if orgs.DenyFile != "" {
+		deny, err := readListFile(orgs.DenyFile)
+		if err != nil {
+			return err
+		}
+		orgs.Deny = append(orgs.Deny, deny...)
+	}
+
+	return nil
+}
+
+// splitList splits a comma-separated list, ignoring empty values
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// readListFile reads one value per line, ignoring empty lines and '#' comments
+func readListFile(fileName string) ([]string, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			values = append(values, line)
+		}
+	}
+	return values, nil
+}
+
+// initRoutes validates route policies and normalizes HTTP methods
+func initRoutes(routes []Route) error {
+	for i := range routes {
+		route := &routes[i]
+		if route.Path == "" {
+			return fmt.Errorf("route %d: path is required", i)
+		}
+
+		for _, requestType := range route.RequestTypes {
+			if !slices.Contains(RequestTypes, requestType) {
+				return fmt.Errorf("route %s: invalid request type '%s', expected one of %s",
+					route.Path, requestType, strings.Join(RequestTypes, ", "))
+			}
+		}
+
+		if route.Async && len(route.RequestTypes) > 0 && !slices.Contains(route.RequestTypes, RequestTypeDataActionTarget) {
+			return fmt.Errorf("route %s: async routes must allow request type %s", route.Path, RequestTypeDataActionTarget)
+		}
+
+		if route.FanOut != nil && route.FanOut.Enable {
+			if route.Async {
+				return fmt.Errorf("route %s: fanOut routes must not be async", route.Path)
+			}
+
+			if route.FanOut.MaxParallel <= 0 {
+				route.FanOut.MaxParallel = FanOutMaxParallel
+			}
+		}
+
+		for j, method := range route.Methods {
+			route.Methods[j] = strings.ToUpper(method)
+		}
+
+		if route.RateLimit != nil {
+			if err := initRateLimit("route "+route.Path, route.RateLimit); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// initRateLimit validates an enabled rate limit, defaulting burst to the sustained rate
+func initRateLimit(name string, rateLimit *RateLimit) error {
+	if !rateLimit.Enable {
+		return nil
+	}
+
+	if rateLimit.RequestsPerSecond <= 0 {
+		return fmt.Errorf("%s: rate limit requestsPerSecond must be greater than 0", name)
+	}
+
+	if rateLimit.Burst <= 0 {
+		rateLimit.Burst = max(1, int(rateLimit.RequestsPerSecond))
+	}
+
+	for _, key := range rateLimit.KeyBy {
+		if !slices.Contains(RateLimitKeys, key) {
+			return fmt.Errorf("%s: invalid rate limit key '%s', expected one of %s",
+				name, key, strings.Join(RateLimitKeys, ", "))
+		}
+	}
+
+	return nil
+}
+
 func GetConfig() *Config {
 	return defaultConfig()
 }
@@ -151,3 +897,45 @@ func GetConfig() *Config {
 func GetConfigWithYamlFile() *Config {
 	return defaultConfig()
 }
+
+// initConcurrency validates enabled concurrency limits and applies defaults
+func initConcurrency(concurrency *Concurrency) error {
+	if !concurrency.Enable {
+		return nil
+	}
+
+	if concurrency.MaxInFlight <= 0 {
+		return fmt.Errorf("concurrency maxInFlight must be greater than 0")
+	}
+
+	if concurrency.QueueTimeout <= 0 {
+		concurrency.QueueTimeout = ConcurrencyQueueTimeout
+	}
+
+	adaptive := &concurrency.Adaptive
+	if !adaptive.Enable {
+		return nil
+	}
+
+	if adaptive.LatencyThreshold <= 0 {
+		return fmt.Errorf("concurrency adaptive latencyThreshold must be greater than 0")
+	}
+
+	if adaptive.MinLimit <= 0 {
+		adaptive.MinLimit = 1
+	}
+
+	if adaptive.MinLimit > concurrency.MaxInFlight {
+		return fmt.Errorf("concurrency adaptive minLimit must not exceed maxInFlight")
+	}
+
+	if adaptive.DecreaseFactor <= 0 || adaptive.DecreaseFactor >= 1 {
+		adaptive.DecreaseFactor = ConcurrencyDecreaseFactor
+	}
+
+	if adaptive.Window <= 0 {
+		adaptive.Window = ConcurrencyAdaptiveWindow
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+	cli "github.com/urfave/cli/v2"
+)
+
+const dlqCommandName = "dlq"
+
+// NewDlqCommand builds the dead-letter store subcommands: list, show, replay and purge
+func NewDlqCommand(config *conf.Config) *cli.Command {
+	allFlag := &cli.BoolFlag{
+		Name:  "all",
+		Usage: "All dead-lettered requests",
+	}
+
+	return &cli.Command{
+		Name:  dlqCommandName,
+		Usage: "Inspect, replay and purge dead-lettered requests",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List dead-lettered requests, oldest first",
+				Action: func(c *cli.Context) error {
+					return listDeadLetters(c, deadLetterStore(config))
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "Show a dead-lettered request, including headers and body",
+				ArgsUsage: "ID",
+				Action: func(c *cli.Context) error {
+					return showDeadLetter(c, deadLetterStore(config))
+				},
+			},
+			{
+				Name:      "replay",
+				Usage:     "Forward dead-lettered requests to the app, removing requests delivered",
+				ArgsUsage: "[ID...]",
+				Flags:     []cli.Flag{allFlag},
+				Action: func(c *cli.Context) error {
+					return replayDeadLetters(c, config, deadLetterStore(config))
+				},
+			},
+			{
+				Name:      "purge",
+				Usage:     "Remove dead-lettered requests",
+				ArgsUsage: "[ID...]",
+				Flags:     []cli.Flag{allFlag},
+				Action: func(c *cli.Context) error {
+					return purgeDeadLetters(c, deadLetterStore(config))
+				},
+			},
+		},
+	}
+}
+
+func deadLetterStore(config *conf.Config) *mesh.RequestStore {
+	return mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.DeadLetterDir)
+}
+
+func listDeadLetters(c *cli.Context, deadLetters *mesh.RequestStore) error {
+	storedRequests, err := deadLetters.List()
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tFAILED AT\tORG ID\tROUTE\tREQUEST\tATTEMPTS\tREASON")
+	for _, storedRequest := range storedRequests {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s %s\t%d\t%s\n",
+			storedRequest.ID,
+			storedRequest.FailedAt.Format(time.RFC3339),
+			storedRequest.OrgID,
+			storedRequest.Route,
+			storedRequest.Method,
+			storedRequest.RequestURI,
+			storedRequest.Attempts,
+			storedRequest.Reason)
+	}
+
+	return writer.Flush()
+}
+
+func showDeadLetter(c *cli.Context, deadLetters *mesh.RequestStore) error {
+	if c.NArg() != 1 {
+		return cli.Exit("Expected dead-lettered request ID", 1)
+	}
+
+	storedRequest, err := deadLetters.Get(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(c.App.Writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(storedRequest)
+}
+
+func replayDeadLetters(c *cli.Context, config *conf.Config, deadLetters *mesh.RequestStore) error {
+	storedRequests, err := selectDeadLetters(c, deadLetters)
+	if err != nil {
+		return err
+	}
+
+	var signer *mesh.TokenSigner
+	if config.YamlConfig.Mesh.IdentityToken.Enable {
+		if signer, err = mesh.NewTokenSigner(config); err != nil {
+			return fmt.Errorf("invalid identity token config: %v", err)
+		}
+	}
+
+	client := &http.Client{Transport: mesh.NewAppTransport(config), Timeout: config.YamlConfig.Mesh.AsyncDelivery.Timeout}
+	failures := 0
+	for _, storedRequest := range storedRequests {
+		statusCode, err := mesh.ReplayDeadLetter(c.Context, config, client, deadLetters, storedRequest, signer)
+		if err != nil {
+			failures++
+			fmt.Fprintf(c.App.Writer, "%s failed: %v\n", storedRequest.ID, err)
+			continue
+		}
+
+		fmt.Fprintf(c.App.Writer, "%s replayed: %s\n", storedRequest.ID, strconv.Itoa(statusCode))
+	}
+
+	if failures > 0 {
+		return cli.Exit(fmt.Sprintf("Failed to replay %d of %d requests", failures, len(storedRequests)), 1)
+	}
+
+	return nil
+}
+
+func purgeDeadLetters(c *cli.Context, deadLetters *mesh.RequestStore) error {
+	storedRequests, err := selectDeadLetters(c, deadLetters)
+	if err != nil {
+		return err
+	}
+
+	for _, storedRequest := range storedRequests {
+		if err := deadLetters.Delete(storedRequest.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "%s purged\n", storedRequest.ID)
+	}
+
+	return nil
+}
+
+// selectDeadLetters returns the dead-lettered requests given by ID or, with --all, every request
+func selectDeadLetters(c *cli.Context, deadLetters *mesh.RequestStore) ([]*mesh.StoredRequest, error) {
+	if c.Bool("all") {
+		if c.NArg() > 0 {
+			return nil, cli.Exit("Expected dead-lettered request IDs or --all, not both", 1)
+		}
+		return deadLetters.List()
+	}
+
+	if c.NArg() == 0 {
+		return nil, cli.Exit("Expected dead-lettered request IDs or --all", 1)
+	}
+
+	var storedRequests []*mesh.StoredRequest
+	for _, id := range c.Args().Slice() {
+		storedRequest, err := deadLetters.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		storedRequests = append(storedRequests, storedRequest)
+	}
+
+	return storedRequests, nil
+}
@@ -0,0 +1,36 @@
+package errors
+
+import (
+	"net/http"
+)
+
+const (
+	ContentTypeProblemJSON = "application/problem+json"
+	ProblemTypeDefault     = "about:blank"
+)
+
+// Problem is an RFC 7807 problem details response body.  Code, the error kind, RequestID and
+// Errors, the request's validation failures, are extension members.
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Code      string      `json:"code"`
+	RequestID string      `json:"requestId,omitempty"`
+	Errors    []Violation `json:"errors,omitempty"`
+}
+
+// NewProblem returns the problem for the given error
+func NewProblem(err *ServerError, requestID string) *Problem {
+	status := err.HttpStatusCode()
+	return &Problem{
+		Type:      ProblemTypeDefault,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Detail(),
+		Code:      err.Kind.String(),
+		RequestID: requestID,
+		Errors:    err.Violations,
+	}
+}
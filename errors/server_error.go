@@ -3,30 +3,202 @@ package errors
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
 )
 
+// Kind classifies errors replied to clients
+type Kind uint
+
+const (
+	// Internal errors are unexpected mesh failures
+	Internal Kind = iota
+	// Validation errors are requests that are not valid Salesforce or Data Action Target requests
+	Validation
+	// Malformed errors are Salesforce or Data Action Target requests with invalid headers or content
+	Malformed
+	// Unauthenticated errors are requests with missing, invalid or expired credentials
+	Unauthenticated
+	// Forbidden errors are valid requests not permitted by policy or the Heroku Integration service
+	Forbidden
+	// UpstreamAuthFailure errors are unexpected failures authenticating with the Heroku Integration service
+	UpstreamAuthFailure
+	// AppUnavailable errors are failures forwarding requests to the app
+	AppUnavailable
+	// LimitExceeded errors are requests over rate or concurrency limits
+	LimitExceeded
+	// Replay errors are previously seen requests, eg replayed Data Action Target webhooks
+	Replay
+	// Unprocessable errors are authenticated requests whose content violates a declared schema
+	Unprocessable
+	// Conflict errors are duplicates of idempotent requests still in progress
+	Conflict
+)
+
+// String returns the kind's stable name, used as error code and metric label
+func (k Kind) String() string {
+	switch k {
+	case Validation:
+		return "validation"
+	case Malformed:
+		return "malformed"
+	case Unauthenticated:
+		return "unauthenticated"
+	case Forbidden:
+		return "forbidden"
+	case UpstreamAuthFailure:
+		return "upstream-auth-failure"
+	case AppUnavailable:
+		return "app-unavailable"
+	case LimitExceeded:
+		return "limit-exceeded"
+	case Replay:
+		return "replay"
+	case Unprocessable:
+		return "unprocessable"
+	case Conflict:
+		return "conflict"
+	default:
+		return "internal"
+	}
+}
+
+// HttpStatusCode returns the kind's default HTTP status
+func (k Kind) HttpStatusCode() int {
+	switch k {
+	case Validation, Unauthenticated:
+		return http.StatusUnauthorized
+	case Malformed:
+		return http.StatusBadRequest
+	case Forbidden:
+		return http.StatusForbidden
+	case UpstreamAuthFailure, AppUnavailable:
+		return http.StatusBadGateway
+	case LimitExceeded:
+		return http.StatusTooManyRequests
+	case Replay, Conflict:
+		return http.StatusConflict
+	case Unprocessable:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error allows matching errors of a kind, eg errors.Is(err, errors.Forbidden)
+func (k Kind) Error() string {
+	return k.String() + " error"
+}
+
+// Violation is a single validation failure of a request's field, eg a header
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ServerError is an error replied to clients.  Message is safe to return to clients; Err,
+// the underlying cause, is only logged.
 type ServerError struct {
-	Message string
-	Err     error
+	Kind Kind
+	// StatusCode overrides the kind's HTTP status, eg 405 Method Not Allowed
+	StatusCode int
+	Message    string
+	Err        error
+	// Violations are the validation failures of the request, if any
+	Violations []Violation
+}
+
+// New returns an error of the given kind with a message safe to return to clients
+func New(kind Kind, message string) *ServerError {
+	return &ServerError{Kind: kind, Message: message}
+}
+
+// Wrap returns an error of the given kind caused by err
+func Wrap(kind Kind, message string, err error) *ServerError {
+	return &ServerError{Kind: kind, Message: message, Err: err}
 }
 
 func (e *ServerError) Error() string {
-	return fmt.Sprintf("client error (%v)", e.Err)
+	message := e.Message
+	if e.Err != nil {
+		if message == "" {
+			message = e.Err.Error()
+		} else {
+			message += ": " + e.Err.Error()
+		}
+	}
+
+	return fmt.Sprintf("%d %s", e.HttpStatusCode(), message)
 }
 
 func (e *ServerError) Unwrap() error {
 	return e.Err
 }
 
+// Is matches the error's kind
+func (e *ServerError) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// HttpStatusCode returns the error's HTTP status
+func (e *ServerError) HttpStatusCode() int {
+	if e.StatusCode != 0 {
+		return e.StatusCode
+	}
+
+	return e.Kind.HttpStatusCode()
+}
+
+// Detail returns the message safe to return to clients, omitting server error messages
+func (e *ServerError) Detail() string {
+	if e.HttpStatusCode() >= http.StatusInternalServerError {
+		return ""
+	}
+
+	return e.Message
+}
+
 func (e *ServerError) LogValue() slog.Value {
-	return slog.GroupValue(
-		slog.String("type", "client"),
-		slog.String("message", e.Err.Error()),
-	)
+	attrs := []slog.Attr{
+		slog.String("kind", e.Kind.String()),
+		slog.Int("status", e.HttpStatusCode()),
+		slog.String("message", e.Message),
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.String("cause", e.Err.Error()))
+	}
+	for i, violation := range e.Violations {
+		attrs = append(attrs, slog.String(fmt.Sprintf("violation.%d", i), violation.Field+": "+violation.Message))
+	}
+
+	return slog.GroupValue(attrs...)
 }
 
+// MeshAction is the mesh's verdict for a request
 type MeshAction uint
 
 const (
+	// PassThrough requests bypass validation and authentication
 	PassThrough MeshAction = iota
+	// Allow requests passed validation and authentication
+	Allow
+	// Deny requests failed validation or authentication and are not forwarded
+	Deny
+	// WouldDeny requests failed validation or authentication in report-only mode and are forwarded
+	WouldDeny
 )
+
+func (a MeshAction) String() string {
+	switch a {
+	case PassThrough:
+		return "pass-through"
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	case WouldDeny:
+		return "would-deny"
+	default:
+		return "unknown"
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	slogenv "github.com/cbrewster/slog-env"
 	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
 	cli "github.com/urfave/cli/v2"
 )
 
@@ -25,6 +26,15 @@ func main() {
 		Version:                fmt.Sprintf("%s [os: %s, arch: %s]", config.Version, runtime.GOOS, runtime.GOARCH),
 		Action:                 startServer,
 		Flags:                  config.Flags(),
+		Commands:               []*cli.Command{NewDlqCommand(config)},
+	}
+
+	// Subcommands run in the foreground; otherwise, arguments are the app's startup command
+	if len(os.Args) > 1 && os.Args[1] == dlqCommandName {
+		if err := app.Run(os.Args); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	go func() {
@@ -74,6 +84,34 @@ func startServer(c *cli.Context) error {
 		slog.String("app_port", config.YamlConfig.App.Port),
 	)
 
+	if config.YamlConfig.Mesh.IdentityToken.Enable {
+		if _, err := mesh.NewTokenSigner(config); err != nil {
+			return fmt.Errorf("invalid identity token config: %v", err)
+		}
+		slog.Info("Identity token enabled", slog.String("algorithm", config.YamlConfig.Mesh.IdentityToken.Algorithm))
+	}
+
+	if config.YamlConfig.Mesh.PayloadValidation.Enable {
+		if _, err := mesh.NewPayloadValidator(config); err != nil {
+			return fmt.Errorf("invalid payload validation config: %v", err)
+		}
+		slog.Info("Payload validation enabled", slog.String("schema_dir", config.YamlConfig.Mesh.PayloadValidation.SchemaDir))
+	}
+
+	if config.YamlConfig.Mesh.OpenAPI.Enable {
+		if _, err := mesh.NewOpenAPIValidator(config); err != nil {
+			return fmt.Errorf("invalid OpenAPI config: %v", err)
+		}
+		slog.Info("OpenAPI validation enabled", slog.String("spec_file", config.YamlConfig.Mesh.OpenAPI.SpecFile))
+	}
+
+	go func() {
+		slog.Info("Private routes are up!", slog.String("port", config.PrivatePort))
+		if err := http.ListenAndServe(":"+config.PrivatePort, NewPrivateRouter()); err != nil {
+			slog.Error("Private routes failed: " + err.Error())
+		}
+	}()
+
 	router := NewRouter()
 	slog.Info("Heroku Integration Service Mesh is up!", slog.String("port", port))
 
@@ -81,7 +119,19 @@ func startServer(c *cli.Context) error {
 		slog.Warn("Authentication bypass routes: " + strings.Join(config.YamlConfig.Mesh.Authentication.BypassRoutes, ", "))
 	}
 
-	return http.ListenAndServe(":"+port, router)
+	for _, route := range config.YamlConfig.Mesh.Routes {
+		slog.Info("Route policy",
+			slog.String("path", route.Path),
+			slog.String("request_types", strings.Join(route.RequestTypes, ", ")),
+			slog.String("methods", strings.Join(route.Methods, ", ")),
+		)
+	}
+
+	if config.YamlConfig.Mesh.HTTP2.Enable {
+		slog.Info("HTTP/2 cleartext (h2c) enabled")
+	}
+
+	return http.ListenAndServe(":"+port, mesh.H2CHandler(config, router))
 }
 
 func setEnvDefault(key, fallback string) {
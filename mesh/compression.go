@@ -0,0 +1,193 @@
+package mesh
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	HdrAcceptEncoding  = "Accept-Encoding"
+	HdrContentEncoding = "Content-Encoding"
+	HdrContentLength   = "Content-Length"
+	HdrVary            = "Vary"
+
+	MetricDecompressedRequestsTotal = MetricPrefix + "decompressed_requests_total"
+	MetricCompressedResponsesTotal  = MetricPrefix + "compressed_responses_total"
+)
+
+// DecompressRequest decompresses gzip and deflate request bodies, removing the request's
+// Content-Encoding.  Bodies decompressing beyond the configured limits are rejected - 413 Payload
+// Too Large - as are unsupported encodings - 415 Unsupported Media Type.
+func DecompressRequest(requestID string, requests conf.RequestCompression, incomingReq *http.Request, incomingReqBody []byte) ([]byte, error) {
+	encoding := strings.ToLower(strings.TrimSpace(strings.Join(incomingReq.Header.Values(HdrContentEncoding), ",")))
+	if encoding == "" || encoding == "identity" {
+		return incomingReqBody, nil
+	}
+
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(incomingReqBody))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(incomingReqBody))
+	default:
+		LogWarn(requestID, "Unsupported request Content-Encoding "+encoding)
+		GetMetrics().IncrCounter(MetricDecompressedRequestsTotal, "encoding", "", "outcome", "unsupported")
+		return nil, NewUnsupportedMediaType("Unsupported Content-Encoding '" + encoding + "'")
+	}
+
+	var body []byte
+	if err == nil {
+		limit := min(requests.MaxBytes, requests.MaxRatio*max(len(incomingReqBody), 1))
+		body, err = io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+		if err == nil && len(body) > limit {
+			LogWarn(requestID, "Decompressed request body exceeds "+strconv.Itoa(limit)+" bytes")
+			GetMetrics().IncrCounter(MetricDecompressedRequestsTotal, "encoding", encoding, "outcome", "too-large")
+			return nil, NewPayloadTooLarge("Decompressed request body too large")
+		}
+	}
+	if err != nil {
+		LogWarn(requestID, "Failed to decompress "+encoding+" request body: "+err.Error())
+		GetMetrics().IncrCounter(MetricDecompressedRequestsTotal, "encoding", encoding, "outcome", "invalid")
+		return nil, NewMalformedRequest("Invalid " + encoding + " request body")
+	}
+
+	incomingReq.Header.Del(HdrContentEncoding)
+	incomingReq.Header.Del(HdrContentLength)
+	incomingReq.ContentLength = int64(len(body))
+	GetMetrics().IncrCounter(MetricDecompressedRequestsTotal, "encoding", encoding, "outcome", "decompressed")
+
+	return body, nil
+}
+
+// NegotiateEncoding returns the client's preferred of the encodings, by Accept-Encoding quality
+// and then the encodings' order, or "" if the client accepts none
+func NegotiateEncoding(acceptEncoding string, encodings []string) string {
+	qualities := map[string]float64{}
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		qualities[name] = quality
+	}
+
+	preferred := ""
+	preferredQuality := 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities["*"]
+		}
+
+		if quality > preferredQuality {
+			preferred, preferredQuality = encoding, quality
+		}
+	}
+
+	return preferred
+}
+
+// CompressResponse returns the app's response compressed with the client's preferred encoding or,
+// when the response is not compressible, the response as is.  The app's response is not modified.
+func CompressResponse(requestID string, responses conf.ResponseCompression, incomingReq *http.Request, forwardResp *http.Response) *http.Response {
+	if !isCompressible(responses, incomingReq, forwardResp) {
+		return forwardResp
+	}
+
+	compressedResp := *forwardResp
+	compressedResp.Header = forwardResp.Header.Clone()
+	compressedResp.Header.Add(HdrVary, HdrAcceptEncoding)
+
+	if forwardResp.ContentLength >= 0 && forwardResp.ContentLength < int64(responses.MinBytes) {
+		return &compressedResp
+	}
+
+	encoding := NegotiateEncoding(strings.Join(incomingReq.Header.Values(HdrAcceptEncoding), ","), responses.Encodings)
+	if encoding == "" {
+		return &compressedResp
+	}
+
+	compressedResp.Header.Set(HdrContentEncoding, encoding)
+	compressedResp.Header.Del(HdrContentLength)
+	compressedResp.ContentLength = -1
+	compressedResp.Body = newCompressedBody(encoding, forwardResp.Body)
+	GetMetrics().IncrCounter(MetricCompressedResponsesTotal, "encoding", encoding)
+	LogDebug(requestID, "Compressing response with "+encoding)
+
+	return &compressedResp
+}
+
+// isCompressible returns whether the response may be compressed: it has a body, is not already
+// encoded and has a compressible content type
+func isCompressible(responses conf.ResponseCompression, incomingReq *http.Request, forwardResp *http.Response) bool {
+	if !responses.Enable || incomingReq.Method == http.MethodHead {
+		return false
+	}
+
+	switch forwardResp.StatusCode {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	if forwardResp.Header.Get(HdrContentEncoding) != "" || forwardResp.Header.Get("Content-Range") != "" ||
+		strings.Contains(strings.ToLower(forwardResp.Header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(forwardResp.Header.Get(HdrContentType))
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+
+	return MatchesContentType(responses.ContentTypes, mediaType)
+}
+
+// compressedBody compresses the app's response body as it is read
+type compressedBody struct {
+	*io.PipeReader
+	body io.ReadCloser
+}
+
+func newCompressedBody(encoding string, body io.ReadCloser) *compressedBody {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		var writer io.WriteCloser
+		if encoding == conf.CompressionEncodingBrotli {
+			writer = brotli.NewWriter(pipeWriter)
+		} else {
+			writer = gzip.NewWriter(pipeWriter)
+		}
+
+		_, err := io.Copy(writer, body)
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return &compressedBody{PipeReader: pipeReader, body: body}
+}
+
+func (compressedBody *compressedBody) Close() error {
+	_ = compressedBody.PipeReader.Close()
+	return compressedBody.body.Close()
+}
@@ -0,0 +1,227 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	MetricInFlight         = MetricPrefix + "in_flight"
+	MetricQueued           = MetricPrefix + "queued"
+	MetricConcurrencyLimit = MetricPrefix + "concurrency_limit"
+	MetricLoadShedTotal    = MetricPrefix + "load_shed_total"
+)
+
+var (
+	ErrQueueFull    = errors.New("concurrency queue full")
+	ErrQueueTimeout = errors.New("concurrency queue timeout")
+)
+
+// ConcurrencyLimiter limits requests in flight to the app, globally and per org,
+// queueing requests over the limits in arrival order
+type ConcurrencyLimiter struct {
+	mu            sync.Mutex
+	inFlight      int
+	inFlightByOrg map[string]int
+	limit         float64
+	lastDecrease  time.Time
+	queue         []*concurrencyWaiter
+}
+
+type concurrencyWaiter struct {
+	orgId    string
+	admitted chan struct{}
+}
+
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		inFlightByOrg: make(map[string]int),
+	}
+}
+
+// Acquire admits the org's request, waiting in the queue if over the limits.  The
+// returned release func must be called when the app has responded.  App latency is
+// observed separately, see ObserveLatency.  Orgs are counted by their 15-character ID.
+func (cl *ConcurrencyLimiter) Acquire(ctx context.Context, concurrency conf.Concurrency, orgId string) (func(), error) {
+	if !concurrency.Enable {
+		return func() {}, nil
+	}
+
+	orgId = NormalizeOrgID(orgId)
+
+	cl.mu.Lock()
+	if cl.limit == 0 {
+		cl.limit = float64(concurrency.MaxInFlight)
+	}
+
+	if cl.canAdmit(concurrency, orgId) {
+		cl.admit(orgId)
+		cl.mu.Unlock()
+		return cl.releaseFunc(concurrency, orgId), nil
+	}
+
+	if len(cl.queue) >= concurrency.QueueSize {
+		cl.mu.Unlock()
+		GetMetrics().IncrCounter(MetricLoadShedTotal, "reason", "queue_full")
+		return nil, ErrQueueFull
+	}
+
+	waiter := &concurrencyWaiter{orgId: orgId, admitted: make(chan struct{})}
+	cl.queue = append(cl.queue, waiter)
+	GetMetrics().SetGauge(MetricQueued, float64(len(cl.queue)))
+	cl.mu.Unlock()
+
+	timer := time.NewTimer(concurrency.QueueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-waiter.admitted:
+		return cl.releaseFunc(concurrency, orgId), nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	// Admitted while timing out
+	select {
+	case <-waiter.admitted:
+		return cl.releaseFunc(concurrency, orgId), nil
+	default:
+	}
+
+	cl.queue = slices.DeleteFunc(cl.queue, func(w *concurrencyWaiter) bool { return w == waiter })
+	GetMetrics().SetGauge(MetricQueued, float64(len(cl.queue)))
+	if errors.Is(err, ErrQueueTimeout) {
+		GetMetrics().IncrCounter(MetricLoadShedTotal, "reason", "queue_timeout")
+	}
+
+	return nil, err
+}
+
+// ObserveLatency adjusts the adaptive global limit by the app's latency to respond with
+// headers: slow responses decrease the limit, at most once per window, and fast responses
+// slowly increase it
+func (cl *ConcurrencyLimiter) ObserveLatency(concurrency conf.Concurrency, latency time.Duration, now time.Time) {
+	adaptive := concurrency.Adaptive
+	if !concurrency.Enable || !adaptive.Enable {
+		return
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.limit == 0 {
+		cl.limit = float64(concurrency.MaxInFlight)
+	}
+
+	if latency > adaptive.LatencyThreshold {
+		if now.Sub(cl.lastDecrease) < adaptive.Window {
+			return
+		}
+		cl.lastDecrease = now
+		cl.limit = math.Max(float64(adaptive.MinLimit), math.Floor(cl.limit*adaptive.DecreaseFactor))
+	} else {
+		cl.limit = math.Min(float64(concurrency.MaxInFlight), cl.limit+1/cl.limit)
+	}
+	GetMetrics().SetGauge(MetricConcurrencyLimit, math.Floor(cl.limit))
+
+	cl.admitQueued(concurrency)
+}
+
+// Limit returns the current global limit
+func (cl *ConcurrencyLimiter) Limit() int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return int(cl.limit)
+}
+
+// LimitRequest admits the org's request or returns a 503 Service Unavailable error
+// when the request is shed
+func (cl *ConcurrencyLimiter) LimitRequest(
+	requestID string,
+	config *conf.Config,
+	orgId string,
+	incomingRespWriter http.ResponseWriter,
+	incomingReq *http.Request) (func(), error) {
+
+	concurrency := config.YamlConfig.Mesh.Concurrency
+	release, err := cl.Acquire(incomingReq.Context(), concurrency, orgId)
+	if err != nil {
+		LogWarn(requestID, "Shedding request for org "+orgId+": "+err.Error())
+		retryAfter := int(math.Ceil(concurrency.QueueTimeout.Seconds()))
+		incomingRespWriter.Header().Set(HdrRetryAfter, strconv.Itoa(max(1, retryAfter)))
+		return nil, NewServiceUnavailable("Service overloaded")
+	}
+
+	return release, nil
+}
+
+func (cl *ConcurrencyLimiter) canAdmit(concurrency conf.Concurrency, orgId string) bool {
+	if cl.inFlight >= int(cl.limit) {
+		return false
+	}
+
+	return orgId == "" || concurrency.MaxInFlightPerOrg <= 0 || cl.inFlightByOrg[orgId] < concurrency.MaxInFlightPerOrg
+}
+
+func (cl *ConcurrencyLimiter) admit(orgId string) {
+	cl.inFlight++
+	cl.inFlightByOrg[orgId]++
+	GetMetrics().SetGauge(MetricInFlight, float64(cl.inFlight))
+}
+
+func (cl *ConcurrencyLimiter) releaseFunc(concurrency conf.Concurrency, orgId string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cl.release(concurrency, orgId)
+		})
+	}
+}
+
+func (cl *ConcurrencyLimiter) release(concurrency conf.Concurrency, orgId string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.inFlight--
+	cl.inFlightByOrg[orgId]--
+	if cl.inFlightByOrg[orgId] <= 0 {
+		delete(cl.inFlightByOrg, orgId)
+	}
+
+	cl.admitQueued(concurrency)
+}
+
+// admitQueued admits queued requests in arrival order, skipping orgs at their limit
+func (cl *ConcurrencyLimiter) admitQueued(concurrency conf.Concurrency) {
+	for i := 0; i < len(cl.queue); {
+		waiter := cl.queue[i]
+		if !cl.canAdmit(concurrency, waiter.orgId) {
+			if cl.inFlight >= int(cl.limit) {
+				break
+			}
+			i++
+			continue
+		}
+
+		cl.admit(waiter.orgId)
+		close(waiter.admitted)
+		cl.queue = slices.Delete(cl.queue, i, i+1)
+	}
+
+	GetMetrics().SetGauge(MetricInFlight, float64(cl.inFlight))
+	GetMetrics().SetGauge(MetricQueued, float64(len(cl.queue)))
+}
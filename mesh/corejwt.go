@@ -0,0 +1,136 @@
+package mesh
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+var errInvalidJWT = errors.New("malformed JWT")
+
+// CoreJWTClaims are the registered and org claims of the Salesforce core JWT, see XRequestContext.Auth
+type CoreJWTClaims struct {
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	OrgID     string   `json:"orgId"`
+}
+
+// audience is a JWT "aud" claim, a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// PreValidateCoreJWT inspects the Salesforce core JWT locally, before authenticating with the Heroku
+// Integration service, rejecting malformed, expired or not yet valid tokens and tokens whose issuer,
+// audience or org ID claims do not match the request context.  The token's signature is verified
+// by the Heroku Integration service.
+func PreValidateCoreJWT(requestID string, preValidation conf.CoreJWTPreValidation, requestContext *XRequestContext, now time.Time) error {
+	claims, err := parseCoreJWTClaims(requestContext.Auth)
+	if err != nil {
+		LogWarn(requestID, "Invalid core JWT: "+err.Error())
+		return NewUnauthenticatedRequest("Invalid token")
+	}
+
+	skew := preValidation.ClockSkew
+	if claims.ExpiresAt == nil || now.After(unixTime(*claims.ExpiresAt).Add(skew)) {
+		LogWarn(requestID, "Core JWT expired or missing exp claim")
+		return NewUnauthenticatedRequest("Token expired")
+	}
+
+	if claims.NotBefore != nil && now.Before(unixTime(*claims.NotBefore).Add(-skew)) {
+		LogWarn(requestID, "Core JWT not yet valid")
+		return NewUnauthenticatedRequest("Token not yet valid")
+	}
+
+	salesforceUrls := []string{requestContext.LoginUrl, requestContext.OrgDomainUrl}
+	if claims.Issuer != "" && !matchesAnyUrl(claims.Issuer, salesforceUrls) {
+		LogWarn(requestID, "Core JWT issuer "+claims.Issuer+" does not match request context")
+		return NewUnauthenticatedRequest("Token issuer mismatch")
+	}
+
+	if len(claims.Audience) > 0 && !matchesAudience(claims.Audience, salesforceUrls, requestContext.OrgID) {
+		LogWarn(requestID, "Core JWT audience "+strings.Join(claims.Audience, ", ")+" does not match request context")
+		return NewUnauthenticatedRequest("Token audience mismatch")
+	}
+
+	if claims.OrgID != "" && !OrgIDEquals(claims.OrgID, requestContext.OrgID) {
+		LogWarn(requestID, "Core JWT org "+claims.OrgID+" does not match request context")
+		return NewUnauthenticatedRequest("Token org mismatch")
+	}
+
+	return nil
+}
+
+func parseCoreJWTClaims(token string) (*CoreJWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil || header.Algorithm == "" || strings.EqualFold(header.Algorithm, "none") {
+		return nil, errInvalidJWT
+	}
+
+	var claims CoreJWTClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidJWT
+	}
+
+	return &claims, nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func matchesAnyUrl(value string, urls []string) bool {
+	for _, url := range urls {
+		if url != "" && strings.EqualFold(strings.TrimSuffix(value, "/"), strings.TrimSuffix(url, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAudience returns true if any audience is one of the given URLs or the org ID
+func matchesAudience(aud audience, urls []string, orgId string) bool {
+	for _, value := range aud {
+		if matchesAnyUrl(value, urls) || (orgId != "" && OrgIDEquals(value, orgId)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,374 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	MetricDeadLetterTotal        = MetricPrefix + "dead_letter_total"
+	MetricDeadLetterDroppedTotal = MetricPrefix + "dead_letter_dropped_total"
+
+	// Captured requests waiting to be written to the dead-letter store
+	deadLetterCaptureBuffer = 100
+)
+
+var ErrStoredRequestNotFound = errors.New("stored request not found")
+
+// StoredRequest is a request forwarded to the app, persisted for async delivery or as a dead letter
+type StoredRequest struct {
+	ID            string      `json:"id"`
+	RequestID     string      `json:"requestId"`
+	OrgID         string      `json:"orgId,omitempty"`
+	Route         string      `json:"route,omitempty"`
+	Method        string      `json:"method"`
+	RequestURI    string      `json:"requestUri"`
+	Host          string      `json:"host,omitempty"`
+	Header        http.Header `json:"header"`
+	Body          []byte      `json:"body"`
+	Identity      *Identity   `json:"identity,omitempty"`
+	Attempts      int         `json:"attempts"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	NextAttemptAt time.Time   `json:"nextAttemptAt,omitempty"`
+	Reason        string      `json:"reason,omitempty"`
+	FailedAt      time.Time   `json:"failedAt,omitempty"`
+}
+
+// NewStoredRequest captures the request forwarded to the app
+func NewStoredRequest(requestID string, orgId string, route string, forwardReq *http.Request, body []byte, identity *Identity) *StoredRequest {
+	now := time.Now().UTC()
+	return &StoredRequest{
+		ID:            now.Format("20060102T150405.000000000") + "-" + uuid.New().String(),
+		RequestID:     requestID,
+		OrgID:         orgId,
+		Route:         route,
+		Method:        forwardReq.Method,
+		RequestURI:    forwardReq.URL.RequestURI(),
+		Host:          forwardReq.Host,
+		Header:        forwardReq.Header.Clone(),
+		Body:          body,
+		Identity:      identity,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+}
+
+// RequestStore persists stored requests as JSON files, one per request, in a directory
+type RequestStore struct {
+	dir string
+}
+
+func NewRequestStore(dir string) *RequestStore {
+	return &RequestStore{dir: dir}
+}
+
+// Dir returns the store's directory
+func (store *RequestStore) Dir() string {
+	return store.dir
+}
+
+// Put creates or replaces the stored request, atomically
+func (store *RequestStore) Put(storedRequest *StoredRequest) error {
+	if err := os.MkdirAll(store.dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(storedRequest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(store.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), store.path(storedRequest.ID))
+}
+
+// Get returns the stored request with the given ID
+func (store *RequestStore) Get(id string) (*StoredRequest, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, ErrStoredRequestNotFound
+	}
+
+	data, err := os.ReadFile(store.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrStoredRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var storedRequest StoredRequest
+	if err := json.Unmarshal(data, &storedRequest); err != nil {
+		return nil, err
+	}
+
+	return &storedRequest, nil
+}
+
+// List returns the stored requests, oldest first
+func (store *RequestStore) List() ([]*StoredRequest, error) {
+	entries, err := os.ReadDir(store.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var storedRequests []*StoredRequest
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok || strings.HasPrefix(id, ".") {
+			continue
+		}
+
+		storedRequest, err := store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		storedRequests = append(storedRequests, storedRequest)
+	}
+
+	slices.SortFunc(storedRequests, func(a, b *StoredRequest) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return storedRequests, nil
+}
+
+// Count returns the number of stored requests
+func (store *RequestStore) Count() (int, error) {
+	entries, err := os.ReadDir(store.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") && !strings.HasPrefix(entry.Name(), ".") {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Delete removes the stored request with the given ID
+func (store *RequestStore) Delete(id string) error {
+	if _, err := store.Get(id); err != nil {
+		return err
+	}
+
+	return os.Remove(store.path(id))
+}
+
+func (store *RequestStore) path(id string) string {
+	return filepath.Join(store.dir, id+".json")
+}
+
+// DeadLetter moves the request to the dead-letter store, recording the failure reason
+func DeadLetter(requestID string, deadLetters *RequestStore, storedRequest *StoredRequest, reason string) error {
+	storedRequest.Reason = reason
+	storedRequest.FailedAt = time.Now().UTC()
+	storedRequest.NextAttemptAt = time.Time{}
+
+	GetMetrics().IncrCounter(MetricDeadLetterTotal, "route", storedRequest.Route)
+	LogError(requestID, "Dead-lettering request "+storedRequest.ID+": "+reason)
+	return deadLetters.Put(storedRequest)
+}
+
+// DeadLetterCapture captures requests forwarded to the app that the app failed to handle in the
+// dead-letter store, so that they may be replayed.  Requests are written in the background, off the
+// response path, and dropped when the store or the capture buffer is full.
+type DeadLetterCapture struct {
+	deadLetters *RequestStore
+	maxEntries  int
+	captures    chan *StoredRequest
+
+	// Captured requests not yet written
+	mu      sync.Mutex
+	written *sync.Cond
+	pending int
+}
+
+func NewDeadLetterCapture(asyncDelivery conf.AsyncDelivery) *DeadLetterCapture {
+	c := &DeadLetterCapture{
+		deadLetters: NewRequestStore(asyncDelivery.DeadLetterDir),
+		maxEntries:  asyncDelivery.MaxDeadLetters,
+		captures:    make(chan *StoredRequest, deadLetterCaptureBuffer),
+	}
+	c.written = sync.NewCond(&c.mu)
+	return c
+}
+
+// Run writes captured requests to the dead-letter store until ctx is done
+func (c *DeadLetterCapture) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case storedRequest := <-c.captures:
+			c.write(storedRequest)
+			c.done()
+		}
+	}
+}
+
+// Flush waits until requests captured before Flush are written to the dead-letter store or
+// dropped.  Flush is a no-op on a nil DeadLetterCapture.
+func (c *DeadLetterCapture) Flush() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.pending > 0 {
+		c.written.Wait()
+	}
+}
+
+func (c *DeadLetterCapture) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending--
+	if c.pending == 0 {
+		c.written.Broadcast()
+	}
+}
+
+// Capture captures the request forwarded to the app when the app answered with a 5xx or the
+// request failed, eg timed out.  Requests canceled by the client are not captured, as the client
+// may retry them.  Capture is a no-op on a nil DeadLetterCapture.
+func (c *DeadLetterCapture) Capture(
+	requestID string,
+	orgId string,
+	route string,
+	forwardReq *http.Request,
+	forwardReqBody []byte,
+	identity *Identity,
+	forwardResp *http.Response,
+	forwardErr error) {
+
+	if c == nil {
+		return
+	}
+
+	var reason string
+	switch {
+	case errors.Is(forwardErr, context.Canceled):
+		return
+	case forwardErr != nil:
+		reason = forwardErr.Error()
+	case forwardResp != nil && forwardResp.StatusCode >= http.StatusInternalServerError:
+		reason = "app responded " + strconv.Itoa(forwardResp.StatusCode)
+	default:
+		return
+	}
+
+	storedRequest := NewStoredRequest(requestID, orgId, route, forwardReq, forwardReqBody, identity)
+	storedRequest.Attempts = 1
+	storedRequest.Reason = reason
+
+	c.mu.Lock()
+	c.pending++
+	c.mu.Unlock()
+
+	select {
+	case c.captures <- storedRequest:
+	default:
+		c.done()
+		GetMetrics().IncrCounter(MetricDeadLetterDroppedTotal, "reason", "buffer-full")
+		LogError(requestID, "Dropping dead letter "+storedRequest.ID+": capture buffer full")
+	}
+}
+
+func (c *DeadLetterCapture) write(storedRequest *StoredRequest) {
+	requestID := storedRequest.RequestID
+	count, err := c.deadLetters.Count()
+	if err != nil {
+		LogError(requestID, "Failed to count dead letters: "+err.Error())
+		return
+	}
+
+	if count >= c.maxEntries {
+		GetMetrics().IncrCounter(MetricDeadLetterDroppedTotal, "reason", "store-full")
+		LogError(requestID, "Dropping dead letter "+storedRequest.ID+": "+strconv.Itoa(count)+" dead letters stored")
+		return
+	}
+
+	if err := DeadLetter(requestID, c.deadLetters, storedRequest, storedRequest.Reason); err != nil {
+		LogError(requestID, "Failed to dead-letter request "+storedRequest.ID+": "+err.Error())
+	}
+}
+
+// ReplayDeadLetter forwards the dead-lettered request to the app, removing it from the store once
+// delivered, returning the app's response status.  Requests that fail again remain in the store
+// with the new failure reason.
+func ReplayDeadLetter(
+	ctx context.Context,
+	config *conf.Config,
+	client *http.Client,
+	deadLetters *RequestStore,
+	storedRequest *StoredRequest,
+	signer *TokenSigner) (int, error) {
+
+	requestID := storedRequest.RequestID
+	storedRequest.Attempts++
+
+	statusCode := 0
+	resp, err := DeliverStoredRequest(ctx, config, client, storedRequest, signer)
+	if err == nil {
+		statusCode = resp.StatusCode
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if IsRetryableStatus(statusCode) {
+			err = errors.New("app responded " + strconv.Itoa(statusCode))
+		}
+	}
+
+	if err != nil {
+		storedRequest.Reason = err.Error()
+		storedRequest.FailedAt = time.Now().UTC()
+		if putErr := deadLetters.Put(storedRequest); putErr != nil {
+			LogError(requestID, "Failed to update dead-lettered request "+storedRequest.ID+": "+putErr.Error())
+		}
+		return statusCode, err
+	}
+
+	LogInfo(requestID, "Replayed dead-lettered request "+storedRequest.ID+": "+strconv.Itoa(statusCode))
+	return statusCode, deadLetters.Delete(storedRequest.ID)
+}
@@ -0,0 +1,330 @@
+package mesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	MetricAsyncQueued         = MetricPrefix + "async_queued"
+	MetricAsyncDeliveredTotal = MetricPrefix + "async_delivered_total"
+	MetricAsyncRetriesTotal   = MetricPrefix + "async_retries_total"
+
+	// Queued requests are rescanned at least this often
+	asyncDeliveryPollInterval = time.Minute
+)
+
+var ErrAsyncQueueFull = errors.New("async delivery queue full")
+
+// AsyncDelivery delivers requests persisted in an on-disk queue to the app, retrying with
+// exponential backoff and moving requests not delivered to the dead-letter store
+type AsyncDelivery struct {
+	config             *conf.Config
+	queue              *RequestStore
+	deadLetters        *RequestStore
+	client             *http.Client
+	concurrencyLimiter *ConcurrencyLimiter
+	tokenSigner        func(*conf.Config) (*TokenSigner, error)
+	notify             chan struct{}
+	mu                 sync.Mutex
+	delivering         map[string]bool
+	queued             int
+}
+
+// NewAsyncDelivery returns async delivery using the given transport, concurrency limiter shared
+// with requests forwarded to the app and, when identity tokens are enabled, token signer to
+// re-mint tokens on each attempt
+func NewAsyncDelivery(
+	config *conf.Config,
+	transport http.RoundTripper,
+	concurrencyLimiter *ConcurrencyLimiter,
+	tokenSigner func(*conf.Config) (*TokenSigner, error)) *AsyncDelivery {
+
+	asyncDelivery := config.YamlConfig.Mesh.AsyncDelivery
+	queue := NewRequestStore(asyncDelivery.Dir)
+
+	// Recounted on each scan of the queue, see claimDue
+	queued, _ := queue.Count()
+
+	return &AsyncDelivery{
+		config:             config,
+		queue:              queue,
+		deadLetters:        NewRequestStore(asyncDelivery.DeadLetterDir),
+		client:             &http.Client{Transport: transport, Timeout: asyncDelivery.Timeout},
+		concurrencyLimiter: concurrencyLimiter,
+		tokenSigner:        tokenSigner,
+		notify:             make(chan struct{}, 1),
+		delivering:         make(map[string]bool),
+		queued:             queued,
+	}
+}
+
+// Enqueue persists the request for delivery or, when MaxQueued requests are queued, returns
+// ErrAsyncQueueFull
+func (d *AsyncDelivery) Enqueue(storedRequest *StoredRequest) error {
+	d.mu.Lock()
+	if d.queued >= d.config.YamlConfig.Mesh.AsyncDelivery.MaxQueued {
+		d.mu.Unlock()
+		GetMetrics().IncrCounter(MetricLoadShedTotal, "reason", "async_queue_full")
+		return ErrAsyncQueueFull
+	}
+
+	if err := d.queue.Put(storedRequest); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	d.queued++
+	d.mu.Unlock()
+
+	GetMetrics().AddGauge(MetricAsyncQueued, 1)
+	LogInfo(storedRequest.RequestID, "Queued request "+storedRequest.ID+" for async delivery")
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run delivers queued requests, including requests queued before a restart, until ctx is done
+func (d *AsyncDelivery) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.notify:
+		case <-timer.C:
+		}
+
+		wait := asyncDeliveryPollInterval
+		if next := d.DeliverDue(time.Now()); !next.IsZero() {
+			wait = min(wait, max(0, time.Until(next)))
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// DeliverDue attempts delivery of queued requests due at now, up to the configured max in
+// parallel, returning when the next attempt is due or the zero time if the queue is empty.
+// Requests being delivered by a concurrent call are skipped.
+func (d *AsyncDelivery) DeliverDue(now time.Time) time.Time {
+	due, next, err := d.claimDue(now)
+	if err != nil {
+		LogError("n/a", "Failed to list async delivery queue: "+err.Error())
+		return now.Add(asyncDeliveryPollInterval)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	parallel := make(chan struct{}, max(1, d.config.YamlConfig.Mesh.AsyncDelivery.MaxParallel))
+	for _, storedRequest := range due {
+		parallel <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-parallel }()
+
+			nextAttemptAt := d.attempt(storedRequest, now)
+			d.unclaim(storedRequest)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !nextAttemptAt.IsZero() && (next.IsZero() || nextAttemptAt.Before(next)) {
+				next = nextAttemptAt
+			}
+		}()
+	}
+	wg.Wait()
+
+	return next
+}
+
+// claimDue marks queued requests due at now as being delivered, returning them and when the
+// next of the remaining requests is due
+func (d *AsyncDelivery) claimDue(now time.Time) ([]*StoredRequest, time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	storedRequests, err := d.queue.List()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	d.queued = len(storedRequests)
+	GetMetrics().SetGauge(MetricAsyncQueued, float64(len(storedRequests)))
+
+	var due []*StoredRequest
+	var next time.Time
+	for _, storedRequest := range storedRequests {
+		if d.delivering[storedRequest.ID] {
+			continue
+		}
+
+		if storedRequest.NextAttemptAt.After(now) {
+			if next.IsZero() || storedRequest.NextAttemptAt.Before(next) {
+				next = storedRequest.NextAttemptAt
+			}
+			continue
+		}
+
+		d.delivering[storedRequest.ID] = true
+		due = append(due, storedRequest)
+	}
+
+	return due, next, nil
+}
+
+func (d *AsyncDelivery) unclaim(storedRequest *StoredRequest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.delivering, storedRequest.ID)
+}
+
+// attempt delivers the request, returning when the next attempt is due or the zero time
+// if the request was delivered or dead-lettered.  Requests shed by the concurrency limiter
+// are retried without counting the attempt.
+func (d *AsyncDelivery) attempt(storedRequest *StoredRequest, now time.Time) time.Time {
+	requestID := storedRequest.RequestID
+	asyncDelivery := d.config.YamlConfig.Mesh.AsyncDelivery
+
+	release, err := d.concurrencyLimiter.Acquire(context.Background(), d.config.YamlConfig.Mesh.Concurrency, storedRequest.OrgID)
+	if err != nil {
+		LogWarn(requestID, "Deferring delivery of request "+storedRequest.ID+": "+err.Error())
+		return now.Add(asyncDelivery.InitialBackoff)
+	}
+	defer release()
+
+	storedRequest.Attempts++
+
+	reason := d.deliver(storedRequest)
+	if reason == "" {
+		GetMetrics().IncrCounter(MetricAsyncDeliveredTotal, "route", storedRequest.Route)
+		d.remove(storedRequest)
+		return time.Time{}
+	}
+
+	if storedRequest.Attempts >= asyncDelivery.MaxAttempts {
+		reason = fmt.Sprintf("%s after %d attempts", reason, storedRequest.Attempts)
+		if err := DeadLetter(requestID, d.deadLetters, storedRequest, reason); err != nil {
+			LogError(requestID, "Failed to dead-letter request "+storedRequest.ID+": "+err.Error())
+			return now.Add(asyncDeliveryPollInterval)
+		}
+		d.remove(storedRequest)
+		return time.Time{}
+	}
+
+	backoff := AsyncDeliveryBackoff(asyncDelivery, storedRequest.Attempts)
+	storedRequest.Reason = reason
+	storedRequest.NextAttemptAt = now.Add(backoff)
+	GetMetrics().IncrCounter(MetricAsyncRetriesTotal, "route", storedRequest.Route)
+	LogWarn(requestID, "Failed to deliver request "+storedRequest.ID+": "+reason+", retrying in "+backoff.String())
+
+	if err := d.queue.Put(storedRequest); err != nil {
+		LogError(requestID, "Failed to update queued request "+storedRequest.ID+": "+err.Error())
+	}
+
+	return storedRequest.NextAttemptAt
+}
+
+// deliver forwards the request to the app, returning the failure reason, if any.  Requests
+// the app answers with 5xx or 429 Too Many Requests are retried.
+func (d *AsyncDelivery) deliver(storedRequest *StoredRequest) string {
+	var signer *TokenSigner
+	if d.config.YamlConfig.Mesh.IdentityToken.Enable && storedRequest.Identity != nil {
+		var err error
+		if signer, err = d.tokenSigner(d.config); err != nil {
+			return "failed to load identity token signer: " + err.Error()
+		}
+	}
+
+	resp, err := DeliverStoredRequest(context.Background(), d.config, d.client, storedRequest, signer)
+	if err != nil {
+		return err.Error()
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if IsRetryableStatus(resp.StatusCode) {
+		return "app responded " + strconv.Itoa(resp.StatusCode)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		LogWarn(storedRequest.RequestID, "App rejected request "+storedRequest.ID+": "+strconv.Itoa(resp.StatusCode))
+	} else {
+		LogInfo(storedRequest.RequestID, "Delivered request "+storedRequest.ID)
+	}
+
+	return ""
+}
+
+func (d *AsyncDelivery) remove(storedRequest *StoredRequest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.queue.Delete(storedRequest.ID); err != nil {
+		LogError(storedRequest.RequestID, "Failed to remove queued request "+storedRequest.ID+": "+err.Error())
+		return
+	}
+	d.queued--
+}
+
+// DeliverStoredRequest forwards the stored request to the app, re-minting its identity token
+// when a signer is given
+func DeliverStoredRequest(
+	ctx context.Context,
+	config *conf.Config,
+	client *http.Client,
+	storedRequest *StoredRequest,
+	signer *TokenSigner) (*http.Response, error) {
+
+	forwardApiUrl := fmt.Sprintf("%s:%s%s", config.YamlConfig.App.Host, config.YamlConfig.App.Port, storedRequest.RequestURI)
+	forwardReq, err := http.NewRequestWithContext(ctx, storedRequest.Method, forwardApiUrl, bytes.NewReader(storedRequest.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	forwardReq.Header = storedRequest.Header.Clone()
+	if forwardReq.Header == nil {
+		forwardReq.Header = http.Header{}
+	}
+	forwardReq.Host = storedRequest.Host
+
+	if signer != nil && storedRequest.Identity != nil {
+		if err := SetIdentityToken(storedRequest.RequestID, signer, forwardReq.Header, storedRequest.Identity); err != nil {
+			return nil, err
+		}
+	}
+
+	return client.Do(forwardReq)
+}
+
+// IsRetryableStatus returns whether the app's response status indicates delivery may succeed later
+func IsRetryableStatus(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+}
+
+// AsyncDeliveryBackoff returns the backoff after the given number of attempts
+func AsyncDeliveryBackoff(asyncDelivery conf.AsyncDelivery, attempts int) time.Duration {
+	backoff := float64(asyncDelivery.InitialBackoff) * math.Pow(2, float64(max(0, attempts-1)))
+	return time.Duration(math.Min(backoff, float64(asyncDelivery.MaxBackoff)))
+}
@@ -0,0 +1,210 @@
+package mesh
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	MetricFanOutEventsTotal = MetricPrefix + "fan_out_events_total"
+
+	// Headers identifying each event forwarded to the app
+	HdrEventIndex = "x-heroku-integration-mesh-event-index"
+	HdrEventCount = "x-heroku-integration-mesh-event-count"
+
+	// Event response bodies are included in fan-out results up to this size
+	fanOutMaxResultBytes = 64 << 10
+)
+
+// FanOutResult is the app's response to a single event
+type FanOutResult struct {
+	Index  int             `json:"index"`
+	Status int             `json:"status,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// FanOutResponse aggregates the app's responses to a batch's events, in batch order
+type FanOutResponse struct {
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []FanOutResult `json:"results"`
+}
+
+// StatusCode is 200 OK when every event succeeded, 502 Bad Gateway when every event failed,
+// otherwise 207 Multi-Status
+func (fanOutResponse *FanOutResponse) StatusCode() int {
+	switch {
+	case fanOutResponse.Failed == 0:
+		return http.StatusOK
+	case fanOutResponse.Succeeded == 0:
+		return http.StatusBadGateway
+	default:
+		return http.StatusMultiStatus
+	}
+}
+
+// FanOutFailure is called with each event request the app failed to handle, see DeadLetterCapture
+type FanOutFailure func(forwardReq *http.Request, event []byte, forwardResp *http.Response, err error)
+
+// IsFanOut returns whether the route splits batched events
+func IsFanOut(route *conf.Route) bool {
+	return route != nil && route.FanOut != nil && route.FanOut.Enable
+}
+
+// SplitEvents returns the payload's events or false if the payload has no events array
+func SplitEvents(payload []byte) ([]json.RawMessage, bool) {
+	var batch struct {
+		Events *[]json.RawMessage `json:"events"`
+	}
+
+	if err := json.Unmarshal(payload, &batch); err != nil || batch.Events == nil {
+		return nil, false
+	}
+
+	return *batch.Events, true
+}
+
+// FanOut forwards each event to the app as its own request, aggregating the app's responses.
+// Events are forwarded up to the route's MaxParallel at a time or, when Ordered, one at a time,
+// each holding its own concurrency limiter slot.
+func FanOut(
+	requestID string,
+	route string,
+	fanOut conf.FanOut,
+	concurrencyLimiter *ConcurrencyLimiter,
+	concurrency conf.Concurrency,
+	orgId string,
+	transport http.RoundTripper,
+	forwardApiUrl string,
+	incomingReq *http.Request,
+	events []json.RawMessage,
+	onFailure FanOutFailure) *FanOutResponse {
+
+	LogInfo(requestID, "Fanning out "+strconv.Itoa(len(events))+" events...")
+
+	parallel := fanOut.MaxParallel
+	if fanOut.Ordered {
+		parallel = 1
+	}
+
+	results := make([]FanOutResult, len(events))
+	semaphore := make(chan struct{}, max(1, parallel))
+	var wg sync.WaitGroup
+	for i, event := range events {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			results[i] = forwardEvent(requestID, concurrencyLimiter, concurrency, orgId, transport, forwardApiUrl, incomingReq,
+				i, len(events), event, onFailure)
+		}()
+	}
+	wg.Wait()
+
+	fanOutResponse := &FanOutResponse{Results: results}
+	for _, result := range results {
+		if result.Error == "" && result.Status < http.StatusBadRequest {
+			fanOutResponse.Succeeded++
+		} else {
+			fanOutResponse.Failed++
+		}
+	}
+
+	GetMetrics().AddCounter(MetricFanOutEventsTotal, float64(fanOutResponse.Succeeded), "route", route, "outcome", "success")
+	GetMetrics().AddCounter(MetricFanOutEventsTotal, float64(fanOutResponse.Failed), "route", route, "outcome", "failure")
+
+	return fanOutResponse
+}
+
+// forwardEvent forwards the event at index to the app, within the concurrency limit, adapting the
+// limit to the app's latency to respond.  Events shed by the concurrency limiter fail with 503
+// Service Unavailable.
+func forwardEvent(
+	requestID string,
+	concurrencyLimiter *ConcurrencyLimiter,
+	concurrency conf.Concurrency,
+	orgId string,
+	transport http.RoundTripper,
+	forwardApiUrl string,
+	incomingReq *http.Request,
+	index int,
+	count int,
+	event []byte,
+	onFailure FanOutFailure) FanOutResult {
+
+	result := FanOutResult{Index: index}
+	forwardReq, err := NewForwardRequest(forwardApiUrl, incomingReq, event)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	forwardReq.Header.Set(HdrEventIndex, strconv.Itoa(index))
+	forwardReq.Header.Set(HdrEventCount, strconv.Itoa(count))
+
+	release, err := concurrencyLimiter.Acquire(incomingReq.Context(), concurrency, orgId)
+	if err != nil {
+		LogWarn(requestID, "Shedding event "+strconv.Itoa(index)+" for org "+orgId+": "+err.Error())
+		result.Status = http.StatusServiceUnavailable
+		result.Error = err.Error()
+		return result
+	}
+	defer release()
+
+	client := &http.Client{Transport: transport}
+	forwardStartTime := time.Now()
+	forwardResp, err := client.Do(forwardReq)
+	if err == nil {
+		concurrencyLimiter.ObserveLatency(concurrency, time.Since(forwardStartTime), time.Now())
+	}
+	if err != nil {
+		LogError(requestID, "Failed to forward event "+strconv.Itoa(index)+": "+err.Error())
+		onFailure(forwardReq, event, nil, err)
+		result.Error = err.Error()
+		return result
+	}
+	defer forwardResp.Body.Close()
+
+	result.Status = forwardResp.StatusCode
+	body, err := io.ReadAll(io.LimitReader(forwardResp.Body, fanOutMaxResultBytes))
+	if err == nil && len(body) > 0 {
+		if json.Valid(body) {
+			result.Body = body
+		} else {
+			result.Body, _ = json.Marshal(string(body))
+		}
+	}
+
+	if forwardResp.StatusCode >= http.StatusBadRequest {
+		LogWarn(requestID, "App responded "+strconv.Itoa(forwardResp.StatusCode)+" to event "+strconv.Itoa(index))
+		onFailure(forwardReq, event, forwardResp, nil)
+	}
+
+	return result
+}
+
+// WriteFanOutResponse replies to the incoming request with the aggregated fan-out response
+func WriteFanOutResponse(requestID string, incomingRespWriter http.ResponseWriter, fanOutResponse *FanOutResponse) []byte {
+	body, err := json.Marshal(fanOutResponse)
+	if err != nil {
+		LogError(requestID, "Failed to encode fan-out response: "+err.Error())
+	}
+
+	incomingRespWriter.Header().Set(HdrContentType, "application/json")
+	incomingRespWriter.WriteHeader(fanOutResponse.StatusCode())
+	if _, err := incomingRespWriter.Write(body); err != nil {
+		LogError(requestID, err.Error())
+	}
+
+	return body
+}
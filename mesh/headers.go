@@ -0,0 +1,156 @@
+package mesh
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	HdrConnection      = "Connection"
+	HdrForwarded       = "Forwarded"
+	HdrXForwardedFor   = "X-Forwarded-For"
+	HdrXForwardedHost  = "X-Forwarded-Host"
+	HdrXForwardedProto = "X-Forwarded-Proto"
+)
+
+// Hop-by-hop headers apply to a single connection and are not forwarded.  See RFC 9110, section 7.6.1.
+var hopByHopHeaders = []string{
+	HdrConnection,
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// NewForwardRequest builds the request forwarded to the app from the incoming request.
+//
+// All header values are copied except hop-by-hop headers and x-request-context.  The
+// original Host is preserved and forwarding headers are set, see SetForwardedHeaders.
+func NewForwardRequest(forwardApiUrl string, incomingReq *http.Request, incomingReqBody []byte) (*http.Request, error) {
+	forwardReq, err := http.NewRequestWithContext(incomingReq.Context(), incomingReq.Method, forwardApiUrl, bytes.NewReader(incomingReqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	CopyHeaders(forwardReq.Header, incomingReq.Header)
+	RemoveHopByHopHeaders(forwardReq.Header)
+	forwardReq.Header.Del(HdrRequestContext)
+
+	forwardReq.Host = incomingReq.Host
+	SetForwardedHeaders(forwardReq.Header, incomingReq)
+
+	return forwardReq, nil
+}
+
+// CopyHeaders adds all values of each source header to the destination
+func CopyHeaders(dst http.Header, src http.Header) {
+	for header, values := range src {
+		for _, value := range values {
+			dst.Add(header, value)
+		}
+	}
+}
+
+// RemoveHopByHopHeaders removes hop-by-hop headers, including those listed in the Connection header
+func RemoveHopByHopHeaders(headers http.Header) {
+	for _, value := range headers.Values(HdrConnection) {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				headers.Del(header)
+			}
+		}
+	}
+
+	for _, header := range hopByHopHeaders {
+		headers.Del(header)
+	}
+}
+
+// SetForwardedHeaders sets X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host and
+// Forwarded headers.
+//
+// Behind the Heroku router, X-Forwarded-For and X-Forwarded-Proto are set by the router,
+// which appends the client's address, and are preserved.  Otherwise, the values are
+// derived from the incoming request.
+func SetForwardedHeaders(headers http.Header, incomingReq *http.Request) {
+	if headers.Get(HdrXForwardedFor) == "" {
+		if clientIP := remoteIP(incomingReq.RemoteAddr); clientIP != "" {
+			headers.Set(HdrXForwardedFor, clientIP)
+		}
+	}
+
+	proto := headers.Get(HdrXForwardedProto)
+	if proto == "" {
+		proto = "http"
+		if incomingReq.TLS != nil {
+			proto = "https"
+		}
+		headers.Set(HdrXForwardedProto, proto)
+	}
+
+	if headers.Get(HdrXForwardedHost) == "" && incomingReq.Host != "" {
+		headers.Set(HdrXForwardedHost, incomingReq.Host)
+	}
+
+	// Forwarded, see RFC 7239
+	var forwarded []string
+	if clientIP, _, _ := strings.Cut(headers.Get(HdrXForwardedFor), ","); strings.TrimSpace(clientIP) != "" {
+		forwarded = append(forwarded, "for="+forwardedNode(strings.TrimSpace(clientIP)))
+	}
+	if incomingReq.Host != "" {
+		forwarded = append(forwarded, "host="+quoteForwarded(incomingReq.Host))
+	}
+	forwarded = append(forwarded, "proto="+proto)
+
+	element := strings.Join(forwarded, ";")
+	if existing := strings.Join(headers.Values(HdrForwarded), ", "); existing != "" {
+		element = existing + ", " + element
+	}
+	headers.Set(HdrForwarded, element)
+}
+
+// remoteIP returns the IP of the given host:port or IP address
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
+
+// forwardedNode formats an IP as a Forwarded node, quoting and bracketing IPv6 addresses
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+
+	return ip
+}
+
+// quoteForwarded quotes values containing characters not allowed in a Forwarded token
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, ":[]\" ,;=") {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+
+	return value
+}
+
+// MatchesContentType returns whether the media type matches one of the content types, eg
+// application/json or text/*
+func MatchesContentType(contentTypes []string, mediaType string) bool {
+	return slices.ContainsFunc(contentTypes, func(contentType string) bool {
+		if prefix, ok := strings.CutSuffix(contentType, "/*"); ok {
+			return strings.HasPrefix(mediaType, prefix+"/")
+		}
+		return mediaType == contentType
+	})
+}
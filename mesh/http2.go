@@ -0,0 +1,57 @@
+package mesh
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// NewAppTransport returns the transport forwarding requests to the app: HTTP/1.1 or, when the app
+// supports HTTP/2, h2c to http hosts and HTTP/2 negotiated over TLS with https hosts
+func NewAppTransport(config *conf.Config) http.RoundTripper {
+	app := config.YamlConfig.App
+	if !app.HTTP2 {
+		return http.DefaultTransport
+	}
+
+	if strings.HasPrefix(app.Host, "https://") {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ForceAttemptHTTP2 = true
+		return transport
+	}
+
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network string, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// NewAppUpgradeTransport returns the transport forwarding upgrade requests, eg WebSocket handshakes,
+// to the app: HTTP/1.1 only, as HTTP/1.1 upgrades are not supported over HTTP/2
+func NewAppUpgradeTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	return transport
+}
+
+// H2CHandler serves HTTP/2 cleartext, h2c, requests, both with prior knowledge and upgraded from
+// HTTP/1.1, alongside HTTP/1.1 requests, when enabled
+func H2CHandler(config *conf.Config, handler http.Handler) http.Handler {
+	if !config.YamlConfig.Mesh.HTTP2.Enable {
+		return handler
+	}
+
+	return h2c.NewHandler(handler, &http2.Server{
+		MaxConcurrentStreams: config.YamlConfig.Mesh.HTTP2.MaxConcurrentStreams,
+	})
+}
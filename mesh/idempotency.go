@@ -0,0 +1,205 @@
+package mesh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	MetricIdempotentDuplicatesTotal = MetricPrefix + "idempotent_duplicates_total"
+
+	// HdrIdempotentReplayed is set on cached responses returned for duplicate requests
+	HdrIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// CachedResponse is the app's response to an idempotent request.  A zero StatusCode marks a
+// request in flight.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyCache remembers, per org keyed by 15-character org ID, the app's responses to
+// idempotent requests
+type IdempotencyCache struct {
+	mu             sync.Mutex
+	responsesByOrg map[string]*LRU[string, *CachedResponse]
+	lastPrune      time.Time
+}
+
+func NewIdempotencyCache() *IdempotencyCache {
+	return &IdempotencyCache{
+		responsesByOrg: make(map[string]*LRU[string, *CachedResponse]),
+	}
+}
+
+// IdempotencyKey returns the request's idempotency key, a digest of the request's method and path
+// and the configured header value, payload JSON path value or payload, or "" if the request has
+// no key
+func IdempotencyKey(idempotency conf.Idempotency, incomingReq *http.Request, payload []byte) string {
+	var value []byte
+	switch idempotency.KeyBy {
+	case conf.IdempotencyKeyByHeader:
+		value = []byte(incomingReq.Header.Get(idempotency.Header))
+	case conf.IdempotencyKeyByJSONPath:
+		if pathValue, ok := LookupJSONBodyPath(payload, idempotency.Path); ok && pathValue != nil {
+			value = []byte(fmt.Sprint(pathValue))
+		}
+	default:
+		value = payload
+	}
+
+	if len(value) == 0 {
+		return ""
+	}
+
+	digest := sha256.New()
+	digest.Write([]byte(incomingReq.Method))
+	digest.Write([]byte{0})
+	digest.Write([]byte(incomingReq.URL.Path))
+	digest.Write([]byte{0})
+	digest.Write(value)
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// Begin returns the cached response to the org's duplicate request or, for new requests, nil,
+// marking the request in flight until Complete.  Duplicates of requests in flight are rejected
+// with a conflict - 409 Conflict.
+func (c *IdempotencyCache) Begin(
+	requestID string,
+	idempotency conf.Idempotency,
+	route string,
+	orgId string,
+	key string,
+	now time.Time) (*CachedResponse, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastPrune) >= orgCachePruneInterval {
+		c.lastPrune = now
+		pruneByOrg(c.responsesByOrg, now)
+	}
+
+	responses, ok := c.responsesByOrg[NormalizeOrgID(orgId)]
+	if !ok {
+		responses = NewLRU[string, *CachedResponse](idempotency.MaxEntries, idempotency.TTL)
+		c.responsesByOrg[NormalizeOrgID(orgId)] = responses
+	}
+
+	cachedResponse, duplicate := responses.Get(key, now)
+	if !duplicate {
+		responses.Add(key, &CachedResponse{}, now)
+		return nil, nil
+	}
+
+	if cachedResponse.StatusCode == 0 {
+		LogWarn(requestID, "Duplicate request in flight for org "+orgId)
+		GetMetrics().IncrCounter(MetricIdempotentDuplicatesTotal, "route", route, "outcome", "in-flight")
+		return nil, NewConflictRequest("Request already in progress")
+	}
+
+	LogInfo(requestID, "Duplicate request for org "+orgId+", replying with cached response")
+	GetMetrics().IncrCounter(MetricIdempotentDuplicatesTotal, "route", route, "outcome", "cached")
+	return cachedResponse, nil
+}
+
+// Complete caches the app's response to the org's request or, when nil, forgets the request so
+// that it may be retried
+func (c *IdempotencyCache) Complete(
+	idempotency conf.Idempotency,
+	orgId string,
+	key string,
+	cachedResponse *CachedResponse,
+	now time.Time) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	responses, ok := c.responsesByOrg[NormalizeOrgID(orgId)]
+	if !ok {
+		return
+	}
+
+	if cachedResponse == nil {
+		responses.Remove(key)
+		if responses.Len() == 0 {
+			delete(c.responsesByOrg, NormalizeOrgID(orgId))
+		}
+		return
+	}
+
+	responses.Add(key, cachedResponse, now)
+}
+
+// ResponseCapture captures the app's response, up to a limit, as it is copied to the client
+type ResponseCapture struct {
+	resp      *http.Response
+	body      io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	complete  bool
+	truncated bool
+}
+
+// CaptureResponse captures up to limit bytes of the response's body as it is read
+func CaptureResponse(resp *http.Response, limit int) *ResponseCapture {
+	capture := &ResponseCapture{resp: resp, body: resp.Body, limit: limit}
+	resp.Body = capture
+	return capture
+}
+
+func (capture *ResponseCapture) Read(p []byte) (int, error) {
+	n, err := capture.body.Read(p)
+	if n > 0 && !capture.truncated {
+		if capture.buf.Len()+n > capture.limit {
+			capture.truncated = true
+			capture.buf.Reset()
+		} else {
+			capture.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF {
+		capture.complete = true
+	}
+
+	return n, err
+}
+
+func (capture *ResponseCapture) Close() error {
+	return capture.body.Close()
+}
+
+// Response returns the captured response or nil if the body was not read completely or
+// exceeded the limit
+func (capture *ResponseCapture) Response() *CachedResponse {
+	if !capture.complete || capture.truncated {
+		return nil
+	}
+
+	return &CachedResponse{
+		StatusCode: capture.resp.StatusCode,
+		Header:     capture.resp.Header.Clone(),
+		Body:       bytes.Clone(capture.buf.Bytes()),
+	}
+}
+
+// WriteCachedResponse replies to a duplicate request with the cached response
+func WriteCachedResponse(requestID string, incomingRespWriter http.ResponseWriter, cachedResponse *CachedResponse) {
+	CopyHeaders(incomingRespWriter.Header(), cachedResponse.Header)
+	incomingRespWriter.Header().Set(HdrIdempotentReplayed, "true")
+	incomingRespWriter.WriteHeader(cachedResponse.StatusCode)
+	if _, err := incomingRespWriter.Write(cachedResponse.Body); err != nil {
+		LogError(requestID, err.Error())
+	}
+}
@@ -0,0 +1,98 @@
+package mesh
+
+import (
+	"net/http"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+)
+
+// Identity is the requester's identity as verified by the mesh
+type Identity struct {
+	OrgID        string
+	OrgDomainUrl string
+	AppUUID      string
+	ContextType  string
+	Resource     string
+	RequestType  string
+	AuthOutcome  meshErrors.MeshAction
+}
+
+// NewIdentity returns the identity of a request that bypassed validation and authentication
+func NewIdentity() *Identity {
+	return &Identity{
+		RequestType: conf.RequestTypeNone,
+		AuthOutcome: meshErrors.PassThrough,
+	}
+}
+
+// SetRequestHeader sets identity from the validated request
+func (identity *Identity) SetRequestHeader(requestHeader *RequestHeader, incomingReq *http.Request) {
+	identity.OrgID = GetOrgID(requestHeader, incomingReq)
+	identity.RequestType = requestHeader.RequestType()
+	if requestHeader.IsSalesforceRequest {
+		identity.OrgDomainUrl = requestHeader.XRequestContext.OrgDomainUrl
+		identity.AppUUID = requestHeader.XRequestContext.AppUUID
+		identity.ContextType = requestHeader.XRequestContext.Type
+		identity.Resource = requestHeader.XRequestContext.Resource
+	}
+}
+
+// Trusted returns whether the identity may be forwarded to the app.  Identities of requests that
+// report-only mode would deny are built from unauthenticated headers and are not.
+func (identity *Identity) Trusted() bool {
+	return identity.AuthOutcome != meshErrors.WouldDeny
+}
+
+// StripIdentityHeaders removes client-supplied copies of mesh-owned headers, including identity
+// tokens whether or not the mesh mints tokens
+func StripIdentityHeaders(config *conf.Config, headers http.Header) {
+	identityHeaders := config.YamlConfig.Mesh.IdentityHeaders
+	identityTokenHeader := config.YamlConfig.Mesh.IdentityToken.Header
+	if identityTokenHeader == "" {
+		identityTokenHeader = conf.IdentityTokenHeader
+	}
+
+	for _, header := range []string{
+		identityHeaders.OrgID,
+		identityHeaders.OrgDomainUrl,
+		identityHeaders.AppUUID,
+		identityHeaders.ContextType,
+		identityHeaders.Resource,
+		identityHeaders.RequestType,
+		identityHeaders.AuthOutcome,
+		identityTokenHeader,
+		HdrMeshVerdict,
+		HdrMeshVerdictReason,
+	} {
+		if header != "" {
+			headers.Del(header)
+		}
+	}
+}
+
+// SetIdentityHeaders sets mesh-owned identity headers on the request forwarded to the app, if the
+// identity is trusted
+func SetIdentityHeaders(config *conf.Config, headers http.Header, identity *Identity) {
+	identityHeaders := config.YamlConfig.Mesh.IdentityHeaders
+	if identityHeaders.Enable != "true" || !identity.Trusted() {
+		return
+	}
+
+	for _, header := range []struct {
+		name  string
+		value string
+	}{
+		{identityHeaders.OrgID, identity.OrgID},
+		{identityHeaders.OrgDomainUrl, identity.OrgDomainUrl},
+		{identityHeaders.AppUUID, identity.AppUUID},
+		{identityHeaders.ContextType, identity.ContextType},
+		{identityHeaders.Resource, identity.Resource},
+		{identityHeaders.RequestType, identity.RequestType},
+		{identityHeaders.AuthOutcome, identity.AuthOutcome.String()},
+	} {
+		if header.name != "" && header.value != "" {
+			headers.Set(header.name, header.value)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// LookupJSONPath returns the value at the dot-separated path, eg "events.0.timestamp", in the
+// decoded JSON value.  Array elements are addressed by index.
+func LookupJSONPath(value any, path string) (any, bool) {
+	if path == "" {
+		return value, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			value = node[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// LookupJSONBodyPath decodes the JSON body and returns the value at the path, see LookupJSONPath
+func LookupJSONBodyPath(body []byte, path string) (any, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+
+	return LookupJSONPath(value, path)
+}
@@ -0,0 +1,114 @@
+package mesh
+
+import (
+	"container/list"
+	"time"
+)
+
+// Per-org caches are swept for expired entries and idle orgs at this interval
+const orgCachePruneInterval = time.Minute
+
+// LRU is a bounded, least-recently-used cache whose entries expire after a TTL.  LRU is not
+// safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+	items    map[K]*list.Element
+	order    *list.List
+	// Entries in the order they were added, which is the order they expire
+	expiry *list.List
+}
+
+type lruEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+	expiry    *list.Element
+}
+
+// NewLRU returns a cache of up to capacity entries expiring after ttl
+func NewLRU[K comparable, V any](capacity int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: max(1, capacity),
+		ttl:      ttl,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+		expiry:   list.New(),
+	}
+}
+
+// Get returns the unexpired value of the key, marking it recently used
+func (c *LRU[K, V]) Get(key K, now time.Time) (V, bool) {
+	element, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[K, V])
+	if !now.Before(entry.expiresAt) {
+		c.remove(element)
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Add adds or replaces the key's value, evicting expired and, when full, least recently used entries
+func (c *LRU[K, V]) Add(key K, value V, now time.Time) {
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+
+	c.prune(now)
+	for c.order.Len() >= c.capacity {
+		c.remove(c.order.Back())
+	}
+
+	entry := &lruEntry[K, V]{key: key, value: value, expiresAt: now.Add(c.ttl)}
+	entry.expiry = c.expiry.PushBack(entry)
+	c.items[key] = c.order.PushFront(entry)
+}
+
+// Remove removes the key
+func (c *LRU[K, V]) Remove(key K) {
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Len returns the number of entries, including expired entries not yet pruned
+func (c *LRU[K, V]) Len() int {
+	return c.order.Len()
+}
+
+// prune removes expired entries, oldest first, stopping at the first unexpired entry
+func (c *LRU[K, V]) prune(now time.Time) {
+	for element := c.expiry.Front(); element != nil; element = c.expiry.Front() {
+		entry := element.Value.(*lruEntry[K, V])
+		if now.Before(entry.expiresAt) {
+			return
+		}
+		c.remove(c.items[entry.key])
+	}
+}
+
+func (c *LRU[K, V]) remove(element *list.Element) {
+	entry := element.Value.(*lruEntry[K, V])
+	c.order.Remove(element)
+	c.expiry.Remove(entry.expiry)
+	delete(c.items, entry.key)
+}
+
+// pruneByOrg prunes the per-org caches' expired entries, removing empty caches so that idle orgs
+// are forgotten
+func pruneByOrg[V any](cachesByOrg map[string]*LRU[string, V], now time.Time) {
+	for orgId, cache := range cachesByOrg {
+		cache.prune(now)
+		if cache.Len() == 0 {
+			delete(cachesByOrg, orgId)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package mesh
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric names, exposed in Prometheus text format on the private port
+const (
+	MetricPrefix           = "heroku_integration_service_mesh_"
+	MetricRateLimitedTotal = MetricPrefix + "rate_limited_total"
+)
+
+// Metrics is an in-memory registry of counters and gauges.  Labels are given as
+// name, value pairs.
+type Metrics struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+}
+
+var defaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+	}
+}
+
+// GetMetrics returns the process-wide metrics registry
+func GetMetrics() *Metrics {
+	return defaultMetrics
+}
+
+func (m *Metrics) IncrCounter(name string, labels ...string) {
+	m.AddCounter(name, 1, labels...)
+}
+
+func (m *Metrics) AddCounter(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[metricKey(name, labels)] += value
+}
+
+func (m *Metrics) SetGauge(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[metricKey(name, labels)] = value
+}
+
+func (m *Metrics) AddGauge(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[metricKey(name, labels)] += value
+}
+
+// Counter returns the current value of the given counter
+func (m *Metrics) Counter(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[metricKey(name, labels)]
+}
+
+// Gauge returns the current value of the given gauge
+func (m *Metrics) Gauge(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gauges[metricKey(name, labels)]
+}
+
+// String returns all metrics in Prometheus text exposition format
+func (m *Metrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	writeMetrics(&sb, "counter", m.counters)
+	writeMetrics(&sb, "gauge", m.gauges)
+	return sb.String()
+}
+
+// MetricsHandler serves metrics in Prometheus text exposition format
+func MetricsHandler() http.HandlerFunc {
+	return func(respWriter http.ResponseWriter, req *http.Request) {
+		respWriter.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, err := fmt.Fprint(respWriter, GetMetrics().String())
+		if err != nil {
+			LogError("n/a", "Failed to write metrics: "+err.Error())
+		}
+	}
+}
+
+func writeMetrics(sb *strings.Builder, metricType string, values map[string]float64) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	lastName := ""
+	for _, key := range keys {
+		name, _, _ := strings.Cut(key, "{")
+		if name != lastName {
+			sb.WriteString("# TYPE " + name + " " + metricType + "\n")
+			lastName = name
+		}
+		sb.WriteString(key + " " + strconv.FormatFloat(values[key], 'f', -1, 64) + "\n")
+	}
+}
+
+func metricKey(name string, labels []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
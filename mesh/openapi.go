@@ -0,0 +1,234 @@
+package mesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+)
+
+const (
+	MetricOpenAPIRequestViolationsTotal  = MetricPrefix + "openapi_request_violations_total"
+	MetricOpenAPIResponseViolationsTotal = MetricPrefix + "openapi_response_violations_total"
+
+	// App responses are validated up to this size
+	openAPIMaxResponseBytes = 1 << 20
+)
+
+// OpenAPIValidator validates Salesforce requests, and optionally the app's responses, against the
+// operations declared in the app's OpenAPI 3 document
+type OpenAPIValidator struct {
+	router            routers.Router
+	validateResponses bool
+}
+
+// OpenAPIOperation is the declared operation matching a validated request
+type OpenAPIOperation struct {
+	Name  string
+	input *openapi3filter.RequestValidationInput
+}
+
+// NewOpenAPIValidator loads and validates the app's OpenAPI document.  Servers are matched by
+// path only, as the mesh forwards requests to the app's internal host.
+func NewOpenAPIValidator(config *conf.Config) (*OpenAPIValidator, error) {
+	openAPI := config.YamlConfig.Mesh.OpenAPI
+	doc, err := openapi3.NewLoader().LoadFromFile(openAPI.SpecFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+
+	doc.Servers = serverPaths(doc.Servers)
+	for _, pathItem := range doc.Paths.Map() {
+		pathItem.Servers = serverPaths(pathItem.Servers)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAPIValidator{router: router, validateResponses: openAPI.ValidateResponses}, nil
+}
+
+// ValidateRequest rejects requests to undeclared paths - 404 Not Found - and methods - 405 Method
+// Not Allowed - and requests whose parameters - 400 Bad Request - or body - 422 Unprocessable
+// Entity - violate the operation's schemas
+func (v *OpenAPIValidator) ValidateRequest(requestID string, incomingReq *http.Request, incomingReqBody []byte) (*OpenAPIOperation, error) {
+	req := incomingReq.Clone(incomingReq.Context())
+	req.Body = io.NopCloser(bytes.NewReader(incomingReqBody))
+
+	route, pathParams, err := v.router.FindRoute(req)
+	if errors.Is(err, routers.ErrMethodNotAllowed) {
+		LogWarn(requestID, "Undeclared operation "+incomingReq.Method+" "+incomingReq.URL.Path)
+		GetMetrics().IncrCounter(MetricOpenAPIRequestViolationsTotal, "operation", "", "reason", "method")
+		return nil, NewMethodNotAllowedRequest("Method not allowed")
+	}
+	if err != nil {
+		LogWarn(requestID, "Undeclared path "+incomingReq.URL.Path)
+		GetMetrics().IncrCounter(MetricOpenAPIRequestViolationsTotal, "operation", "", "reason", "path")
+		return nil, NewNotFoundRequest("Not found")
+	}
+
+	operation := &OpenAPIOperation{
+		Name: operationName(route),
+		input: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		},
+	}
+
+	err = openapi3filter.ValidateRequest(req.Context(), operation.input)
+	if err == nil {
+		return operation, nil
+	}
+
+	violations, bodyOnly := requestViolations(err)
+	reason := "parameters"
+	if bodyOnly {
+		reason = "body"
+	}
+	LogWarn(requestID, fmt.Sprintf("Request violates operation %s: %d violations", operation.Name, len(violations)))
+	GetMetrics().IncrCounter(MetricOpenAPIRequestViolationsTotal, "operation", operation.Name, "reason", reason)
+
+	if bodyOnly {
+		return operation, NewUnprocessableRequest("Request body does not match operation "+operation.Name, violations)
+	}
+
+	invalidRequest := NewMalformedRequest("Request does not match operation " + operation.Name)
+	invalidRequest.Violations = violations
+	return operation, invalidRequest
+}
+
+// ValidateResponse reports, without rejecting, app responses that violate the operation's schemas
+func (v *OpenAPIValidator) ValidateResponse(requestID string, operation *OpenAPIOperation, resp *CachedResponse) {
+	if !v.validateResponses || operation == nil || resp == nil {
+		return
+	}
+
+	err := openapi3filter.ValidateResponse(operation.input.Request.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: operation.input,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Body:                   io.NopCloser(bytes.NewReader(resp.Body)),
+		Options:                &openapi3filter.Options{MultiError: true},
+	})
+	if err != nil {
+		LogWarn(requestID, fmt.Sprintf("App response violates operation %s: %d violations", operation.Name, len(flattenErrors(err))))
+		GetMetrics().IncrCounter(MetricOpenAPIResponseViolationsTotal, "operation", operation.Name)
+	}
+}
+
+// requestViolations flattens request validation errors, returning whether only the body is invalid
+func requestViolations(err error) ([]meshErrors.Violation, bool) {
+	var violations []meshErrors.Violation
+	bodyOnly := true
+	for _, err := range flattenErrors(err) {
+		field := ""
+		var requestError *openapi3filter.RequestError
+		if errors.As(err, &requestError) && requestError.Parameter != nil {
+			field = requestError.Parameter.In + "." + requestError.Parameter.Name
+			bodyOnly = false
+		} else if requestError != nil && requestError.RequestBody != nil {
+			field = "body"
+		} else {
+			bodyOnly = false
+		}
+
+		causes := []error{err}
+		if requestError != nil && requestError.Err != nil {
+			causes = flattenErrors(requestError.Err)
+		}
+		for _, cause := range causes {
+			if len(violations) == maxPayloadViolations {
+				break
+			}
+			violations = append(violations, violation(field, cause, requestError))
+		}
+	}
+
+	return violations, bodyOnly
+}
+
+// violation describes a validation error, keyed by JSON pointer into the field when the error is a
+// schema error
+func violation(field string, err error, requestError *openapi3filter.RequestError) meshErrors.Violation {
+	var schemaError *openapi3.SchemaError
+	if errors.As(err, &schemaError) {
+		if pointer := schemaError.JSONPointer(); len(pointer) > 0 {
+			field += "/" + strings.Join(pointer, "/")
+		}
+		return meshErrors.Violation{Field: field, Message: schemaError.Reason}
+	}
+
+	if requestError != nil && requestError.Reason != "" {
+		return meshErrors.Violation{Field: field, Message: requestError.Reason}
+	}
+
+	return meshErrors.Violation{Field: field, Message: err.Error()}
+}
+
+// flattenErrors expands nested multi errors
+func flattenErrors(err error) []error {
+	multiError, ok := err.(openapi3.MultiError)
+	if !ok {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, err := range multiError {
+		errs = append(errs, flattenErrors(err)...)
+	}
+	return errs
+}
+
+// operationName returns the operation's ID or method and path
+func operationName(route *routers.Route) string {
+	if route.Operation != nil && route.Operation.OperationID != "" {
+		return route.Operation.OperationID
+	}
+
+	return route.Method + " " + route.Path
+}
+
+// serverPaths returns the servers' base paths, dropping schemes and hosts
+func serverPaths(servers openapi3.Servers) openapi3.Servers {
+	var paths openapi3.Servers
+	var seen []string
+	for _, server := range servers {
+		path := server.URL
+		if _, afterScheme, ok := strings.Cut(path, "://"); ok {
+			path = "/"
+			if i := strings.Index(afterScheme, "/"); i >= 0 {
+				path = afterScheme[i:]
+			}
+		}
+
+		if slices.Contains(seen, path) {
+			continue
+		}
+		seen = append(seen, path)
+		paths = append(paths, &openapi3.Server{URL: path, Variables: server.Variables})
+	}
+
+	return paths
+}
@@ -0,0 +1,78 @@
+package mesh
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+// OrgIDLength15 is the length of a case-sensitive Salesforce org ID.  18-character
+// org IDs append a case-insensitive checksum to the 15-character ID.
+const OrgIDLength15 = 15
+
+// GetOrgID returns the requesting org's ID - x-request-context#orgId for Salesforce
+// requests, orgId query param for Data Action Target requests
+func GetOrgID(requestHeader *RequestHeader, incomingReq *http.Request) string {
+	if requestHeader.IsSalesforceRequest {
+		return requestHeader.XRequestContext.OrgID
+	}
+
+	return incomingReq.URL.Query().Get(OrgIdQueryParam)
+}
+
+// OrgIDEquals compares 15 or 18-character org IDs
+func OrgIDEquals(orgId string, otherOrgId string) bool {
+	return NormalizeOrgID(orgId) == NormalizeOrgID(otherOrgId)
+}
+
+// NormalizeOrgID returns the 15-character form of the org ID, keying per-org state so that an
+// org's 15 and 18-character IDs share it
+func NormalizeOrgID(orgId string) string {
+	if len(orgId) >= OrgIDLength15 {
+		return orgId[:OrgIDLength15]
+	}
+
+	return orgId
+}
+
+// ContainsOrgID returns true if the given org ID is found in orgIds
+func ContainsOrgID(orgIds []string, orgId string) bool {
+	return slices.ContainsFunc(orgIds, func(id string) bool {
+		return OrgIDEquals(id, orgId)
+	})
+}
+
+// AuthorizeOrg ensures that the requesting org is not denied and, when allow lists
+// are configured, is allowed, globally and by the given route.  Deny lists take precedence.
+func AuthorizeOrg(requestID string, config *conf.Config, route *conf.Route, orgId string) error {
+	orgs := config.YamlConfig.Mesh.Orgs
+	var routeAllow, routeDeny []string
+	if route != nil {
+		routeAllow = route.OrgIDs
+		routeDeny = route.DenyOrgIDs
+	}
+
+	reason := ""
+	switch {
+	case ContainsOrgID(orgs.Deny, orgId):
+		reason = "org denied"
+	case ContainsOrgID(routeDeny, orgId):
+		reason = "org denied for route"
+	case len(orgs.Allow) > 0 && !ContainsOrgID(orgs.Allow, orgId):
+		reason = "org not allowed"
+	case len(routeAllow) > 0 && !ContainsOrgID(routeAllow, orgId):
+		reason = "org not allowed for route"
+	default:
+		return nil
+	}
+
+	LogAudit(requestID, "Org access denied",
+		slog.String("org_id", orgId),
+		slog.String("route", RoutePath(route)),
+		slog.String("reason", reason),
+	)
+
+	return NewForbiddenRequest("Org not allowed")
+}
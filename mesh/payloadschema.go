@@ -0,0 +1,121 @@
+package mesh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+const (
+	MetricPayloadValidationTotal = MetricPrefix + "payload_validation_total"
+
+	// At most this many schema violations are returned to clients
+	maxPayloadViolations = 20
+)
+
+// PayloadValidator validates Data Action Target payloads against JSON Schemas, one per apiName
+type PayloadValidator struct {
+	schemas map[string]*jsonschema.Schema
+	strict  bool
+}
+
+// NewPayloadValidator compiles the JSON Schemas, <apiName>.json, found in the configured schema directory
+func NewPayloadValidator(config *conf.Config) (*PayloadValidator, error) {
+	payloadValidation := config.YamlConfig.Mesh.PayloadValidation
+	schemaDir, err := filepath.Abs(payloadValidation.SchemaDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(schemaDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema directory: %v", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	payloadValidator := &PayloadValidator{
+		schemas: make(map[string]*jsonschema.Schema),
+		strict:  payloadValidation.Strict,
+	}
+	for _, entry := range entries {
+		apiName, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		schema, err := compiler.Compile(filepath.Join(schemaDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %v", entry.Name(), err)
+		}
+		payloadValidator.schemas[apiName] = schema
+	}
+
+	return payloadValidator, nil
+}
+
+// ValidatePayload validates the payload against the apiName's schema, rejecting invalid payloads
+// with each schema violation - 422 Unprocessable Entity
+func (pv *PayloadValidator) ValidatePayload(requestID string, apiName string, payload []byte) error {
+	schema, ok := pv.schemas[apiName]
+	if !ok {
+		if !pv.strict {
+			return nil
+		}
+
+		LogWarn(requestID, "No payload schema for Data Action Target '"+apiName+"'")
+		GetMetrics().IncrCounter(MetricPayloadValidationTotal, "schema", "", "outcome", "no-schema")
+		return NewUnprocessableRequest("No payload schema for '"+apiName+"'", nil)
+	}
+
+	var violations []meshErrors.Violation
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		violations = append(violations, meshErrors.Violation{Field: "", Message: "invalid JSON: " + err.Error()})
+	} else if err = schema.Validate(value); err != nil {
+		var validationError *jsonschema.ValidationError
+		if !errors.As(err, &validationError) {
+			return NewInternalError("Failed to validate payload", err)
+		}
+		violations = schemaViolations(validationError)
+	}
+
+	if len(violations) > 0 {
+		GetMetrics().IncrCounter(MetricPayloadValidationTotal, "schema", apiName, "outcome", "invalid")
+		LogWarn(requestID, fmt.Sprintf("Invalid Data Action Target '%s' payload: %d violations", apiName, len(violations)))
+		return NewUnprocessableRequest("Payload does not match schema for '"+apiName+"'", violations)
+	}
+
+	GetMetrics().IncrCounter(MetricPayloadValidationTotal, "schema", apiName, "outcome", "valid")
+	return nil
+}
+
+// schemaViolations flattens the validation error's leaf errors, keyed by JSON pointer into the payload
+func schemaViolations(validationError *jsonschema.ValidationError) []meshErrors.Violation {
+	var violations []meshErrors.Violation
+	for _, unit := range validationError.BasicOutput().Errors {
+		if unit.Error == nil || len(violations) == maxPayloadViolations {
+			continue
+		}
+
+		// Skip summaries of nested violations
+		switch unit.Error.Kind.(type) {
+		case *kind.Schema, *kind.Group, *kind.Reference:
+			continue
+		}
+
+		violations = append(violations, meshErrors.Violation{
+			Field:   unit.InstanceLocation,
+			Message: unit.Error.String(),
+		})
+	}
+
+	return violations
+}
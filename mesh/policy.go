@@ -0,0 +1,125 @@
+package mesh
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+// MatchRoute matches the given API path against a route pattern.
+//
+// Patterns match:
+//   - exactly, eg /accounts
+//   - with query params, eg /accounts?id=1
+//   - by prefix when the pattern ends with '*', eg /accounts*
+func MatchRoute(pattern string, apiPath string) bool {
+	if pattern == apiPath {
+		return true
+	}
+
+	if strings.HasPrefix(apiPath, pattern+"?") {
+		return true
+	}
+
+	if strings.HasSuffix(pattern, "*") && strings.HasPrefix(apiPath, pattern[0:(len(pattern)-1)]) {
+		return true
+	}
+
+	return false
+}
+
+// FindRoutePolicy returns the first route policy matching the given API path, if any
+func FindRoutePolicy(config *conf.Config, apiPath string) *conf.Route {
+	if config.YamlConfig == nil {
+		return nil
+	}
+
+	for i, route := range config.YamlConfig.Mesh.Routes {
+		if MatchRoute(route.Path, apiPath) {
+			return &config.YamlConfig.Mesh.Routes[i]
+		}
+	}
+
+	return nil
+}
+
+// RoutePath returns the route's path pattern or an empty string when no route policy matched
+func RoutePath(route *conf.Route) string {
+	if route == nil {
+		return ""
+	}
+
+	return route.Path
+}
+
+// GetRequestType determines the request type by the presence of
+// Salesforce or Data Action Target headers
+func GetRequestType(headers http.Header) string {
+	if headers.Get(HdrRequestContext) != "" || headers.Get(HdrClientContext) != "" {
+		return conf.RequestTypeSalesforce
+	}
+
+	if headers.Get(HdrSignature) != "" {
+		return conf.RequestTypeDataActionTarget
+	}
+
+	return conf.RequestTypeNone
+}
+
+// ShouldBypassRoutePolicy returns true when the route allows unauthenticated
+// requests and the request does not carry Salesforce or Data Action Target headers.
+// Requests carrying those headers are always validated and authenticated.
+func ShouldBypassRoutePolicy(route *conf.Route, headers http.Header) bool {
+	if route == nil || !slices.Contains(route.RequestTypes, conf.RequestTypeNone) {
+		return false
+	}
+
+	return GetRequestType(headers) == conf.RequestTypeNone
+}
+
+// ValidateRouteMethod ensures that the request's HTTP method is allowed by the route
+func ValidateRouteMethod(route *conf.Route, method string) error {
+	if route == nil || len(route.Methods) == 0 || slices.Contains(route.Methods, method) {
+		return nil
+	}
+
+	return NewMethodNotAllowedRequest("Method " + method + " not allowed for route " + route.Path)
+}
+
+// AuthorizeRoutePolicy ensures that the validated request is permitted by the route's
+// request types and Salesforce context type, resource and client namespace.  Org IDs are enforced
+// by AuthorizeOrg.
+func AuthorizeRoutePolicy(requestID string, route *conf.Route, requestHeader *RequestHeader) error {
+	if route == nil {
+		return nil
+	}
+
+	requestType := requestHeader.RequestType()
+	if len(route.RequestTypes) > 0 && !slices.Contains(route.RequestTypes, requestType) {
+		LogWarn(requestID, "Request type "+requestType+" not allowed for route "+route.Path)
+		return NewForbiddenRequest("Request type not allowed")
+	}
+
+	if !requestHeader.IsSalesforceRequest {
+		return nil
+	}
+
+	if len(route.ContextTypes) > 0 && !slices.Contains(route.ContextTypes, requestHeader.XRequestContext.Type) {
+		LogWarn(requestID, "Context type "+requestHeader.XRequestContext.Type+" not allowed for route "+route.Path)
+		return NewForbiddenRequest("Context type not allowed")
+	}
+
+	if len(route.Resources) > 0 && !slices.Contains(route.Resources, requestHeader.XRequestContext.Resource) {
+		LogWarn(requestID, "Resource "+requestHeader.XRequestContext.Resource+" not allowed for route "+route.Path)
+		return NewForbiddenRequest("Resource not allowed")
+	}
+
+	if len(route.Namespaces) > 0 && !slices.Contains(route.Namespaces, requestHeader.ClientContext.Namespace) {
+		LogWarn(requestID, "Namespace '"+requestHeader.ClientContext.Namespace+"' not allowed for route "+route.Path)
+		return NewForbiddenRequest("Namespace not allowed")
+	}
+
+	return nil
+}
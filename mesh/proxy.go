@@ -2,22 +2,49 @@ package mesh
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	chi "github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
 )
 
 type Routes struct {
-	transport http.RoundTripper
+	config             *conf.Config
+	transportOnce      sync.Once
+	transport          http.RoundTripper
+	upgradeTransport   http.RoundTripper
+	rateLimiter        *RateLimiter
+	concurrencyLimiter *ConcurrencyLimiter
+	replayGuard        *ReplayGuard
+	idempotencyCache   *IdempotencyCache
+	asyncDeliveryOnce  sync.Once
+	asyncDelivery      *AsyncDelivery
+	deadLetterOnce     sync.Once
+	deadLetterCapture  *DeadLetterCapture
+	tokenSignerOnce    sync.Once
+	tokenSigner        *TokenSigner
+	tokenSignerErr     error
+
+	payloadValidatorOnce sync.Once
+	payloadValidator     *PayloadValidator
+	payloadValidatorErr  error
+
+	openApiValidatorOnce sync.Once
+	openApiValidator     *OpenAPIValidator
+	openApiValidatorErr  error
 }
 
 type SalesforceAuthRequestBody struct {
@@ -37,10 +64,27 @@ type DataActionTargetAuthRequestBody struct {
 func InitializeRoutes(router chi.Router) {
 	routes := NewRoutes()
 	router.HandleFunc("/*", routes.ServiceMesh())
+
+	// Resume delivery of requests queued before a restart
+	config := conf.GetConfig()
+	if slices.ContainsFunc(config.YamlConfig.Mesh.Routes, func(route conf.Route) bool { return route.Async }) {
+		routes.getAsyncDelivery(config)
+	}
 }
 
 func NewRoutes() *Routes {
-	return &Routes{http.DefaultTransport}
+	return NewRoutesWithConfig(nil)
+}
+
+// NewRoutesWithConfig uses the given config rather than the process-wide config, eg for tests
+func NewRoutesWithConfig(config *conf.Config) *Routes {
+	return &Routes{
+		config:             config,
+		rateLimiter:        NewRateLimiter(),
+		concurrencyLimiter: NewConcurrencyLimiter(),
+		replayGuard:        NewReplayGuard(),
+		idempotencyCache:   NewIdempotencyCache(),
+	}
 }
 
 func GetForwardUrl(host string, port string, forwardApiPath *http.Request) (string, error) {
@@ -61,7 +105,7 @@ func GetForwardUrl(host string, port string, forwardApiPath *http.Request) (stri
 func (routes *Routes) ServiceMesh() http.HandlerFunc {
 	return func(incomingRespWriter http.ResponseWriter, incomingReq *http.Request) {
 		startTime := time.Now()
-		config := conf.GetConfig()
+		config := routes.getConfig()
 		apiPath := incomingReq.URL.Path
 
 		if apiPath == InfoRoute {
@@ -70,7 +114,7 @@ func (routes *Routes) ServiceMesh() http.HandlerFunc {
 			LogInfo("n/a", info)
 			_, err := fmt.Fprintf(incomingRespWriter, info)
 			if err != nil {
-				http.Error(incomingRespWriter, err.Error(), http.StatusInternalServerError)
+				LogError("n/a", "Failed to write info: "+err.Error())
 			}
 			return
 		}
@@ -86,8 +130,18 @@ func (routes *Routes) ServiceMesh() http.HandlerFunc {
 		// Log request
 		LogInfo(requestID, "Processing request to "+apiPath+"...")
 
+		// Enforce route policy HTTP methods
+		route := FindRoutePolicy(config, apiPath)
+		if err := ValidateRouteMethod(route, incomingReq.Method); err != nil {
+			incomingRespWriter.Header().Set("Allow", strings.Join(route.Methods, ", "))
+			WriteError(requestID, incomingRespWriter, incomingReq, err)
+			TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+			return
+		}
+
 		// Bypass ALL routes or incoming route?
-		shouldBypassValidationAuthentication := ShouldBypassValidationAuthentication(requestID, config, apiPath)
+		shouldBypassValidationAuthentication := ShouldBypassValidationAuthentication(requestID, config, apiPath) ||
+			ShouldBypassRoutePolicy(route, incomingReq.Header)
 		if shouldBypassValidationAuthentication {
 			LogWarn(requestID, "Bypassing validation and authentication for route "+apiPath)
 		}
@@ -95,38 +149,413 @@ func (routes *Routes) ServiceMesh() http.HandlerFunc {
 		// Get the request body from the incoming request
 		incomingReqBody, err := io.ReadAll(incomingReq.Body)
 		if err != nil {
-			LogError(requestID, "Failed to parse incoming request body: "+err.Error())
-			http.Error(incomingRespWriter, err.Error(), http.StatusBadRequest)
+			WriteError(requestID, incomingRespWriter, incomingReq, NewMalformedRequest("Failed to read request body"))
 			return
 		}
 
+		// Decompress the request body before validating and authenticating, maybe
+		if config.YamlConfig.Mesh.Compression.Requests.Enable {
+			incomingReqBody, err = DecompressRequest(requestID, config.YamlConfig.Mesh.Compression.Requests, incomingReq, incomingReqBody)
+			if err != nil {
+				WriteError(requestID, incomingRespWriter, incomingReq, err)
+				TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+				return
+			}
+		}
+
+		// Strip client-supplied mesh identity and verdict headers
+		StripIdentityHeaders(config, incomingReq.Header)
+
 		// Validate and authenticate request, maybe
+		orgId := ""
+		identity := NewIdentity()
+		idempotency := config.YamlConfig.Mesh.Idempotency
+		idempotencyKey := ""
+		var idempotentResponse *CachedResponse
+		delivered := false
+		var openApiOperation *OpenAPIOperation
 		if !shouldBypassValidationAuthentication {
+			reportOnly := IsReportOnly(config, route)
+
+			// In report-only mode, failures are audited and the request is forwarded
+			var denial error
+			denyRequest := func(err error) bool {
+				if !reportOnly {
+					WriteError(requestID, incomingRespWriter, incomingReq, err)
+					TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+					return true
+				}
+
+				if denial == nil {
+					denial = err
+				}
+				ReportWouldDeny(requestID, route, orgId, err)
+				return false
+			}
+
 			// Validate request headers
-			isValid, requestHeader := ValidateRequestHandler(requestID, incomingRespWriter, incomingReq)
-			if !isValid {
-				// Log time took to evaluate request
-				TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+			requestHeader, err := ValidateRequest(requestID, incomingReq.Header)
+			if err != nil && denyRequest(WithValidationVerbosity(config, err)) {
+				return
+			}
 
-				// Not valid, do not forward request
+			if requestHeader != nil {
+				identity.SetRequestHeader(requestHeader, incomingReq)
+
+				// Enforce route policy
+				if err := AuthorizeRoutePolicy(requestID, route, requestHeader); err != nil && denyRequest(err) {
+					return
+				}
+
+				// Enforce org allow and deny lists before authenticating with Heroku Integration
+				orgId = GetOrgID(requestHeader, incomingReq)
+				if err := AuthorizeOrg(requestID, config, route, orgId); err != nil && denyRequest(err) {
+					return
+				}
+
+				// Reject stale Data Action Target requests without a round trip to Heroku Integration
+				replayProtection := config.YamlConfig.Mesh.ReplayProtection
+				checkReplay := replayProtection.Enable && !requestHeader.IsSalesforceRequest
+				if checkReplay {
+					if err := CheckTimestamp(requestID, replayProtection, incomingReqBody, time.Now()); err != nil && denyRequest(err) {
+						return
+					}
+				}
+
+				// Authenticate request
+				err = Authenticate(requestID, config, requestHeader, incomingReq, incomingReqBody)
+				if err != nil && denyRequest(err) {
+					return
+				}
+
+				// Enforce authenticated org's rate limit, including in report-only mode.  Unauthenticated
+				// requests are not charged, so callers cannot exhaust another org's bucket.
+				if err == nil {
+					if err := routes.rateLimiter.LimitRequest(requestID, config, route, orgId, requestHeader.RequestType(), incomingRespWriter.Header()); err != nil {
+						WriteError(requestID, incomingRespWriter, incomingReq, err)
+						TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+						return
+					}
+				}
+
+				// Validate authenticated Data Action Target payloads against the apiName's schema
+				if config.YamlConfig.Mesh.PayloadValidation.Enable && !requestHeader.IsSalesforceRequest && err == nil {
+					if err := routes.validatePayload(requestID, config, incomingReq, incomingReqBody); err != nil && denyRequest(err) {
+						return
+					}
+				}
+
+				// Validate authenticated Salesforce requests against the app's OpenAPI document
+				if config.YamlConfig.Mesh.OpenAPI.Enable && requestHeader.IsSalesforceRequest && err == nil {
+					var openApiErr error
+					openApiOperation, openApiErr = routes.validateOpenAPIRequest(requestID, config, incomingReq, incomingReqBody)
+					if openApiErr != nil && denyRequest(openApiErr) {
+						return
+					}
+				}
+
+				// Reject replayed Data Action Target requests, recording authenticated requests only
+				if checkReplay && err == nil {
+					err = routes.replayGuard.CheckReplay(requestID, replayProtection, orgId, requestHeader.XSignature, incomingReqBody, time.Now())
+					if err != nil && denyRequest(err) {
+						return
+					}
+
+					// Accept redeliveries of requests the app failed to handle
+					if err == nil {
+						defer func() {
+							if !delivered {
+								routes.replayGuard.Forget(orgId, requestHeader.XSignature, incomingReqBody)
+							}
+						}()
+					}
+				}
+
+				// Reply to duplicate Data Action Target requests that are not replays with the app's cached response
+				if idempotency.Enable && !requestHeader.IsSalesforceRequest && err == nil && denial == nil {
+					idempotencyKey = IdempotencyKey(idempotency, incomingReq, incomingReqBody)
+				}
+				if idempotencyKey != "" {
+					cachedResponse, err := routes.idempotencyCache.Begin(requestID, idempotency, RoutePath(route), orgId, idempotencyKey, time.Now())
+					if err != nil {
+						WriteError(requestID, incomingRespWriter, incomingReq, err)
+						TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+						return
+					}
+
+					// The app handled the original request, so the request's replay digest is kept
+					if cachedResponse != nil {
+						delivered = true
+						WriteCachedResponse(requestID, incomingRespWriter, cachedResponse)
+						TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+						return
+					}
+
+					// Cache the app's response or, if the request fails, allow retries
+					defer func() {
+						routes.idempotencyCache.Complete(idempotency, orgId, idempotencyKey, idempotentResponse, time.Now())
+					}()
+				}
+			}
+
+			identity.AuthOutcome = meshErrors.Allow
+			if denial != nil {
+				identity.AuthOutcome = meshErrors.WouldDeny
+			}
+
+			if reportOnly {
+				SetVerdictHeaders(config, incomingReq.Header, denial)
+			}
+		}
+
+		// Forward verified identity to app.  Report-only requests that would be denied are forwarded
+		// with their verdict only.
+		SetIdentityHeaders(config, incomingReq.Header, identity)
+		if config.YamlConfig.Mesh.IdentityToken.Enable && identity.Trusted() {
+			signer, err := routes.getTokenSigner(config)
+			if err == nil {
+				err = SetIdentityToken(requestID, signer, incomingReq.Header, identity)
+			}
+			if err != nil {
+				WriteError(requestID, incomingRespWriter, incomingReq, NewInternalError("Failed to mint identity token", err))
+				return
+			}
+		}
+
+		// Splice upgraded connections, eg WebSockets, to the app, holding a concurrency slot while open
+		if IsUpgradeRequest(config.YamlConfig.Mesh.Upgrade, incomingReq) {
+			release, err := routes.concurrencyLimiter.LimitRequest(requestID, config, orgId, incomingRespWriter, incomingReq)
+			if err != nil {
+				WriteError(requestID, incomingRespWriter, incomingReq, err)
+				TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
 				return
 			}
+			defer release()
+
+			forwardApiUrl, _ := GetForwardUrl(config.YamlConfig.App.Host, config.YamlConfig.App.Port, incomingReq)
+			ProxyUpgrade(requestID, config.YamlConfig.Mesh.Upgrade, routes.getUpgradeTransport(config), RoutePath(route), forwardApiUrl, incomingRespWriter, incomingReq)
+			TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+			return
+		}
+
+		// Acknowledge async Data Action Target requests, delivering to app in the background
+		if route != nil && route.Async && identity.RequestType == conf.RequestTypeDataActionTarget {
+			if routes.enqueueAsync(requestID, config, route, orgId, identity, incomingRespWriter, incomingReq, incomingReqBody) {
+				idempotentResponse = &CachedResponse{StatusCode: http.StatusAccepted}
+				delivered = true
+			}
+			TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+			return
+		}
 
-			// Authenticate request
-			isAuthenticated := AuthenticateRequest(requestID, config, requestHeader, incomingRespWriter, incomingReq, incomingReqBody)
-			if !isAuthenticated {
-				// Log time took to evaluate request
+		forwardApiUrl, _ := GetForwardUrl(config.YamlConfig.App.Host, config.YamlConfig.App.Port, incomingReq)
+
+		// Fan out batched Data Action Target events to the app, one request per event, each within
+		// the concurrency limit
+		if IsFanOut(route) && identity.RequestType == conf.RequestTypeDataActionTarget {
+			if events, ok := SplitEvents(incomingReqBody); ok {
+				deadLetterCapture := routes.getDeadLetterCapture(config)
+				fanOutResponse := FanOut(requestID, RoutePath(route), *route.FanOut, routes.concurrencyLimiter, config.YamlConfig.Mesh.Concurrency, orgId,
+					routes.getTransport(config), forwardApiUrl, incomingReq, events,
+					func(forwardReq *http.Request, event []byte, forwardResp *http.Response, err error) {
+						deadLetterCapture.Capture(requestID, orgId, RoutePath(route), forwardReq, event, identity, forwardResp, err)
+					})
 				TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
 
-				// Not authorized, do not forward request
+				body := WriteFanOutResponse(requestID, incomingRespWriter, fanOutResponse)
+				delivered = fanOutResponse.Failed == 0
+				if idempotencyKey != "" && fanOutResponse.Failed == 0 {
+					idempotentResponse = &CachedResponse{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{HdrContentType: {"application/json"}},
+						Body:       body,
+					}
+				}
 				return
 			}
 		}
 
-		// Forward request to target API; send response to incoming request
-		forwardApiUrl, err := GetForwardUrl(config.YamlConfig.App.Host, config.YamlConfig.App.Port, incomingReq)
-		ForwardRequestReplyToIncomingRequest(startTime, requestID, forwardApiUrl, incomingRespWriter, incomingReq, incomingReqBody)
+		// Wait for capacity to forward request to app, maybe
+		release, err := routes.concurrencyLimiter.LimitRequest(requestID, config, orgId, incomingRespWriter, incomingReq)
+		if err != nil {
+			WriteError(requestID, incomingRespWriter, incomingReq, err)
+			TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+			return
+		}
+		defer release()
+
+		// Forward request to target API, adapting the concurrency limit to the app's latency to respond
+		forwardStartTime := time.Now()
+		forwardReq, forwardResp, err := forwardRequest(requestID, routes.getTransport(config), forwardApiUrl, incomingReq, incomingReqBody)
+		if forwardResp != nil {
+			routes.concurrencyLimiter.ObserveLatency(config.YamlConfig.Mesh.Concurrency, time.Since(forwardStartTime), time.Now())
+		}
+		TimeTrack(requestID, startTime, "Heroku Integration Service Mesh")
+
+		// Capture Data Action Target requests the app failed to handle for replay, maybe, see dlq command
+		if forwardReq != nil && identity.RequestType == conf.RequestTypeDataActionTarget {
+			routes.getDeadLetterCapture(config).Capture(requestID, orgId, RoutePath(route), forwardReq, incomingReqBody, identity,
+				forwardResp, errors.Unwrap(err))
+		}
+
+		if err != nil {
+			WriteError(requestID, incomingRespWriter, incomingReq, err)
+			return
+		}
+
+		delivered = !IsRetryableStatus(forwardResp.StatusCode)
+
+		// Send response to incoming request, capturing successful responses to idempotent requests
+		var capture *ResponseCapture
+		if idempotencyKey != "" && !IsRetryableStatus(forwardResp.StatusCode) {
+			capture = CaptureResponse(forwardResp, idempotency.MaxResponseBytes)
+		}
+
+		// Capture responses to validated Salesforce requests, reporting contract drift
+		var openApiCapture *ResponseCapture
+		if openApiOperation != nil && config.YamlConfig.Mesh.OpenAPI.ValidateResponses {
+			openApiCapture = CaptureResponse(forwardResp, openAPIMaxResponseBytes)
+		}
+
+		// Stream event streams to the client or compress the app's response for the client, maybe
+		if IsStreamingResponse(config.YamlConfig.Mesh.Streaming, forwardResp) {
+			StreamToIncomingRequest(requestID, forwardResp, incomingRespWriter)
+		} else {
+			forwardResp = CompressResponse(requestID, config.YamlConfig.Mesh.Compression.Responses, incomingReq, forwardResp)
+			ReplyToIncomingRequest(requestID, forwardResp, incomingRespWriter)
+		}
+		if capture != nil {
+			idempotentResponse = capture.Response()
+		}
+		if openApiCapture != nil {
+			routes.openApiValidator.ValidateResponse(requestID, openApiOperation, openApiCapture.Response())
+		}
+	}
+}
+
+func (routes *Routes) getConfig() *conf.Config {
+	if routes.config != nil {
+		return routes.config
+	}
+
+	return conf.GetConfig()
+}
+
+func (routes *Routes) getAsyncDelivery(config *conf.Config) *AsyncDelivery {
+	routes.asyncDeliveryOnce.Do(func() {
+		routes.asyncDelivery = NewAsyncDelivery(config, routes.getTransport(config), routes.concurrencyLimiter, routes.getTokenSigner)
+		go routes.asyncDelivery.Run(context.Background())
+	})
+
+	return routes.asyncDelivery
+}
+
+// getDeadLetterCapture returns the capture of requests the app failed to handle or, when not
+// enabled, nil
+func (routes *Routes) getDeadLetterCapture(config *conf.Config) *DeadLetterCapture {
+	if !config.YamlConfig.Mesh.AsyncDelivery.CaptureFailed {
+		return nil
+	}
+
+	routes.deadLetterOnce.Do(func() {
+		routes.deadLetterCapture = NewDeadLetterCapture(config.YamlConfig.Mesh.AsyncDelivery)
+		go routes.deadLetterCapture.Run(context.Background())
+	})
+
+	return routes.deadLetterCapture
+}
+
+// FlushDeadLetters waits until requests captured as dead letters are written, see
+// DeadLetterCapture.Flush
+func (routes *Routes) FlushDeadLetters() {
+	routes.deadLetterCapture.Flush()
+}
+
+// enqueueAsync persists the request forwarded to the app for async delivery and replies 202 Accepted,
+// returning whether the request was queued
+func (routes *Routes) enqueueAsync(
+	requestID string,
+	config *conf.Config,
+	route *conf.Route,
+	orgId string,
+	identity *Identity,
+	incomingRespWriter http.ResponseWriter,
+	incomingReq *http.Request,
+	incomingReqBody []byte) bool {
+
+	forwardApiUrl, _ := GetForwardUrl(config.YamlConfig.App.Host, config.YamlConfig.App.Port, incomingReq)
+	forwardReq, err := NewForwardRequest(forwardApiUrl, incomingReq, incomingReqBody)
+	if err == nil {
+		storedRequest := NewStoredRequest(requestID, orgId, RoutePath(route), forwardReq, incomingReqBody, identity)
+		err = routes.getAsyncDelivery(config).Enqueue(storedRequest)
+	}
+	if errors.Is(err, ErrAsyncQueueFull) {
+		LogWarn(requestID, "Shedding async request for org "+orgId+": "+err.Error())
+		retryAfter := int(math.Ceil(config.YamlConfig.Mesh.AsyncDelivery.InitialBackoff.Seconds()))
+		incomingRespWriter.Header().Set(HdrRetryAfter, strconv.Itoa(max(1, retryAfter)))
+		WriteError(requestID, incomingRespWriter, incomingReq, NewServiceUnavailable("Async delivery queue full"))
+		return false
+	}
+	if err != nil {
+		WriteError(requestID, incomingRespWriter, incomingReq, NewInternalError("Failed to queue request", err))
+		return false
+	}
+
+	incomingRespWriter.WriteHeader(http.StatusAccepted)
+	return true
+}
+
+// getTransport returns the transport forwarding requests to the app, see NewAppTransport
+func (routes *Routes) getTransport(config *conf.Config) http.RoundTripper {
+	routes.transportOnce.Do(func() {
+		routes.transport = NewAppTransport(config)
+		routes.upgradeTransport = NewAppUpgradeTransport()
+	})
+
+	return routes.transport
+}
+
+// getUpgradeTransport returns the transport forwarding upgrade requests to the app, see
+// NewAppUpgradeTransport
+func (routes *Routes) getUpgradeTransport(config *conf.Config) http.RoundTripper {
+	routes.getTransport(config)
+	return routes.upgradeTransport
+}
+
+func (routes *Routes) getTokenSigner(config *conf.Config) (*TokenSigner, error) {
+	routes.tokenSignerOnce.Do(func() {
+		routes.tokenSigner, routes.tokenSignerErr = NewTokenSigner(config)
+	})
+
+	return routes.tokenSigner, routes.tokenSignerErr
+}
+
+// validatePayload validates the Data Action Target request's payload, see PayloadValidator
+func (routes *Routes) validatePayload(requestID string, config *conf.Config, incomingReq *http.Request, incomingReqBody []byte) error {
+	routes.payloadValidatorOnce.Do(func() {
+		routes.payloadValidator, routes.payloadValidatorErr = NewPayloadValidator(config)
+	})
+
+	if routes.payloadValidatorErr != nil {
+		return NewInternalError("Failed to load payload schemas", routes.payloadValidatorErr)
+	}
+
+	apiName := incomingReq.URL.Query().Get(ApiNameQueryParam)
+	return routes.payloadValidator.ValidatePayload(requestID, apiName, incomingReqBody)
+}
+
+// validateOpenAPIRequest validates the Salesforce request against the app's OpenAPI document, see
+// OpenAPIValidator
+func (routes *Routes) validateOpenAPIRequest(requestID string, config *conf.Config, incomingReq *http.Request, incomingReqBody []byte) (*OpenAPIOperation, error) {
+	routes.openApiValidatorOnce.Do(func() {
+		routes.openApiValidator, routes.openApiValidatorErr = NewOpenAPIValidator(config)
+	})
+
+	if routes.openApiValidatorErr != nil {
+		return nil, NewInternalError("Failed to load OpenAPI document", routes.openApiValidatorErr)
 	}
+
+	return routes.openApiValidator.ValidateRequest(requestID, incomingReq, incomingReqBody)
 }
 
 func ShouldBypassValidationAuthentication(requestID string, config *conf.Config, apiPath string) bool {
@@ -136,20 +565,10 @@ func ShouldBypassValidationAuthentication(requestID string, config *conf.Config,
 	}
 
 	yamlConfig := config.YamlConfig
-	if len(yamlConfig.Mesh.Authentication.BypassRoutes) > 0 {
-		if slices.Contains(yamlConfig.Mesh.Authentication.BypassRoutes, apiPath) {
+	for _, value := range yamlConfig.Mesh.Authentication.BypassRoutes {
+		if MatchRoute(value, apiPath) {
 			return true
 		}
-
-		for _, value := range yamlConfig.Mesh.Authentication.BypassRoutes {
-			if strings.HasPrefix(apiPath, value+"?") {
-				return true
-			}
-
-			if strings.HasSuffix(value, "*") && strings.HasPrefix(apiPath, value[0:(len(value)-1)]) {
-				return true
-			}
-		}
 	}
 
 	if yamlConfig.Mesh.HealthCheck.Enable == "true" && apiPath == yamlConfig.Mesh.HealthCheck.Route {
@@ -163,21 +582,20 @@ func ShouldBypassValidationAuthentication(requestID string, config *conf.Config,
 func ValidateRequestHandler(requestID string, incomingRespWriter http.ResponseWriter, incomingReq *http.Request) (bool, *RequestHeader) {
 	requestHeader, err := ValidateRequest(requestID, incomingReq.Header)
 	if err != nil {
-		httpStatusCode := http.StatusUnauthorized
-		switch err.(type) {
-		case *InvalidRequest:
-			httpStatusCode = err.(*InvalidRequest).HttpStatusCode()
-		default:
-		}
-		LogError(requestID, err.Error())
-		http.Error(incomingRespWriter, err.Error(), httpStatusCode)
+		WriteError(requestID, incomingRespWriter, incomingReq, err)
 		return false, nil
 	}
 
 	return true, requestHeader
 }
 
-// AuthenticateRequest Authenticate request based on request type - Salesforce or Data Action Target
+// HandleInvalidRequest Log and reply to an invalid request, see WriteError
+func HandleInvalidRequest(requestID string, incomingRespWriter http.ResponseWriter, err error) {
+	WriteError(requestID, incomingRespWriter, nil, err)
+}
+
+// AuthenticateRequest Authenticate request based on request type - Salesforce or Data Action Target,
+// replying to the incoming request when not authenticated
 func AuthenticateRequest(
 	requestID string,
 	config *conf.Config,
@@ -186,6 +604,23 @@ func AuthenticateRequest(
 	incomingReq *http.Request,
 	incomingReqBody []byte) bool {
 
+	err := Authenticate(requestID, config, requestHeader, incomingReq, incomingReqBody)
+	if err != nil {
+		WriteError(requestID, incomingRespWriter, incomingReq, err)
+		return false
+	}
+
+	return true
+}
+
+// Authenticate Authenticate request based on request type - Salesforce or Data Action Target
+func Authenticate(
+	requestID string,
+	config *conf.Config,
+	requestHeader *RequestHeader,
+	incomingReq *http.Request,
+	incomingReqBody []byte) error {
+
 	var orgId string
 	var authResponseStatus int
 	var authResponseBody string
@@ -207,11 +642,18 @@ func AuthenticateRequest(
 		// FIXME: Remove when no longer needed
 		LogDebug(requestID, "!! REMOVEME !! Auth: "+requestHeader.XRequestContext.Auth)
 
+		// Reject obviously invalid tokens without a round trip to Heroku Integration
+		if config.YamlConfig != nil && config.YamlConfig.Mesh.Authentication.CoreJWTPreValidation.Enable {
+			preValidation := config.YamlConfig.Mesh.Authentication.CoreJWTPreValidation
+			if err := PreValidateCoreJWT(requestID, preValidation, &requestHeader.XRequestContext, time.Now()); err != nil {
+				return err
+			}
+		}
+
 		authResponseStatus, authResponseBody, err = InvokeSalesforceAuth(requestID, config, authRequestBody)
 		if err != nil {
 			LogError(requestID, "Failed to authenticate Salesforce request: "+err.Error())
-			http.Error(incomingRespWriter, err.Error(), authResponseStatus)
-			return false
+			return NewUpstreamAuthFailure(err)
 		}
 	} else {
 		// Found Data Action Target request
@@ -235,8 +677,7 @@ func AuthenticateRequest(
 		authResponseStatus, authResponseBody, err = InvokeDataTargetActionAuth(requestID, config, dataActionTargetAuthRequestBody)
 		if err != nil {
 			LogError(requestID, "Failed to authenticate Data Action Target request: "+err.Error())
-			http.Error(incomingRespWriter, err.Error(), authResponseStatus)
-			return false
+			return NewUpstreamAuthFailure(err)
 		}
 	}
 
@@ -245,22 +686,17 @@ func AuthenticateRequest(
 		if authResponseStatus == http.StatusUnauthorized || authResponseStatus == http.StatusForbidden {
 			LogWarn(requestID, "Unauthorized request! "+unauthorizedMsg)
 			// Unauthenticated requests that appear to be valid are 403 Forbidden
-			http.Error(incomingRespWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-			incomingRespWriter.WriteHeader(authResponseStatus)
-		} else {
-			// Unexpected error
-			LogError(requestID, "Failed to authenticate request: statusCode "+strconv.Itoa(authResponseStatus)+", body '"+authResponseBody+"'")
-			http.Error(incomingRespWriter, authResponseBody, authResponseStatus)
-			incomingRespWriter.WriteHeader(authResponseStatus)
+			return NewForbiddenRequest(http.StatusText(http.StatusForbidden))
 		}
 
-		// Do NOT forward
-		return false
+		// Unexpected error
+		LogError(requestID, "Failed to authenticate request: statusCode "+strconv.Itoa(authResponseStatus)+", body '"+authResponseBody+"'")
+		return NewUpstreamAuthFailure(fmt.Errorf("statusCode %d, body '%s'", authResponseStatus, authResponseBody))
 	}
 
 	// Successful authentication!
 	LogInfo(requestID, "Authenticated request!")
-	return true
+	return nil
 }
 
 // InvokeSalesforceAuth Authenticate Salesforce request
@@ -372,51 +808,52 @@ func ForwardRequest(
 	incomingReq *http.Request,
 	incomingReqBody []byte) *http.Response {
 
-	// Forward request to target API
-
-	LogInfo(requestID, "Forwarding request...")
-	forwardReq, err := http.NewRequest(incomingReq.Method, forwardApiUrl, bytes.NewReader(incomingReqBody))
+	_, forwardResp, err := forwardRequest(requestID, http.DefaultTransport, forwardApiUrl, incomingReq, incomingReqBody)
 	if err != nil {
-		LogError(requestID, "Failed to forward request: "+err.Error())
-		http.Error(incomingRespWriter, err.Error(), http.StatusInternalServerError)
+		WriteError(requestID, incomingRespWriter, incomingReq, err)
 	}
 
-	// Apply request headers to forward request
-	for header, values := range incomingReq.Header {
-		for _, value := range values {
-			// Exclude x-request-context header
-			if strings.EqualFold(header, HdrRequestContext) {
-				continue
-			}
-			forwardReq.Header.Set(header, value)
-		}
+	return forwardResp
+}
+
+// forwardRequest Forward request to target API, returning the forwarded request, if built, and
+// the app's response
+func forwardRequest(
+	requestID string,
+	transport http.RoundTripper,
+	forwardApiUrl string,
+	incomingReq *http.Request,
+	incomingReqBody []byte) (*http.Request, *http.Response, error) {
+
+	LogInfo(requestID, "Forwarding request...")
+	forwardReq, err := NewForwardRequest(forwardApiUrl, incomingReq, incomingReqBody)
+	if err != nil {
+		return nil, nil, NewInternalError("Failed to build forward request", err)
 	}
 
 	// Forward request
-	client := &http.Client{}
+	client := &http.Client{Transport: transport}
 	forwardResp, err := client.Do(forwardReq)
 	if err != nil {
-		LogError(requestID, "Failed to forward request: "+err.Error())
-		http.Error(incomingRespWriter, "Failed to forward request "+requestID, http.StatusBadGateway)
+		return forwardReq, nil, NewAppUnavailable(err)
 	}
 
-	return forwardResp
+	return forwardReq, forwardResp, nil
 }
 
 // ReplyToIncomingRequest Send API response to incoming response
 func ReplyToIncomingRequest(requestID string, forwardResp *http.Response, incomingRespWriter http.ResponseWriter) {
+	defer forwardResp.Body.Close()
+
 	// Copy forwarded request's response headers to incoming response
-	for header, values := range forwardResp.Header {
-		for _, value := range values {
-			incomingRespWriter.Header().Add(header, value)
-		}
-	}
+	writeResponseHeader(forwardResp, incomingRespWriter)
 
 	// Copy forward request's response to incoming response
-	incomingRespWriter.WriteHeader(forwardResp.StatusCode)
 	_, err := io.Copy(incomingRespWriter, forwardResp.Body)
 	if err != nil {
 		LogError(requestID, err.Error())
+		return
 	}
-	defer forwardResp.Body.Close()
+
+	writeResponseTrailer(forwardResp, incomingRespWriter)
 }
@@ -0,0 +1,172 @@
+package mesh
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	HdrRateLimitLimit     = "RateLimit-Limit"
+	HdrRateLimitRemaining = "RateLimit-Remaining"
+	HdrRateLimitReset     = "RateLimit-Reset"
+	HdrRetryAfter         = "Retry-After"
+
+	// Idle, full buckets are pruned at this interval
+	rateLimitPruneInterval = time.Minute
+)
+
+// RateLimiter is an in-memory, per-dyno token bucket rate limiter
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+	rateLimit  conf.RateLimit
+}
+
+// RateLimitResult is the outcome of a rate limited request
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// GetRateLimit returns the route's rate limit, if set, otherwise the global rate limit
+func GetRateLimit(config *conf.Config, route *conf.Route) conf.RateLimit {
+	if route != nil && route.RateLimit != nil {
+		return *route.RateLimit
+	}
+
+	return config.YamlConfig.Mesh.RateLimit
+}
+
+// RateLimitKey builds the bucket key from the 15-character org ID and, when configured, route and
+// request type
+func RateLimitKey(rateLimit conf.RateLimit, orgId string, route *conf.Route, requestType string) string {
+	key := NormalizeOrgID(orgId)
+	if slices.Contains(rateLimit.KeyBy, conf.RateLimitKeyRoute) && route != nil {
+		key += "|" + route.Path
+	}
+
+	if slices.Contains(rateLimit.KeyBy, conf.RateLimitKeyRequestType) {
+		key += "|" + requestType
+	}
+
+	return key
+}
+
+// Allow takes a token from the given key's bucket, if available
+func (rl *RateLimiter) Allow(key string, rateLimit conf.RateLimit, now time.Time) RateLimitResult {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.prune(now)
+
+	burst := float64(rateLimit.Burst)
+	bucket, ok := rl.buckets[key]
+	if !ok || bucket.rateLimit.Burst != rateLimit.Burst || bucket.rateLimit.RequestsPerSecond != rateLimit.RequestsPerSecond {
+		bucket = &tokenBucket{tokens: burst, lastRefill: now, rateLimit: rateLimit}
+		rl.buckets[key] = bucket
+	}
+
+	bucket.refill(now)
+
+	result := RateLimitResult{Limit: rateLimit.Burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsUntil(1-bucket.tokens, rateLimit.RequestsPerSecond)
+	}
+
+	result.Remaining = int(bucket.tokens)
+	result.Reset = secondsUntil(burst-bucket.tokens, rateLimit.RequestsPerSecond)
+
+	return result
+}
+
+// LimitRequest applies the route's or global rate limit to the given authenticated org's request,
+// setting rate limit response headers
+func (rl *RateLimiter) LimitRequest(
+	requestID string,
+	config *conf.Config,
+	route *conf.Route,
+	orgId string,
+	requestType string,
+	headers http.Header) error {
+
+	rateLimit := GetRateLimit(config, route)
+	if !rateLimit.Enable {
+		return nil
+	}
+
+	result := rl.Allow(RateLimitKey(rateLimit, orgId, route, requestType), rateLimit, time.Now())
+	result.SetHeaders(headers)
+	if result.Allowed {
+		return nil
+	}
+
+	GetMetrics().IncrCounter(MetricRateLimitedTotal, "route", RoutePath(route), "request_type", requestType)
+	LogWarn(requestID, "Rate limit exceeded for org "+orgId+", retry after "+result.RetryAfter.String())
+	return NewTooManyRequests("Rate limit exceeded")
+}
+
+// SetHeaders sets RateLimit-* and, when limited, Retry-After response headers
+func (result RateLimitResult) SetHeaders(headers http.Header) {
+	headers.Set(HdrRateLimitLimit, strconv.Itoa(result.Limit))
+	headers.Set(HdrRateLimitRemaining, strconv.Itoa(result.Remaining))
+	headers.Set(HdrRateLimitReset, strconv.Itoa(int(result.Reset.Seconds())))
+	if !result.Allowed {
+		headers.Set(HdrRetryAfter, strconv.Itoa(int(result.RetryAfter.Seconds())))
+	}
+}
+
+func (bucket *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(bucket.rateLimit.Burst), bucket.tokens+elapsed*bucket.rateLimit.RequestsPerSecond)
+		bucket.lastRefill = now
+	}
+}
+
+// prune removes buckets that have refilled, which are equivalent to new buckets
+func (rl *RateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	rl.lastPrune = now
+
+	for key, bucket := range rl.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.rateLimit.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// secondsUntil returns the whole seconds until the given tokens are available
+func secondsUntil(tokens float64, requestsPerSecond float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+
+	return time.Duration(math.Ceil(tokens/requestsPerSecond)) * time.Second
+}
@@ -0,0 +1,149 @@
+package mesh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const MetricReplayRejectedTotal = MetricPrefix + "replay_rejected_total"
+
+// ReplayGuard remembers, per org, the digests of Data Action Target requests seen within the
+// replay protection window
+type ReplayGuard struct {
+	mu        sync.Mutex
+	seenByOrg map[string]*LRU[string, struct{}]
+	lastPrune time.Time
+}
+
+func NewReplayGuard() *ReplayGuard {
+	return &ReplayGuard{
+		seenByOrg: make(map[string]*LRU[string, struct{}]),
+	}
+}
+
+// CheckTimestamp rejects requests whose payload timestamp, at the configured JSON path, is older
+// than the max age or in the future - 401 Unauthorized.  Timestamps are RFC 3339 strings or
+// Unix epoch seconds or milliseconds.
+func CheckTimestamp(requestID string, replayProtection conf.ReplayProtection, payload []byte, now time.Time) error {
+	if replayProtection.TimestampPath == "" {
+		return nil
+	}
+
+	value, ok := LookupJSONBodyPath(payload, replayProtection.TimestampPath)
+	if !ok {
+		LogWarn(requestID, "Payload timestamp "+replayProtection.TimestampPath+" not found")
+		return NewUnauthenticatedRequest("Missing payload timestamp")
+	}
+
+	timestamp, ok := parseTimestamp(value)
+	if !ok {
+		LogWarn(requestID, "Invalid payload timestamp "+replayProtection.TimestampPath)
+		return NewUnauthenticatedRequest("Invalid payload timestamp")
+	}
+
+	if age := now.Sub(timestamp); age > replayProtection.MaxAge || age < -replayProtection.MaxAge {
+		LogWarn(requestID, "Stale payload timestamp "+timestamp.Format(time.RFC3339)+", age "+age.String())
+		GetMetrics().IncrCounter(MetricReplayRejectedTotal, "reason", "stale")
+		return NewUnauthenticatedRequest("Stale payload timestamp")
+	}
+
+	return nil
+}
+
+// CheckReplay records the org's request, rejecting requests with the same signature and payload
+// seen within the replay protection window - 409 Conflict.  Requests the app fails to handle
+// should be forgotten, see Forget, so that redeliveries are accepted.  Orgs are keyed by their
+// 15-character ID, see NormalizeOrgID.
+func (rg *ReplayGuard) CheckReplay(
+	requestID string,
+	replayProtection conf.ReplayProtection,
+	orgId string,
+	signature string,
+	payload []byte,
+	now time.Time) error {
+
+	key := replayKey(signature, payload)
+
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	if now.Sub(rg.lastPrune) >= orgCachePruneInterval {
+		rg.lastPrune = now
+		pruneByOrg(rg.seenByOrg, now)
+	}
+
+	seen, ok := rg.seenByOrg[NormalizeOrgID(orgId)]
+	if !ok {
+		seen = NewLRU[string, struct{}](replayProtection.MaxEntries, replayProtection.Window)
+		rg.seenByOrg[NormalizeOrgID(orgId)] = seen
+	}
+
+	if _, replayed := seen.Get(key, now); replayed {
+		LogWarn(requestID, "Replayed Data Action Target request for org "+orgId)
+		GetMetrics().IncrCounter(MetricReplayRejectedTotal, "reason", "replay")
+		return NewReplayedRequest("Request already received")
+	}
+
+	seen.Add(key, struct{}{}, now)
+	return nil
+}
+
+// Forget forgets the org's request, recorded by CheckReplay, so that it may be redelivered
+func (rg *ReplayGuard) Forget(orgId string, signature string, payload []byte) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	seen, ok := rg.seenByOrg[NormalizeOrgID(orgId)]
+	if !ok {
+		return
+	}
+
+	seen.Remove(replayKey(signature, payload))
+	if seen.Len() == 0 {
+		delete(rg.seenByOrg, NormalizeOrgID(orgId))
+	}
+}
+
+// replayKey returns the digest of the request's signature and payload
+func replayKey(signature string, payload []byte) string {
+	digest := sha256.New()
+	digest.Write([]byte(signature))
+	digest.Write([]byte{0})
+	digest.Write(payload)
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+func parseTimestamp(value any) (time.Time, bool) {
+	switch timestamp := value.(type) {
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			return parsed, true
+		}
+		if epoch, err := strconv.ParseFloat(timestamp, 64); err == nil {
+			return epochTime(epoch), true
+		}
+	case json.Number:
+		if epoch, err := timestamp.Float64(); err == nil {
+			return epochTime(epoch), true
+		}
+	case float64:
+		return epochTime(timestamp), true
+	}
+
+	return time.Time{}, false
+}
+
+// epochTime returns the time of Unix epoch seconds or, for values too large to be seconds, milliseconds
+func epochTime(epoch float64) time.Time {
+	if epoch > 1e12 {
+		return time.UnixMilli(int64(epoch))
+	}
+
+	return unixTime(epoch)
+}
@@ -0,0 +1,87 @@
+package mesh
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+)
+
+const (
+	HdrMeshVerdict       = conf.IdentityHeaderAuthOutcome
+	HdrMeshVerdictReason = "x-heroku-integration-mesh-verdict-reason"
+
+	MetricWouldDenyTotal = MetricPrefix + "would_deny_total"
+)
+
+// IsReportOnly returns the route's report-only mode, if set, otherwise the global mode
+func IsReportOnly(config *conf.Config, route *conf.Route) bool {
+	if route != nil && route.ReportOnly != nil {
+		return *route.ReportOnly
+	}
+
+	return config.YamlConfig.Mesh.Authentication.ReportOnly
+}
+
+// ReportWouldDeny audits a request that would be denied if enforced
+func ReportWouldDeny(requestID string, route *conf.Route, orgId string, err error) {
+	kind := meshErrors.Internal
+	statusCode := http.StatusInternalServerError
+	var serverError *meshErrors.ServerError
+	if errors.As(err, &serverError) {
+		kind = serverError.Kind
+		statusCode = serverError.HttpStatusCode()
+	}
+
+	GetMetrics().IncrCounter(MetricWouldDenyTotal, "route", RoutePath(route), "kind", kind.String(), "status", strconv.Itoa(statusCode))
+	LogAudit(requestID, "Would deny request",
+		slog.String("verdict", meshErrors.WouldDeny.String()),
+		slog.String("org_id", orgId),
+		slog.String("route", RoutePath(route)),
+		slog.String("kind", kind.String()),
+		slog.Int("status", statusCode),
+		slog.String("reason", err.Error()),
+	)
+}
+
+// SetVerdictHeaders sets the report-only verdict on the request forwarded to the app
+func SetVerdictHeaders(config *conf.Config, headers http.Header, denial error) {
+	verdictHeader := config.YamlConfig.Mesh.IdentityHeaders.AuthOutcome
+	if verdictHeader == "" {
+		verdictHeader = HdrMeshVerdict
+	}
+
+	if denial == nil {
+		headers.Set(verdictHeader, meshErrors.Allow.String())
+		return
+	}
+
+	headers.Set(verdictHeader, meshErrors.WouldDeny.String())
+	headers.Set(HdrMeshVerdictReason, VerdictReason(denial))
+}
+
+// VerdictReason returns the denial's kind and client-safe detail, omitting internal causes, eg the
+// Heroku Integration service's response, and control characters that are invalid in headers
+func VerdictReason(denial error) string {
+	var serverError *meshErrors.ServerError
+	if !errors.As(denial, &serverError) {
+		return meshErrors.Internal.String()
+	}
+
+	reason := serverError.Kind.String()
+	if detail := serverError.Detail(); detail != "" {
+		reason += ": " + detail
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, reason)
+}
@@ -0,0 +1,79 @@
+package mesh
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+)
+
+const (
+	HdrAccept      = "Accept"
+	HdrContentType = "Content-Type"
+
+	MetricErrorsTotal = MetricPrefix + "errors_total"
+)
+
+// WriteError logs and replies to the incoming request with the error as problem details, see
+// WriteProblem.  Errors other than ServerError are replied to as internal errors.
+func WriteError(requestID string, incomingRespWriter http.ResponseWriter, incomingReq *http.Request, err error) {
+	var serverError *meshErrors.ServerError
+	if !errors.As(err, &serverError) {
+		serverError = NewInternalError("", err)
+	}
+
+	status := serverError.HttpStatusCode()
+	GetMetrics().IncrCounter(MetricErrorsTotal, "kind", serverError.Kind.String(), "status", strconv.Itoa(status))
+	LogError(requestID, serverError.Error(), slog.Any("error", serverError))
+	WriteProblem(incomingRespWriter, incomingReq, meshErrors.NewProblem(serverError, requestID))
+}
+
+// WriteProblem replies with an RFC 7807 application/problem+json body or, for clients that do not
+// accept JSON, a text/plain body containing the problem's detail
+func WriteProblem(incomingRespWriter http.ResponseWriter, incomingReq *http.Request, problem *meshErrors.Problem) {
+	headers := incomingRespWriter.Header()
+	headers.Del("Content-Length")
+	headers.Set("X-Content-Type-Options", "nosniff")
+
+	if incomingReq != nil && !AcceptsJSON(incomingReq.Header) {
+		headers.Set(HdrContentType, "text/plain; charset=utf-8")
+		incomingRespWriter.WriteHeader(problem.Status)
+		_, _ = incomingRespWriter.Write([]byte(problem.Detail + "\n"))
+		return
+	}
+
+	headers.Set(HdrContentType, meshErrors.ContentTypeProblemJSON)
+	incomingRespWriter.WriteHeader(problem.Status)
+	if err := json.NewEncoder(incomingRespWriter).Encode(problem); err != nil {
+		LogError(problem.RequestID, "Failed to write problem: "+err.Error())
+	}
+}
+
+// AcceptsJSON returns true if the Accept header is absent or accepts problem+json or JSON
+func AcceptsJSON(headers http.Header) bool {
+	accepts := headers.Values(HdrAccept)
+	if len(accepts) == 0 {
+		return true
+	}
+
+	for _, accept := range accepts {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil || params["q"] == "0" {
+				continue
+			}
+
+			switch mediaType {
+			case meshErrors.ContentTypeProblemJSON, "application/json", "application/*", "*/*":
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	ContentTypeEventStream = "text/event-stream"
+
+	MetricStreamedResponsesTotal = MetricPrefix + "streamed_responses_total"
+)
+
+// IsStreamingResponse returns whether the app's response is an event stream or has one of the
+// configured streaming content types
+func IsStreamingResponse(streaming conf.Streaming, forwardResp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(forwardResp.Header.Get(HdrContentType))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == ContentTypeEventStream || MatchesContentType(streaming.ContentTypes, mediaType)
+}
+
+// StreamToIncomingRequest Send API response to incoming response, flushing each chunk as it is
+// received from the app.  Streams end when the app completes the response or the client disconnects.
+func StreamToIncomingRequest(requestID string, forwardResp *http.Response, incomingRespWriter http.ResponseWriter) {
+	defer forwardResp.Body.Close()
+
+	responseController := http.NewResponseController(incomingRespWriter)
+	writeResponseHeader(forwardResp, incomingRespWriter)
+	if err := responseController.Flush(); err != nil {
+		LogWarn(requestID, "Unable to flush streaming response: "+err.Error())
+	}
+
+	_, err := io.Copy(&flushWriter{writer: incomingRespWriter, responseController: responseController}, forwardResp.Body)
+	switch {
+	case err == nil:
+		writeResponseTrailer(forwardResp, incomingRespWriter)
+		GetMetrics().IncrCounter(MetricStreamedResponsesTotal, "outcome", "completed")
+	case errors.Is(err, context.Canceled):
+		LogInfo(requestID, "Client disconnected from streaming response")
+		GetMetrics().IncrCounter(MetricStreamedResponsesTotal, "outcome", "client-disconnected")
+	default:
+		LogError(requestID, "Failed to stream response: "+err.Error())
+		GetMetrics().IncrCounter(MetricStreamedResponsesTotal, "outcome", "failed")
+	}
+}
+
+// writeResponseHeader copies the app's response headers, announcing its trailers, and status to
+// the incoming response
+func writeResponseHeader(forwardResp *http.Response, incomingRespWriter http.ResponseWriter) {
+	RemoveHopByHopHeaders(forwardResp.Header)
+	CopyHeaders(incomingRespWriter.Header(), forwardResp.Header)
+	for trailer := range forwardResp.Trailer {
+		incomingRespWriter.Header().Add("Trailer", trailer)
+	}
+
+	incomingRespWriter.WriteHeader(forwardResp.StatusCode)
+}
+
+// writeResponseTrailer copies the app's response trailers, received with the end of its body, to
+// the incoming response
+func writeResponseTrailer(forwardResp *http.Response, incomingRespWriter http.ResponseWriter) {
+	for trailer, values := range forwardResp.Trailer {
+		for _, value := range values {
+			incomingRespWriter.Header().Add(http.TrailerPrefix+trailer, value)
+		}
+	}
+}
+
+// flushWriter flushes each write to the client
+type flushWriter struct {
+	writer             io.Writer
+	responseController *http.ResponseController
+}
+
+func (flushWriter *flushWriter) Write(p []byte) (int, error) {
+	n, err := flushWriter.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if err := flushWriter.responseController.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,218 @@
+package mesh
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const JWKSRoute = "/.well-known/jwks.json"
+
+// IdentityClaims are the identity token's JWT claims
+type IdentityClaims struct {
+	Issuer       string `json:"iss"`
+	Subject      string `json:"sub,omitempty"`
+	IssuedAt     int64  `json:"iat"`
+	NotBefore    int64  `json:"nbf"`
+	ExpiresAt    int64  `json:"exp"`
+	RequestID    string `json:"jti"`
+	OrgID        string `json:"orgId,omitempty"`
+	OrgDomainUrl string `json:"orgDomainUrl,omitempty"`
+	AppUUID      string `json:"appUuid,omitempty"`
+	ContextType  string `json:"type,omitempty"`
+	Resource     string `json:"resource,omitempty"`
+	RequestType  string `json:"requestType"`
+	AuthOutcome  string `json:"authOutcome"`
+}
+
+// JWK is a JSON Web Key, see RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// TokenSigner mints identity tokens
+type TokenSigner struct {
+	identityToken conf.IdentityToken
+	keyID         string
+	hmacKey       []byte
+	privateKey    ed25519.PrivateKey
+}
+
+// NewTokenSigner loads the configured signing key
+func NewTokenSigner(config *conf.Config) (*TokenSigner, error) {
+	identityToken := config.YamlConfig.Mesh.IdentityToken
+	signer := &TokenSigner{identityToken: identityToken}
+
+	switch identityToken.Algorithm {
+	case conf.IdentityTokenAlgorithmHS256:
+		if len(config.IdentityTokenSecret) == 0 {
+			return nil, errors.New("identity token secret not set")
+		}
+		signer.hmacKey = config.IdentityTokenSecret
+		signer.keyID = keyID(config.IdentityTokenSecret)
+	case conf.IdentityTokenAlgorithmEdDSA:
+		privateKey, err := LoadEd25519PrivateKey(identityToken.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer.privateKey = privateKey
+		signer.keyID = keyID(privateKey.Public().(ed25519.PublicKey))
+	default:
+		return nil, fmt.Errorf("unsupported identity token algorithm '%s'", identityToken.Algorithm)
+	}
+
+	return signer, nil
+}
+
+// LoadEd25519PrivateKey loads a PEM-encoded PKCS #8 Ed25519 private key
+func LoadEd25519PrivateKey(keyFile string) (ed25519.PrivateKey, error) {
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 private key", keyFile)
+	}
+
+	return privateKey, nil
+}
+
+// Sign mints a token containing the given verified identity
+func (signer *TokenSigner) Sign(requestID string, identity *Identity, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": signer.identityToken.Algorithm,
+		"typ": "JWT",
+		"kid": signer.keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(IdentityClaims{
+		Issuer:       signer.identityToken.Issuer,
+		Subject:      identity.OrgID,
+		IssuedAt:     now.Unix(),
+		NotBefore:    now.Unix(),
+		ExpiresAt:    now.Add(signer.identityToken.TTL).Unix(),
+		RequestID:    requestID,
+		OrgID:        identity.OrgID,
+		OrgDomainUrl: identity.OrgDomainUrl,
+		AppUUID:      identity.AppUUID,
+		ContextType:  identity.ContextType,
+		Resource:     identity.Resource,
+		RequestType:  identity.RequestType,
+		AuthOutcome:  identity.AuthOutcome.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	var signature []byte
+	if signer.privateKey != nil {
+		signature = ed25519.Sign(signer.privateKey, []byte(signingInput))
+	} else {
+		mac := hmac.New(sha256.New, signer.hmacKey)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// JWKS returns the public keys verifying identity tokens.  HS256 secrets are not published.
+func (signer *TokenSigner) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	if signer.privateKey != nil {
+		jwks.Keys = append(jwks.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(signer.privateKey.Public().(ed25519.PublicKey)),
+			KeyID:     signer.keyID,
+			Algorithm: conf.IdentityTokenAlgorithmEdDSA,
+			Use:       "sig",
+		})
+	}
+
+	return jwks
+}
+
+// SetIdentityToken mints and sets the identity token on the request forwarded to the app, if the
+// identity is trusted
+func SetIdentityToken(requestID string, signer *TokenSigner, headers http.Header, identity *Identity) error {
+	if !identity.Trusted() {
+		return nil
+	}
+
+	token, err := signer.Sign(requestID, identity, time.Now())
+	if err != nil {
+		return err
+	}
+
+	headers.Set(signer.identityToken.Header, token)
+	return nil
+}
+
+var defaultTokenSigner = sync.OnceValues(func() (*TokenSigner, error) {
+	return NewTokenSigner(conf.GetConfig())
+})
+
+// JWKSHandler serves the identity token public keys
+func JWKSHandler() http.HandlerFunc {
+	return func(respWriter http.ResponseWriter, req *http.Request) {
+		jwks := JWKS{Keys: []JWK{}}
+		if conf.GetConfig().YamlConfig.Mesh.IdentityToken.Enable {
+			signer, err := defaultTokenSigner()
+			if err != nil {
+				WriteError("n/a", respWriter, req, NewInternalError("Failed to load identity token signer", err))
+				return
+			}
+			jwks = signer.JWKS()
+		}
+
+		respWriter.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(respWriter).Encode(jwks); err != nil {
+			LogError("n/a", "Failed to write JWKS: "+err.Error())
+		}
+	}
+}
+
+// keyID identifies a key by a truncated SHA-256 thumbprint
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
@@ -0,0 +1,188 @@
+package mesh
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+)
+
+const (
+	HdrUpgrade = "Upgrade"
+
+	MetricUpgradeConnections      = MetricPrefix + "upgrade_connections"
+	MetricUpgradeConnectionsTotal = MetricPrefix + "upgrade_connections_total"
+	MetricUpgradeBytesTotal       = MetricPrefix + "upgrade_bytes_total"
+)
+
+// IsUpgradeRequest returns whether the request asks to upgrade the connection to one of the
+// configured protocols, eg a WebSocket handshake
+func IsUpgradeRequest(upgrade conf.Upgrade, incomingReq *http.Request) bool {
+	if !upgrade.Enable || !headerContainsToken(incomingReq.Header, HdrConnection, "upgrade") {
+		return false
+	}
+
+	protocol, _, _ := strings.Cut(incomingReq.Header.Get(HdrUpgrade), "/")
+	return slices.Contains(upgrade.Protocols, strings.ToLower(strings.TrimSpace(protocol)))
+}
+
+// ProxyUpgrade forwards the upgrade request to the app and, when the app switches protocols,
+// splices the client's connection to the app's until either side closes it or it is idle for
+// the configured IdleTimeout.  Other app responses are replied to as is.
+func ProxyUpgrade(
+	requestID string,
+	upgrade conf.Upgrade,
+	transport http.RoundTripper,
+	route string,
+	forwardApiUrl string,
+	incomingRespWriter http.ResponseWriter,
+	incomingReq *http.Request) {
+
+	protocol := strings.ToLower(incomingReq.Header.Get(HdrUpgrade))
+	forwardReq, err := NewForwardRequest(forwardApiUrl, incomingReq, nil)
+	if err != nil {
+		WriteError(requestID, incomingRespWriter, incomingReq, NewInternalError("Failed to create forward request", err))
+		return
+	}
+
+	// Hop-by-hop upgrade headers are removed from forwarded requests
+	forwardReq.Header.Set(HdrConnection, "Upgrade")
+	forwardReq.Header.Set(HdrUpgrade, incomingReq.Header.Get(HdrUpgrade))
+
+	LogInfo(requestID, "Forwarding "+protocol+" upgrade request...")
+	forwardResp, err := transport.RoundTrip(forwardReq)
+	if err != nil {
+		GetMetrics().IncrCounter(MetricUpgradeConnectionsTotal, "route", route, "protocol", protocol, "outcome", "failed")
+		WriteError(requestID, incomingRespWriter, incomingReq, NewAppUnavailable(err))
+		return
+	}
+
+	if forwardResp.StatusCode != http.StatusSwitchingProtocols {
+		LogWarn(requestID, "App declined "+protocol+" upgrade")
+		GetMetrics().IncrCounter(MetricUpgradeConnectionsTotal, "route", route, "protocol", protocol, "outcome", "declined")
+		ReplyToIncomingRequest(requestID, forwardResp, incomingRespWriter)
+		return
+	}
+
+	appConn, ok := forwardResp.Body.(io.ReadWriteCloser)
+	if !ok {
+		forwardResp.Body.Close()
+		WriteError(requestID, incomingRespWriter, incomingReq, NewInternalError("App upgrade connection is not writable", nil))
+		return
+	}
+	defer appConn.Close()
+
+	hijacker, ok := incomingRespWriter.(http.Hijacker)
+	if !ok {
+		WriteError(requestID, incomingRespWriter, incomingReq, NewInternalError("Connection does not support upgrades", nil))
+		return
+	}
+
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		LogError(requestID, "Failed to hijack connection: "+err.Error())
+		return
+	}
+	defer clientConn.Close()
+
+	// Complete the client's handshake with the app's response
+	header := incomingRespWriter.Header().Clone()
+	CopyHeaders(header, forwardResp.Header)
+	RemoveHopByHopHeaders(header)
+	header.Set(HdrConnection, "Upgrade")
+	header.Set(HdrUpgrade, forwardResp.Header.Get(HdrUpgrade))
+
+	_, _ = clientBuf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = header.Write(clientBuf)
+	_, _ = clientBuf.WriteString("\r\n")
+	if err := clientBuf.Flush(); err != nil {
+		LogError(requestID, "Failed to complete upgrade: "+err.Error())
+		return
+	}
+
+	LogInfo(requestID, "Upgraded connection to "+protocol)
+	GetMetrics().IncrCounter(MetricUpgradeConnectionsTotal, "route", route, "protocol", protocol, "outcome", "upgraded")
+	GetMetrics().AddGauge(MetricUpgradeConnections, 1, "protocol", protocol)
+	defer GetMetrics().AddGauge(MetricUpgradeConnections, -1, "protocol", protocol)
+
+	startTime := time.Now()
+	closeReason := splice(requestID, upgrade.IdleTimeout, protocol, clientConn, clientBuf.Reader, appConn)
+	LogInfo(requestID, "Closed "+protocol+" connection after "+time.Since(startTime).String()+": "+closeReason)
+}
+
+// splice copies the client's reads, starting with those buffered, to the app's connection and the
+// app's reads to the client's connection, closing both when either side closes or both are idle
+// for idleTimeout
+func splice(
+	requestID string,
+	idleTimeout time.Duration,
+	protocol string,
+	clientConn io.ReadWriteCloser,
+	clientReader io.Reader,
+	appConn io.ReadWriteCloser) string {
+
+	var mu sync.Mutex
+	closeReason := ""
+	closeBoth := func(reason string) {
+		mu.Lock()
+		if closeReason == "" {
+			closeReason = reason
+		}
+		mu.Unlock()
+
+		_ = clientConn.Close()
+		_ = appConn.Close()
+	}
+
+	idle := time.AfterFunc(idleTimeout, func() {
+		LogWarn(requestID, "Closing idle "+protocol+" connection")
+		closeBoth("idle timeout")
+	})
+	defer idle.Stop()
+
+	var wg sync.WaitGroup
+	copyConn := func(dst io.Writer, src io.Reader, direction string, reason string) {
+		defer wg.Done()
+		n, _ := io.Copy(dst, &activityReader{reader: src, idle: idle, idleTimeout: idleTimeout})
+		GetMetrics().AddCounter(MetricUpgradeBytesTotal, float64(n), "protocol", protocol, "direction", direction)
+		closeBoth(reason)
+	}
+
+	wg.Add(2)
+	go copyConn(appConn, clientReader, "upstream", "client closed")
+	go copyConn(clientConn, appConn, "downstream", "app closed")
+	wg.Wait()
+
+	return closeReason
+}
+
+// activityReader postpones the idle timeout on each read
+type activityReader struct {
+	reader      io.Reader
+	idle        *time.Timer
+	idleTimeout time.Duration
+}
+
+func (activityReader *activityReader) Read(p []byte) (int, error) {
+	n, err := activityReader.reader.Read(p)
+	if n > 0 {
+		activityReader.idle.Reset(activityReader.idleTimeout)
+	}
+	return n, err
+}
+
+// headerContainsToken returns whether the comma-separated header values contain the token
+func headerContainsToken(headers http.Header, header string, token string) bool {
+	for _, value := range headers.Values(header) {
+		for _, element := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(element), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -24,8 +24,13 @@ func LogWarn(requestID string, msg string) {
 }
 
 // TODO: Combine w/ LogInfo and dynamically call appropriate log level func
-func LogError(requestID string, msg string) {
-	slog.Error(msg, "request-id", requestID)
+func LogError(requestID string, msg string, attrs ...any) {
+	slog.Error(msg, append([]any{"request-id", requestID}, attrs...)...)
+}
+
+// LogAudit logs security-relevant decisions, eg denied requests, tagged for audit
+func LogAudit(requestID string, msg string, attrs ...any) {
+	slog.Warn(msg, append([]any{"request-id", requestID, "audit", true}, attrs...)...)
 }
 
 func TimeTrack(requestID string, startTime time.Time, name string) {
@@ -8,6 +8,9 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
 )
 
 const (
@@ -18,37 +21,128 @@ const (
 	SalesforceExpectedHeaderCount = 2
 )
 
-type InvalidRequest struct {
-	StatusCode int
-	Err        error
+// InvalidRequest is an error replied to clients, see errors.ServerError
+type InvalidRequest = meshErrors.ServerError
+
+// NewInvalidRequest Return when request is invalid - 401 Unauthorized
+func NewInvalidRequest(message string) *InvalidRequest {
+	return meshErrors.New(meshErrors.Validation, message)
+}
+
+// NewMalformedRequest Return when request is structured
+// correctly - likely a valid Salesforce/Data Cloud request,
+// but headers or header content is incorrect - 400 Bad Request
+func NewMalformedRequest(message string) *InvalidRequest {
+	return meshErrors.New(meshErrors.Malformed, message)
 }
 
-func (e *InvalidRequest) HttpStatusCode() int {
-	return e.StatusCode
+// NewUnauthenticatedRequest Return when the request's credentials
+// are missing, invalid or expired - 401 Unauthorized
+func NewUnauthenticatedRequest(message string) *InvalidRequest {
+	return meshErrors.New(meshErrors.Unauthenticated, message)
 }
 
-func (e *InvalidRequest) Error() string {
-	return fmt.Sprintf("%d %v", e.StatusCode, e.Err)
+// NewForbiddenRequest Return when a valid request is not
+// permitted by route policy - 403 Forbidden
+func NewForbiddenRequest(message string) *InvalidRequest {
+	return meshErrors.New(meshErrors.Forbidden, message)
 }
 
-// NewInvalidRequest Return when request is invalid - 401 Unauthorized
-func NewInvalidRequest(message string) *InvalidRequest {
+// NewMethodNotAllowedRequest Return when the request's HTTP method
+// is not permitted by route policy - 405 Method Not Allowed
+func NewMethodNotAllowedRequest(message string) *InvalidRequest {
 	return &InvalidRequest{
-		StatusCode: http.StatusUnauthorized,
-		Err:        errors.New(message),
+		Kind:       meshErrors.Validation,
+		StatusCode: http.StatusMethodNotAllowed,
+		Message:    message,
 	}
 }
 
-// NewMalformedRequest Return when request is structured
-// correctly - likely a valid Salesforce/Data Cloud request,
-// but headers or header content is incorrect - 400 Bad Request
-func NewMalformedRequest(message string) *InvalidRequest {
+// NewNotFoundRequest Return when the request's path is not
+// declared by the app - 404 Not Found
+func NewNotFoundRequest(message string) *InvalidRequest {
+	return &InvalidRequest{
+		Kind:       meshErrors.Validation,
+		StatusCode: http.StatusNotFound,
+		Message:    message,
+	}
+}
+
+// NewTooManyRequests Return when the request exceeds
+// the org's rate limit - 429 Too Many Requests
+func NewTooManyRequests(message string) *InvalidRequest {
+	return meshErrors.New(meshErrors.LimitExceeded, message)
+}
+
+// NewServiceUnavailable Return when the request is shed because
+// the app is at its concurrency limit - 503 Service Unavailable
+func NewServiceUnavailable(message string) *InvalidRequest {
+	return &InvalidRequest{
+		Kind:       meshErrors.LimitExceeded,
+		StatusCode: http.StatusServiceUnavailable,
+		Message:    message,
+	}
+}
+
+// NewPayloadTooLarge Return when the request's body exceeds
+// its size limit - 413 Payload Too Large
+func NewPayloadTooLarge(message string) *InvalidRequest {
+	return &InvalidRequest{
+		Kind:       meshErrors.LimitExceeded,
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Message:    message,
+	}
+}
+
+// NewUnsupportedMediaType Return when the request's content
+// encoding is not supported - 415 Unsupported Media Type
+func NewUnsupportedMediaType(message string) *InvalidRequest {
+	return &InvalidRequest{
+		Kind:       meshErrors.Malformed,
+		StatusCode: http.StatusUnsupportedMediaType,
+		Message:    message,
+	}
+}
+
+// NewReplayedRequest Return when the request was already
+// received - 409 Conflict
+func NewReplayedRequest(message string) *InvalidRequest {
+	return meshErrors.New(meshErrors.Replay, message)
+}
+
+// NewConflictRequest Return when a duplicate of the request
+// is still in progress - 409 Conflict
+func NewConflictRequest(message string) *InvalidRequest {
+	return meshErrors.New(meshErrors.Conflict, message)
+}
+
+// NewUnprocessableRequest Return when the request's content
+// violates its schema - 422 Unprocessable Entity
+func NewUnprocessableRequest(message string, violations []meshErrors.Violation) *InvalidRequest {
 	return &InvalidRequest{
-		StatusCode: http.StatusBadRequest,
-		Err:        errors.New(message),
+		Kind:       meshErrors.Unprocessable,
+		Message:    message,
+		Violations: violations,
 	}
 }
 
+// NewUpstreamAuthFailure Return when authenticating with the Heroku
+// Integration service fails unexpectedly - 502 Bad Gateway
+func NewUpstreamAuthFailure(err error) *InvalidRequest {
+	return meshErrors.Wrap(meshErrors.UpstreamAuthFailure, "Failed to authenticate request", err)
+}
+
+// NewAppUnavailable Return when the request cannot be forwarded
+// to the app - 502 Bad Gateway
+func NewAppUnavailable(err error) *InvalidRequest {
+	return meshErrors.Wrap(meshErrors.AppUnavailable, "Failed to forward request to app", err)
+}
+
+// NewInternalError Return when the mesh fails unexpectedly - 500 Internal Server Error
+func NewInternalError(message string, err error) *InvalidRequest {
+	return meshErrors.Wrap(meshErrors.Internal, message, err)
+}
+
 type XRequestContext struct {
 	ID           string `json:"id"`
 	Auth         string `json:"auth"`
@@ -60,14 +154,40 @@ type XRequestContext struct {
 	AppUUID      string `json:"appUuid"`
 }
 
+type UserContext struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+}
+
+// XClientContext is the decoded x-client-context header.  AccessToken must not be logged.
+type XClientContext struct {
+	AccessToken  string      `json:"accessToken"`
+	ApiVersion   string      `json:"apiVersion"`
+	Namespace    string      `json:"namespace"`
+	OrgID        string      `json:"orgId"`
+	OrgDomainUrl string      `json:"orgDomainUrl"`
+	RequestID    string      `json:"requestId"`
+	UserContext  UserContext `json:"userContext"`
+}
+
 type RequestHeader struct {
 	XRequestID          string          `json:"x-request-id"`
 	XRequestContext     XRequestContext `json:"x-request-context"`
 	XClientContext      string          `json:"x-client-context"`
+	ClientContext       XClientContext  `json:"-"`
 	XSignature          string          `json:"x-signature"`
 	IsSalesforceRequest bool            `json:"isDataActionTargetRequest"`
 }
 
+// RequestType returns the validated request's type - salesforce or dataActionTarget
+func (requestHeader *RequestHeader) RequestType() string {
+	if requestHeader.IsSalesforceRequest {
+		return conf.RequestTypeSalesforce
+	}
+
+	return conf.RequestTypeDataActionTarget
+}
+
 // ValidateRequest validates the request headers based on type - Salesforce or Data Action Target.
 //
 // Request Salesforce request headers:
@@ -78,6 +198,8 @@ type RequestHeader struct {
 // Required Data Action Target request headers:
 //   - x-request-id
 //   - x-signature
+//
+// Every validation failure is collected in the returned error's Violations.
 func ValidateRequest(requestID string, headers http.Header) (*RequestHeader, error) {
 	LogInfo(requestID, "Validating request...")
 
@@ -94,93 +216,181 @@ func ValidateRequest(requestID string, headers http.Header) (*RequestHeader, err
 	xSignature := headers.Get(HdrSignature)
 
 	// First check if Salesforce headers are present
-	sfHeaderCount, sfHeaderErrors := doSalesforceHeadersExist(XRequestContextString, xClientContext)
-	if sfHeaderCount != SalesforceExpectedHeaderCount {
-		// There's an issue w/ Salesforce headers...
-		if sfHeaderCount == 0 {
-			// ZERO Salesforce headers were found.
-			// Is this a Data Action Target request?
-			if xSignature != "" {
-				// Found Data Action Target request, no further validation here
-				return &RequestHeader{
-					XRequestID:          requestID,
-					IsSalesforceRequest: false,
-					XSignature:          xSignature,
-				}, nil
-			}
-
-			// NOT a Salesforce, NOT a Data Action Target request
-			LogDebug(requestID, "Errors: "+strings.Join(sfHeaderErrors, "; ")+"; Data Action Target header (x-signature) not found")
-			LogError(requestID, "Invalid request!")
-		} else {
-			// Found some, but NOT all Salesforce headers
-			LogDebug(requestID, "Errors: "+strings.Join(sfHeaderErrors, "; "))
-			LogError(requestID, "Invalid request!")
-			return nil, NewMalformedRequest("Invalid request")
+	sfHeaderCount, violations := doSalesforceHeadersExist(XRequestContextString, xClientContext)
+	if sfHeaderCount == 0 {
+		// ZERO Salesforce headers were found.
+		// Is this a Data Action Target request?
+		if xSignature != "" {
+			// Found Data Action Target request, no further validation here
+			return &RequestHeader{
+				XRequestID:          requestID,
+				IsSalesforceRequest: false,
+				XSignature:          xSignature,
+			}, nil
 		}
 
-		return nil, NewInvalidRequest("Invalid request")
-	}
-
-	// Additional Salesforce header validation
-	// 1. Decode the x-request-context
-	contextData, err := base64.StdEncoding.DecodeString(XRequestContextString)
-	if err != nil {
-		LogError(requestID, "Invalid request! Unable to decode Salesforce "+HdrRequestContext+" header")
-		return nil, NewMalformedRequest("Invalid " + HdrRequestContext + " header")
+		// NOT a Salesforce, NOT a Data Action Target request
+		violations = append(violations, meshErrors.Violation{Field: HdrSignature, Message: "Data Action Target header not found"})
+		return nil, newValidationError(requestID, meshErrors.Validation, violations)
 	}
 
+	// Additional Salesforce header validation, collecting all violations
 	var XRequestContext XRequestContext
-	if err := json.Unmarshal(contextData, &XRequestContext); err != nil {
-		LogError(requestID, "Invalid request! Unable to unmarshal Salesforce "+HdrRequestContext+" header")
-		return nil, NewMalformedRequest("Invalid " + HdrRequestContext + " header")
+	if XRequestContextString != "" {
+		var contextViolations []meshErrors.Violation
+		XRequestContext, contextViolations = decodeRequestContext(requestID, XRequestContextString)
+		violations = append(violations, contextViolations...)
 	}
 
-	// 2. Ensure all values are present in request context
-	if err := validateRequestContextValues(&XRequestContext); err != nil {
-		LogError(requestID, "Invalid request! "+err.Error())
-		return nil, err
+	var clientContext XClientContext
+	if xClientContext != "" {
+		var clientContextViolations []meshErrors.Violation
+		clientContext, clientContextViolations = decodeClientContext(requestID, xClientContext, &XRequestContext)
+		violations = append(violations, clientContextViolations...)
 	}
 
-	// 3. Validate that x-request-id and x-request-context#id are the same
-	if !strings.Contains(requestID, XRequestContext.ID) {
-		LogError(requestID, "Invalid request! Missing or mismatch x-request-id and x-request-context#id")
-		return nil, NewMalformedRequest("Invalid " + HdrRequestContext + " header")
+	if len(violations) > 0 {
+		return nil, newValidationError(requestID, meshErrors.Malformed, violations)
 	}
 
 	LogInfo(requestID, "Valid request!")
+	LogDebug(requestID, "Client context: apiVersion "+clientContext.ApiVersion+", namespace '"+clientContext.Namespace+
+		"', user "+clientContext.UserContext.UserID)
 
 	return &RequestHeader{
 		XRequestID:          requestID,
 		XRequestContext:     XRequestContext,
 		XClientContext:      xClientContext,
+		ClientContext:       clientContext,
 		IsSalesforceRequest: true,
 	}, nil
 }
 
-func doSalesforceHeadersExist(XRequestContext, xClientContext string) (int, []string) {
+// newValidationError logs and returns an invalid request error with the given violations
+func newValidationError(requestID string, kind meshErrors.Kind, violations []meshErrors.Violation) *InvalidRequest {
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.Field + ": " + violation.Message
+	}
+	LogError(requestID, "Invalid request! "+strings.Join(messages, "; "))
+
+	return &InvalidRequest{
+		Kind:       kind,
+		Message:    "Invalid request",
+		Violations: violations,
+	}
+}
+
+// WithValidationVerbosity removes the error's, or its wrapped InvalidRequest's, violations unless
+// detailed validation errors are configured
+func WithValidationVerbosity(config *conf.Config, err error) error {
+	var invalidRequest *InvalidRequest
+	if !errors.As(err, &invalidRequest) || len(invalidRequest.Violations) == 0 || config.YamlConfig.Mesh.Validation.Verbosity == conf.ValidationVerbosityDetailed {
+		return err
+	}
+
+	minimal := *invalidRequest
+	minimal.Violations = nil
+	return &minimal
+}
+
+func doSalesforceHeadersExist(XRequestContext, xClientContext string) (int, []meshErrors.Violation) {
 	sfHeaderCount := SalesforceExpectedHeaderCount
-	var sfHeaderErrors []string
+	var violations []meshErrors.Violation
 
 	if XRequestContext == "" {
 		sfHeaderCount--
-		sfHeaderErrors = append(sfHeaderErrors, "Invalid "+HdrRequestContext+" header")
+		violations = append(violations, meshErrors.Violation{Field: HdrRequestContext, Message: "Missing header"})
 	}
 
 	if xClientContext == "" {
 		sfHeaderCount--
-		sfHeaderErrors = append(sfHeaderErrors, "Invalid "+HdrClientContext+" header")
+		violations = append(violations, meshErrors.Violation{Field: HdrClientContext, Message: "Missing header"})
+	}
+
+	return sfHeaderCount, violations
+}
+
+// decodeRequestContext decodes and validates the x-request-context header
+func decodeRequestContext(requestID string, XRequestContextString string) (XRequestContext, []meshErrors.Violation) {
+	var XRequestContext XRequestContext
+
+	contextData, err := base64.StdEncoding.DecodeString(XRequestContextString)
+	if err != nil {
+		return XRequestContext, []meshErrors.Violation{{Field: HdrRequestContext, Message: "Invalid base64 encoding"}}
+	}
+
+	if err := json.Unmarshal(contextData, &XRequestContext); err != nil {
+		return XRequestContext, []meshErrors.Violation{{Field: HdrRequestContext, Message: "Invalid JSON"}}
+	}
+
+	// Ensure all values are present in request context
+	violations := validateRequestContextValues(&XRequestContext)
+
+	// Validate that x-request-id and x-request-context#id are the same
+	if XRequestContext.ID != "" && !strings.Contains(requestID, XRequestContext.ID) {
+		violations = append(violations, meshErrors.Violation{
+			Field:   HdrRequestContext + ".id",
+			Message: "Mismatch with " + HdrNameRequestID,
+		})
+	}
+
+	return XRequestContext, violations
+}
+
+// decodeClientContext decodes the x-client-context header and validates it against the
+// request context's org and the request ID
+func decodeClientContext(requestID string, xClientContext string, requestContext *XRequestContext) (XClientContext, []meshErrors.Violation) {
+	var clientContext XClientContext
+
+	clientContextData, err := base64.StdEncoding.DecodeString(xClientContext)
+	if err != nil {
+		return clientContext, []meshErrors.Violation{{Field: HdrClientContext, Message: "Invalid base64 encoding"}}
+	}
+
+	if err := json.Unmarshal(clientContextData, &clientContext); err != nil {
+		return clientContext, []meshErrors.Violation{{Field: HdrClientContext, Message: "Invalid JSON"}}
+	}
+
+	var violations []meshErrors.Violation
+	if clientContext.OrgID == "" {
+		violations = append(violations, meshErrors.Violation{Field: HdrClientContext + ".orgId", Message: "Missing or invalid value"})
+	} else if requestContext.OrgID != "" && !OrgIDEquals(clientContext.OrgID, requestContext.OrgID) {
+		violations = append(violations, meshErrors.Violation{
+			Field:   HdrClientContext + ".orgId",
+			Message: "Mismatch with " + HdrRequestContext + ".orgId",
+		})
+	}
+
+	if clientContext.OrgDomainUrl != "" && requestContext.OrgDomainUrl != "" &&
+		!strings.EqualFold(strings.TrimSuffix(clientContext.OrgDomainUrl, "/"), strings.TrimSuffix(requestContext.OrgDomainUrl, "/")) {
+		violations = append(violations, meshErrors.Violation{
+			Field:   HdrClientContext + ".orgDomainUrl",
+			Message: "Mismatch with " + HdrRequestContext + ".orgDomainUrl",
+		})
+	}
+
+	if clientContext.RequestID != "" && !strings.Contains(requestID, clientContext.RequestID) {
+		violations = append(violations, meshErrors.Violation{
+			Field:   HdrClientContext + ".requestId",
+			Message: "Mismatch with " + HdrNameRequestID,
+		})
 	}
 
-	return sfHeaderCount, sfHeaderErrors
+	return clientContext, violations
 }
 
-func validateRequestContextValues(context *XRequestContext) error {
+func validateRequestContextValues(context *XRequestContext) []meshErrors.Violation {
+	var violations []meshErrors.Violation
 	v := reflect.ValueOf(*context)
 	for i := 0; i < v.NumField(); i++ {
 		if v.Field(i).IsZero() {
-			return NewMalformedRequest(fmt.Sprintf("Missing or invalid value in "+HdrRequestContext+" header: %s", v.Type().Field(i).Name))
+			field, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			violations = append(violations, meshErrors.Violation{
+				Field:   HdrRequestContext + "." + field,
+				Message: "Missing or invalid value",
+			})
 		}
 	}
-	return nil
+	return violations
 }
@@ -0,0 +1,218 @@
+// Package meshcontext provides net/http middleware for apps behind the Heroku
+// Integration Service Mesh.  The middleware parses the identity verified by the
+// mesh, forwarded as mesh-owned headers or a mesh-signed identity token, into a
+// Context available on each request's context.Context.
+package meshcontext
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Default header names set by the mesh
+const (
+	HdrRequestID     = "x-request-id"
+	HdrOrgID         = "x-heroku-integration-mesh-org-id"
+	HdrOrgDomainUrl  = "x-heroku-integration-mesh-org-domain-url"
+	HdrAppUUID       = "x-heroku-integration-mesh-app-uuid"
+	HdrContextType   = "x-heroku-integration-mesh-context-type"
+	HdrResource      = "x-heroku-integration-mesh-resource"
+	HdrRequestType   = "x-heroku-integration-mesh-request-type"
+	HdrAuthOutcome   = "x-heroku-integration-mesh-verdict"
+	HdrIdentityToken = "x-heroku-integration-mesh-token"
+
+	// TokenSecretEnvVar is the per-dyno HS256 identity token secret set by the mesh
+	TokenSecretEnvVar = "HEROKU_INTEGRATION_SERVICE_MESH_TOKEN_SECRET"
+	TokenIssuer       = "heroku-integration-service-mesh"
+)
+
+// Request types
+const (
+	RequestTypeSalesforce       = "salesforce"
+	RequestTypeDataActionTarget = "dataActionTarget"
+	RequestTypeNone             = "none"
+)
+
+// Authentication outcomes
+const (
+	AuthOutcomeAllow       = "allow"
+	AuthOutcomeWouldDeny   = "would-deny"
+	AuthOutcomePassThrough = "pass-through"
+)
+
+var (
+	ErrMissingToken = errors.New("missing identity token")
+	ErrInvalidToken = errors.New("invalid identity token")
+)
+
+// Context is the requester's identity as verified by the mesh
+type Context struct {
+	RequestID    string
+	OrgID        string
+	OrgDomainUrl string
+	AppUUID      string
+	ContextType  string
+	Resource     string
+	RequestType  string
+	AuthOutcome  string
+	// Verified is true when the identity was read from a verified identity token
+	Verified bool
+}
+
+// IsAuthenticated returns true when the mesh validated and authenticated the request
+func (c *Context) IsAuthenticated() bool {
+	return c.AuthOutcome == AuthOutcomeAllow
+}
+
+// Headers are the names of the mesh's identity headers.  Empty names use defaults.
+type Headers struct {
+	OrgID        string
+	OrgDomainUrl string
+	AppUUID      string
+	ContextType  string
+	Resource     string
+	RequestType  string
+	AuthOutcome  string
+}
+
+// Options configure the middleware.  The zero value reads identity headers and, when
+// present, verifies identity tokens with the HS256 secret set by the mesh.
+type Options struct {
+	Headers     Headers
+	TokenHeader string
+	// HS256Secret verifies HS256 identity tokens; defaults to the TokenSecretEnvVar config var
+	HS256Secret []byte
+	// Ed25519PublicKey verifies EdDSA identity tokens, see the mesh's JWKS
+	Ed25519PublicKey ed25519.PublicKey
+	// RequireToken rejects requests without a valid identity token
+	RequireToken bool
+	Issuer       string
+	// Now returns the current time, for tests
+	Now func() time.Time
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given mesh context
+func NewContext(ctx context.Context, meshContext *Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, meshContext)
+}
+
+// FromContext returns the mesh context, if any
+func FromContext(ctx context.Context) (*Context, bool) {
+	meshContext, ok := ctx.Value(contextKey{}).(*Context)
+	return meshContext, ok
+}
+
+// OrgID returns the requesting org's ID or an empty string
+func OrgID(ctx context.Context) string {
+	if meshContext, ok := FromContext(ctx); ok {
+		return meshContext.OrgID
+	}
+	return ""
+}
+
+// RequestType returns the request type - salesforce, dataActionTarget or none - or an empty string
+func RequestType(ctx context.Context) string {
+	if meshContext, ok := FromContext(ctx); ok {
+		return meshContext.RequestType
+	}
+	return ""
+}
+
+// RequestID returns the request's ID or an empty string
+func RequestID(ctx context.Context) string {
+	if meshContext, ok := FromContext(ctx); ok {
+		return meshContext.RequestID
+	}
+	return ""
+}
+
+// Middleware parses the mesh context of each request.  Requests with an invalid identity
+// token, or without one when required, are rejected with 401 Unauthorized.
+func Middleware(options Options) func(http.Handler) http.Handler {
+	options = options.withDefaults()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+			meshContext, err := parseRequest(req, options)
+			if err != nil {
+				http.Error(respWriter, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(respWriter, req.WithContext(NewContext(req.Context(), meshContext)))
+		})
+	}
+}
+
+// FromRequest parses the request's mesh context
+func FromRequest(req *http.Request, options Options) (*Context, error) {
+	return parseRequest(req, options.withDefaults())
+}
+
+func parseRequest(req *http.Request, options Options) (*Context, error) {
+	if token := req.Header.Get(options.TokenHeader); token != "" {
+		meshContext, err := verifyToken(token, options)
+		if err != nil {
+			return nil, err
+		}
+		if meshContext.RequestID == "" {
+			meshContext.RequestID = req.Header.Get(HdrRequestID)
+		}
+		return meshContext, nil
+	}
+
+	if options.RequireToken {
+		return nil, ErrMissingToken
+	}
+
+	return &Context{
+		RequestID:    req.Header.Get(HdrRequestID),
+		OrgID:        req.Header.Get(options.Headers.OrgID),
+		OrgDomainUrl: req.Header.Get(options.Headers.OrgDomainUrl),
+		AppUUID:      req.Header.Get(options.Headers.AppUUID),
+		ContextType:  req.Header.Get(options.Headers.ContextType),
+		Resource:     req.Header.Get(options.Headers.Resource),
+		RequestType:  req.Header.Get(options.Headers.RequestType),
+		AuthOutcome:  req.Header.Get(options.Headers.AuthOutcome),
+	}, nil
+}
+
+func (options Options) withDefaults() Options {
+	defaults := []struct {
+		name         *string
+		defaultValue string
+	}{
+		{&options.Headers.OrgID, HdrOrgID},
+		{&options.Headers.OrgDomainUrl, HdrOrgDomainUrl},
+		{&options.Headers.AppUUID, HdrAppUUID},
+		{&options.Headers.ContextType, HdrContextType},
+		{&options.Headers.Resource, HdrResource},
+		{&options.Headers.RequestType, HdrRequestType},
+		{&options.Headers.AuthOutcome, HdrAuthOutcome},
+		{&options.TokenHeader, HdrIdentityToken},
+		{&options.Issuer, TokenIssuer},
+	}
+	for _, header := range defaults {
+		if *header.name == "" {
+			*header.name = header.defaultValue
+		}
+	}
+
+	if options.HS256Secret == nil {
+		if secret, err := base64.RawURLEncoding.DecodeString(os.Getenv(TokenSecretEnvVar)); err == nil && len(secret) > 0 {
+			options.HS256Secret = secret
+		}
+	}
+
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+
+	return options
+}
@@ -0,0 +1,92 @@
+// Package meshcontexttest fabricates mesh contexts for testing apps that use meshcontext.
+package meshcontexttest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/meshcontext"
+)
+
+const (
+	OrgID        = "00Dxx0000000000EAA"
+	OrgDomainUrl = "https://example.my.salesforce.com"
+	AppUUID      = "00000000-0000-0000-0000-000000000000"
+	RequestID    = OrgID + "-" + AppUUID
+)
+
+// NewContext returns an authenticated Salesforce mesh context, applying the given overrides
+func NewContext(overrides ...func(*meshcontext.Context)) *meshcontext.Context {
+	meshContext := &meshcontext.Context{
+		RequestID:    RequestID,
+		OrgID:        OrgID,
+		OrgDomainUrl: OrgDomainUrl,
+		AppUUID:      AppUUID,
+		ContextType:  "ApexCallout",
+		Resource:     "resource",
+		RequestType:  meshcontext.RequestTypeSalesforce,
+		AuthOutcome:  meshcontext.AuthOutcomeAllow,
+	}
+
+	for _, override := range overrides {
+		override(meshContext)
+	}
+
+	return meshContext
+}
+
+// WithContext returns a copy of ctx carrying the given mesh context
+func WithContext(ctx context.Context, meshContext *meshcontext.Context) context.Context {
+	return meshcontext.NewContext(ctx, meshContext)
+}
+
+// NewRequest returns an incoming test request carrying the given mesh context, eg for
+// handlers called without the middleware
+func NewRequest(method string, target string, meshContext *meshcontext.Context) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	return req.WithContext(WithContext(req.Context(), meshContext))
+}
+
+// SetHeaders sets the mesh's default identity headers, eg for handlers called with the middleware
+func SetHeaders(headers http.Header, meshContext *meshcontext.Context) {
+	headers.Set(meshcontext.HdrRequestID, meshContext.RequestID)
+	headers.Set(meshcontext.HdrOrgID, meshContext.OrgID)
+	headers.Set(meshcontext.HdrOrgDomainUrl, meshContext.OrgDomainUrl)
+	headers.Set(meshcontext.HdrAppUUID, meshContext.AppUUID)
+	headers.Set(meshcontext.HdrContextType, meshContext.ContextType)
+	headers.Set(meshcontext.HdrResource, meshContext.Resource)
+	headers.Set(meshcontext.HdrRequestType, meshContext.RequestType)
+	headers.Set(meshcontext.HdrAuthOutcome, meshContext.AuthOutcome)
+}
+
+// SignHS256 fabricates an HS256 identity token for the given mesh context, valid for ttl
+func SignHS256(secret []byte, meshContext *meshcontext.Context, ttl time.Duration) string {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	claims, _ := json.Marshal(meshcontext.Claims{
+		Issuer:       meshcontext.TokenIssuer,
+		Subject:      meshContext.OrgID,
+		IssuedAt:     now.Unix(),
+		NotBefore:    now.Unix(),
+		ExpiresAt:    now.Add(ttl).Unix(),
+		RequestID:    meshContext.RequestID,
+		OrgID:        meshContext.OrgID,
+		OrgDomainUrl: meshContext.OrgDomainUrl,
+		AppUUID:      meshContext.AppUUID,
+		ContextType:  meshContext.ContextType,
+		Resource:     meshContext.Resource,
+		RequestType:  meshContext.RequestType,
+		AuthOutcome:  meshContext.AuthOutcome,
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,97 @@
+package meshcontext
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// Claims are the mesh identity token's JWT claims
+type Claims struct {
+	Issuer       string `json:"iss"`
+	Subject      string `json:"sub,omitempty"`
+	IssuedAt     int64  `json:"iat"`
+	NotBefore    int64  `json:"nbf"`
+	ExpiresAt    int64  `json:"exp"`
+	RequestID    string `json:"jti"`
+	OrgID        string `json:"orgId,omitempty"`
+	OrgDomainUrl string `json:"orgDomainUrl,omitempty"`
+	AppUUID      string `json:"appUuid,omitempty"`
+	ContextType  string `json:"type,omitempty"`
+	Resource     string `json:"resource,omitempty"`
+	RequestType  string `json:"requestType"`
+	AuthOutcome  string `json:"authOutcome"`
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// verifyToken verifies the identity token's signature, issuer and lifetime
+func verifyToken(token string, options Options) (*Context, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Algorithm == "HS256" && len(options.HS256Secret) > 0:
+		mac := hmac.New(sha256.New, options.HS256Secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrInvalidToken
+		}
+	case header.Algorithm == "EdDSA" && len(options.Ed25519PublicKey) == ed25519.PublicKeySize:
+		if !ed25519.Verify(options.Ed25519PublicKey, signingInput, signature) {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := options.Now().Unix()
+	if claims.Issuer != options.Issuer || now < claims.NotBefore || now >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+
+	return &Context{
+		RequestID:    claims.RequestID,
+		OrgID:        claims.OrgID,
+		OrgDomainUrl: claims.OrgDomainUrl,
+		AppUUID:      claims.AppUUID,
+		ContextType:  claims.ContextType,
+		Resource:     claims.Resource,
+		RequestType:  claims.RequestType,
+		AuthOutcome:  claims.AuthOutcome,
+		Verified:     true,
+	}, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	chi "github.com/go-chi/chi/v5"
+	"github.com/heroku/heroku-integration-service-mesh/conf"
 	"github.com/heroku/heroku-integration-service-mesh/mesh"
 )
 
@@ -51,3 +52,13 @@ func NewRouter() chi.Router {
 
 	return rb.router
 }
+
+// NewPrivateRouter builds routes available only on the dyno's private port
+func NewPrivateRouter() chi.Router {
+	router := chi.NewRouter()
+	router.Use(middleware.Recoverer)
+	router.Get(conf.MetricsRoute, mesh.MetricsHandler())
+	router.Get(mesh.JWKSRoute, mesh.JWKSHandler())
+
+	return router
+}
@@ -52,6 +52,31 @@ func Test_InitYamlConfig(t *testing.T) {
 	if yamlConfig.Mesh.HealthCheck.Route == "" {
 		t.Error("Should have Healthcheck enabled")
 	}
+
+	routes := yamlConfig.Mesh.Routes
+	if len(routes) != 2 {
+		t.Fatalf("Should have 2 YamlConfig.Mesh.Routes, got %d", len(routes))
+	}
+
+	if routes[0].Path != "/webhooks/*" || !slices.Contains(routes[0].RequestTypes, conf.RequestTypeDataActionTarget) {
+		t.Errorf("Unexpected route %v", routes[0])
+	}
+
+	if !slices.Contains(routes[0].Methods, "POST") {
+		t.Error("Should have normalized route methods, got " + strings.Join(routes[0].Methods, ", "))
+	}
+
+	if !slices.Contains(routes[1].OrgIDs, "00Dxx0000000000EAA") || !slices.Contains(routes[1].ContextTypes, "ApexCallout") {
+		t.Errorf("Unexpected route %v", routes[1])
+	}
+}
+
+func Test_InvalidRouteRequestType(t *testing.T) {
+	_, err := conf.InitYamlConfig("heroku-integration-service-mesh-invalid-routes.yaml")
+
+	if err == nil {
+		t.Error("Should have invalid route request type error")
+	}
 }
 
 func Test_YamlConfigFileDoesNotExist(t *testing.T) {
@@ -97,7 +122,178 @@ func Test_InitYamlConfigOverrides(t *testing.T) {
 	}
 }
 
+func Test_InitYamlConfigOrgs(t *testing.T) {
+	t.Setenv("HEROKU_INTEGRATION_SERVICE_MESH_ORG_DENYLIST", "00Dxx0000000004EAA, 00Dxx0000000005EAA")
+
+	yamlConfig, err := conf.InitYamlConfig("heroku-integration-service-mesh-orgs.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allow := yamlConfig.Mesh.Orgs.Allow
+	if !slices.Equal(allow, []string{"00Dxx0000000000EAA", "00Dxx0000000002EAA", "00Dxx0000000003EAA"}) {
+		t.Error("Should have YAML and file org allowlist, got " + strings.Join(allow, ", "))
+	}
+
+	deny := yamlConfig.Mesh.Orgs.Deny
+	if !slices.Equal(deny, []string{"00Dxx0000000001EAA", "00Dxx0000000004EAA", "00Dxx0000000005EAA"}) {
+		t.Error("Should have YAML and config var org denylist, got " + strings.Join(deny, ", "))
+	}
+}
+
+func Test_InitYamlConfigRateLimit(t *testing.T) {
+	yamlConfig, err := conf.InitYamlConfig("heroku-integration-service-mesh-overrides.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rateLimit := yamlConfig.Mesh.RateLimit
+	if !rateLimit.Enable || rateLimit.RequestsPerSecond != 5 {
+		t.Errorf("Should have YamlConfig.Mesh.RateLimit override, got %v", rateLimit)
+	}
+
+	if rateLimit.Burst != 5 {
+		t.Errorf("Should have default burst 5, got %d", rateLimit.Burst)
+	}
+
+	_, err = conf.InitYamlConfig("heroku-integration-service-mesh-invalid-ratelimit.yaml")
+	if err == nil {
+		t.Error("Should have invalid rate limit error")
+	}
+}
+
+func Test_InitYamlConfigIdentityToken(t *testing.T) {
+	yamlConfig, err := conf.InitYamlConfig("heroku-integration-service-mesh-overrides.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identityToken := yamlConfig.Mesh.IdentityToken
+	if !identityToken.Enable || identityToken.Algorithm != conf.IdentityTokenAlgorithmHS256 {
+		t.Errorf("Should have YamlConfig.Mesh.IdentityToken override, got %v", identityToken)
+	}
+
+	if identityToken.Header != conf.IdentityTokenHeader || identityToken.TTL != conf.IdentityTokenTTL {
+		t.Errorf("Should have YamlConfig.Mesh.IdentityToken defaults, got %v", identityToken)
+	}
+
+	_, err = conf.InitYamlConfig("heroku-integration-service-mesh-invalid-token.yaml")
+	if err == nil {
+		t.Error("Should have invalid identity token error")
+	}
+}
+
+func Test_InitYamlConfigValidationVerbosity(t *testing.T) {
+	yamlConfig, err := conf.InitYamlConfig("heroku-integration-service-mesh-overrides.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if yamlConfig.Mesh.Validation.Verbosity != conf.ValidationVerbosityMinimal {
+		t.Errorf("Should have default verbosity %s, got %s", conf.ValidationVerbosityMinimal, yamlConfig.Mesh.Validation.Verbosity)
+	}
+
+	t.Setenv("HEROKU_INTEGRATION_SERVICE_MESH_VALIDATION_VERBOSITY", conf.ValidationVerbosityDetailed)
+	yamlConfig, err = conf.InitYamlConfig("heroku-integration-service-mesh-overrides.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if yamlConfig.Mesh.Validation.Verbosity != conf.ValidationVerbosityDetailed {
+		t.Errorf("Should have verbosity %s, got %s", conf.ValidationVerbosityDetailed, yamlConfig.Mesh.Validation.Verbosity)
+	}
+
+	t.Setenv("HEROKU_INTEGRATION_SERVICE_MESH_VALIDATION_VERBOSITY", "verbose")
+	_, err = conf.InitYamlConfig("heroku-integration-service-mesh-overrides.yaml")
+	if err == nil {
+		t.Error("Should have invalid validation verbosity error")
+	}
+}
+
+func Test_InvalidAsyncRoute(t *testing.T) {
+	_, err := conf.InitYamlConfig("heroku-integration-service-mesh-invalid-async.yaml")
+
+	if err == nil {
+		t.Error("Should have invalid async route error")
+	}
+}
+
+func Test_InvalidFanOutRoute(t *testing.T) {
+	_, err := conf.InitYamlConfig("heroku-integration-service-mesh-invalid-fanout.yaml")
+
+	if err == nil {
+		t.Error("Should have invalid async fan-out route error")
+	}
+}
+
+func Test_InvalidIdempotency(t *testing.T) {
+	_, err := conf.InitYamlConfig("heroku-integration-service-mesh-invalid-idempotency.yaml")
+
+	if err == nil {
+		t.Error("Should have missing idempotency path error")
+	}
+}
+
+func Test_InvalidPayloadValidation(t *testing.T) {
+	_, err := conf.InitYamlConfig("heroku-integration-service-mesh-invalid-payload-validation.yaml")
+
+	if err == nil {
+		t.Error("Should have missing payload validation schemaDir error")
+	}
+}
+
+func Test_InvalidOpenAPI(t *testing.T) {
+	_, err := conf.InitYamlConfig("heroku-integration-service-mesh-invalid-openapi.yaml")
+
+	if err == nil {
+		t.Error("Should have missing openApi specFile error")
+	}
+}
+
+func Test_InvalidCompression(t *testing.T) {
+	_, err := conf.InitYamlConfig("heroku-integration-service-mesh-invalid-compression.yaml")
+
+	if err == nil {
+		t.Error("Should have invalid compression encoding error")
+	}
+}
+
 func validateYamlConfigDefaults(t *testing.T, yamlConfig *conf.YamlConfig) {
+	if yamlConfig.Mesh.Authentication.CoreJWTPreValidation.ClockSkew != conf.CoreJWTClockSkew {
+		t.Errorf("Should have default core JWT clock skew %v, got %v", conf.CoreJWTClockSkew,
+			yamlConfig.Mesh.Authentication.CoreJWTPreValidation.ClockSkew)
+	}
+
+	asyncDelivery := yamlConfig.Mesh.AsyncDelivery
+	if asyncDelivery.Dir != conf.AsyncDeliveryDir || asyncDelivery.DeadLetterDir != conf.DeadLetterDir ||
+		asyncDelivery.MaxAttempts != conf.AsyncDeliveryMaxAttempts || asyncDelivery.Timeout != conf.AsyncDeliveryTimeout ||
+		asyncDelivery.MaxQueued != conf.AsyncDeliveryMaxQueued || asyncDelivery.CaptureFailed ||
+		asyncDelivery.MaxDeadLetters != conf.DeadLetterMaxEntries {
+		t.Errorf("Should have default YamlConfig.Mesh.AsyncDelivery, got %v", asyncDelivery)
+	}
+
+	idempotency := yamlConfig.Mesh.Idempotency
+	if idempotency.KeyBy != conf.IdempotencyKeyByDigest || idempotency.Header != conf.IdempotencyHeader ||
+		idempotency.TTL != conf.IdempotencyTTL || idempotency.MaxEntries != conf.IdempotencyMaxEntries {
+		t.Errorf("Should have default YamlConfig.Mesh.Idempotency, got %v", idempotency)
+	}
+
+	compression := yamlConfig.Mesh.Compression
+	if compression.Requests.MaxBytes != conf.CompressionMaxBytes || compression.Requests.MaxRatio != conf.CompressionMaxRatio ||
+		compression.Responses.MinBytes != conf.CompressionMinBytes || len(compression.Responses.Encodings) != 2 ||
+		len(compression.Responses.ContentTypes) == 0 {
+		t.Errorf("Should have default YamlConfig.Mesh.Compression, got %v", compression)
+	}
+
+	upgrade := yamlConfig.Mesh.Upgrade
+	if len(upgrade.Protocols) != 1 || upgrade.Protocols[0] != conf.UpgradeProtocolWebSocket || upgrade.IdleTimeout != conf.UpgradeIdleTimeout {
+		t.Errorf("Should have default YamlConfig.Mesh.Upgrade, got %v", upgrade)
+	}
+
+	if yamlConfig.Mesh.HTTP2.Enable || yamlConfig.Mesh.HTTP2.MaxConcurrentStreams != conf.HTTP2MaxConcurrentStreams {
+		t.Errorf("Should have default YamlConfig.Mesh.HTTP2, got %v", yamlConfig.Mesh.HTTP2)
+	}
+
 	if yamlConfig.App.Port != conf.AppPort {
 		t.Error("Should have default YamlConfig.App.Port " + conf.AppPort + ", got " + yamlConfig.App.Port)
 	}
@@ -115,4 +311,18 @@ func validateYamlConfigDefaults(t *testing.T, yamlConfig *conf.YamlConfig) {
 		t.Error("Should have YamlConfig.Mesh.HeathCheck '" + conf.HealthCheckRoute + "', got " +
 			yamlConfig.Mesh.HealthCheck.Route)
 	}
+
+	identityHeaders := yamlConfig.Mesh.IdentityHeaders
+	if identityHeaders.Enable != "true" {
+		t.Error("Should have YamlConfig.Mesh.IdentityHeaders enabled, got " + identityHeaders.Enable)
+	}
+
+	if identityHeaders.OrgID != conf.IdentityHeaderOrgID || identityHeaders.AuthOutcome != conf.IdentityHeaderAuthOutcome {
+		t.Errorf("Should have default YamlConfig.Mesh.IdentityHeaders, got %v", identityHeaders)
+	}
+
+	// Stripped from client requests even when tokens are disabled
+	if identityToken := yamlConfig.Mesh.IdentityToken; identityToken.Enable || identityToken.Header != conf.IdentityTokenHeader {
+		t.Errorf("Should have default YamlConfig.Mesh.IdentityToken header, got %v", identityToken)
+	}
 }
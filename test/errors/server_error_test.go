@@ -0,0 +1,82 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+)
+
+func Test_KindHttpStatusCode(t *testing.T) {
+	for kind, expected := range map[meshErrors.Kind]int{
+		meshErrors.Internal:            http.StatusInternalServerError,
+		meshErrors.Validation:          http.StatusUnauthorized,
+		meshErrors.Malformed:           http.StatusBadRequest,
+		meshErrors.Unauthenticated:     http.StatusUnauthorized,
+		meshErrors.Forbidden:           http.StatusForbidden,
+		meshErrors.UpstreamAuthFailure: http.StatusBadGateway,
+		meshErrors.AppUnavailable:      http.StatusBadGateway,
+		meshErrors.LimitExceeded:       http.StatusTooManyRequests,
+		meshErrors.Replay:              http.StatusConflict,
+		meshErrors.Unprocessable:       http.StatusUnprocessableEntity,
+		meshErrors.Conflict:            http.StatusConflict,
+	} {
+		if actual := meshErrors.New(kind, "").HttpStatusCode(); actual != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, kind, actual)
+		}
+	}
+}
+
+func Test_ServerErrorIsAs(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("wrapped: %w", meshErrors.Wrap(meshErrors.AppUnavailable, "Failed to forward request to app", cause))
+
+	if !errors.Is(err, meshErrors.AppUnavailable) {
+		t.Error("Expected app-unavailable error")
+	}
+
+	if errors.Is(err, meshErrors.Forbidden) {
+		t.Error("Expected not forbidden error")
+	}
+
+	if !errors.Is(err, cause) {
+		t.Error("Expected error to wrap cause")
+	}
+
+	var serverError *meshErrors.ServerError
+	if !errors.As(err, &serverError) || serverError.Kind != meshErrors.AppUnavailable {
+		t.Errorf("Expected ServerError, got %v", err)
+	}
+
+	if serverError.Error() != "502 Failed to forward request to app: connection refused" {
+		t.Errorf("Unexpected error message '%s'", serverError.Error())
+	}
+}
+
+func Test_ServerErrorDetail(t *testing.T) {
+	if detail := meshErrors.New(meshErrors.Forbidden, "Org not allowed").Detail(); detail != "Org not allowed" {
+		t.Errorf("Expected client error detail, got '%s'", detail)
+	}
+
+	if detail := meshErrors.New(meshErrors.UpstreamAuthFailure, "body").Detail(); detail != "" {
+		t.Errorf("Expected no server error detail, got '%s'", detail)
+	}
+}
+
+func Test_ServerErrorLogValue(t *testing.T) {
+	err := &meshErrors.ServerError{Kind: meshErrors.LimitExceeded, StatusCode: http.StatusServiceUnavailable, Message: "Service overloaded"}
+
+	attrs := map[string]string{}
+	for _, attr := range err.LogValue().Group() {
+		attrs[attr.Key] = attr.Value.String()
+	}
+
+	if attrs["kind"] != "limit-exceeded" || attrs["status"] != "503" || attrs["message"] != "Service overloaded" {
+		t.Errorf("Unexpected log value %v", attrs)
+	}
+
+	var _ slog.LogValuer = err
+}
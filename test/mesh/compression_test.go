@@ -0,0 +1,219 @@
+package mesh
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newCompressionConfig(authUrl string, appUrl string) *conf.Config {
+	config := NewMockConfig(authUrl, appUrl)
+	config.YamlConfig.Mesh.Compression = conf.Compression{
+		Requests: conf.RequestCompression{Enable: true, MaxBytes: 1 << 20, MaxRatio: 100},
+		Responses: conf.ResponseCompression{
+			Enable:       true,
+			Encodings:    []string{conf.CompressionEncodingBrotli, conf.CompressionEncodingGzip},
+			ContentTypes: []string{"application/json", "text/*"},
+			MinBytes:     100,
+		},
+	}
+	return config
+}
+
+func Test_DecompressRequest(t *testing.T) {
+	requests := newCompressionConfig("http://localhost:1", "http://localhost:2").YamlConfig.Mesh.Compression.Requests
+	payload := []byte(`{"events":[{"id":"1"}]}`)
+
+	var deflated bytes.Buffer
+	writer := zlib.NewWriter(&deflated)
+	writer.Write(payload)
+	writer.Close()
+
+	for encoding, body := range map[string][]byte{"": payload, "gzip": gzipBytes(t, payload), "deflate": deflated.Bytes()} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+		req.Header.Set(mesh.HdrContentEncoding, encoding)
+		decompressed, err := mesh.DecompressRequest(MockRequestID, requests, req, body)
+		if err != nil || !bytes.Equal(decompressed, payload) {
+			t.Errorf("Expected %s body decompressed, got %s, %v", encoding, decompressed, err)
+		}
+
+		if req.Header.Get(mesh.HdrContentEncoding) != "" || (encoding != "" && req.ContentLength != int64(len(payload))) {
+			t.Errorf("Expected %s Content-Encoding removed, got '%s' %d", encoding, req.Header.Get(mesh.HdrContentEncoding), req.ContentLength)
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		encoding string
+		body     []byte
+		expected int
+	}{
+		{"bomb", "gzip", gzipBytes(t, make([]byte, 1<<20)), http.StatusRequestEntityTooLarge},
+		{"too large", "gzip", gzipBytes(t, []byte(strings.Repeat("0123456789abcdef", 1<<16+1))), http.StatusRequestEntityTooLarge},
+		{"invalid", "gzip", payload, http.StatusBadRequest},
+		{"unsupported", "br", payload, http.StatusUnsupportedMediaType},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(test.body))
+		req.Header.Set(mesh.HdrContentEncoding, test.encoding)
+		_, err := mesh.DecompressRequest(MockRequestID, requests, req, test.body)
+
+		var serverError *meshErrors.ServerError
+		if !errors.As(err, &serverError) || serverError.HttpStatusCode() != test.expected {
+			t.Errorf("Expected %d for %s body, got %v", test.expected, test.name, err)
+		}
+	}
+}
+
+func Test_NegotiateEncoding(t *testing.T) {
+	encodings := []string{conf.CompressionEncodingBrotli, conf.CompressionEncodingGzip}
+
+	for acceptEncoding, expected := range map[string]string{
+		"":                     "",
+		"identity":             "",
+		"gzip":                 "gzip",
+		"gzip, deflate, br":    "br",
+		"br;q=0.5, gzip;q=0.8": "gzip",
+		"br;q=0, *":            "gzip",
+		"*":                    "br",
+		"gzip;q=0":             "",
+	} {
+		if encoding := mesh.NegotiateEncoding(acceptEncoding, encodings); encoding != expected {
+			t.Errorf("Expected '%s' for '%s', got '%s'", expected, acceptEncoding, encoding)
+		}
+	}
+}
+
+func Test_CompressResponse(t *testing.T) {
+	responses := newCompressionConfig("http://localhost:1", "http://localhost:2").YamlConfig.Mesh.Compression.Responses
+	body := strings.Repeat(`{"hello":"there"}`, 100)
+
+	newResponse := func(contentType string, body string) *http.Response {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{mesh.HdrContentType: {contentType}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}
+	}
+
+	for encoding, decode := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(reader io.Reader) (io.Reader, error) { return gzip.NewReader(reader) },
+		"br":   func(reader io.Reader) (io.Reader, error) { return brotli.NewReader(reader), nil },
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+		req.Header.Set(mesh.HdrAcceptEncoding, encoding)
+		forwardResp := newResponse("application/json; charset=utf-8", body)
+		compressedResp := mesh.CompressResponse(MockRequestID, responses, req, forwardResp)
+
+		if compressedResp.Header.Get(mesh.HdrContentEncoding) != encoding || compressedResp.Header.Get(mesh.HdrVary) != mesh.HdrAcceptEncoding {
+			t.Errorf("Expected %s encoded response, got %v", encoding, compressedResp.Header)
+		}
+
+		if forwardResp.Header.Get(mesh.HdrContentEncoding) != "" {
+			t.Error("Should NOT modify app response")
+		}
+
+		reader, err := decode(compressedResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := io.ReadAll(reader)
+		if err != nil || string(decompressed) != body {
+			t.Errorf("Expected %s response body, got %d bytes, %v", encoding, len(decompressed), err)
+		}
+		compressedResp.Body.Close()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	req.Header.Set(mesh.HdrAcceptEncoding, "gzip")
+	for name, forwardResp := range map[string]*http.Response{
+		"small":        newResponse("application/json", `{}`),
+		"image":        newResponse("image/png", body),
+		"event stream": newResponse("text/event-stream", body),
+	} {
+		if compressedResp := mesh.CompressResponse(MockRequestID, responses, req, forwardResp); compressedResp.Header.Get(mesh.HdrContentEncoding) != "" {
+			t.Errorf("Should NOT compress %s response", name)
+		}
+	}
+
+	encodedResp := newResponse("text/plain", body)
+	encodedResp.Header.Set(mesh.HdrContentEncoding, "br")
+	if compressedResp := mesh.CompressResponse(MockRequestID, responses, req, encodedResp); compressedResp != encodedResp {
+		t.Error("Should NOT compress encoded response")
+	}
+}
+
+func Test_ServiceMeshCompression(t *testing.T) {
+	payload := `{"events":[{"id":"1"}]}`
+	authPayload := ""
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		var authRequestBody mesh.DataActionTargetAuthRequestBody
+		json.NewDecoder(request.Body).Decode(&authRequestBody)
+		authPayload = authRequestBody.Payload
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appPayload := ""
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		appPayload = string(body)
+		if request.Header.Get(mesh.HdrContentEncoding) != "" {
+			t.Errorf("Expected no Content-Encoding, got '%s'", request.Header.Get(mesh.HdrContentEncoding))
+		}
+
+		responseWriter.Header().Set(mesh.HdrContentType, "application/json")
+		responseWriter.Write([]byte(strings.Repeat(`{"ok":true}`, 100)))
+	}))
+	defer appServer.Close()
+
+	serviceMesh := mesh.NewRoutesWithConfig(newCompressionConfig(authServer.URL, appServer.URL)).ServiceMesh()
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader(gzipBytes(t, []byte(payload))))
+	req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	req.Header.Set(mesh.HdrSignature, "signature")
+	req.Header.Set(mesh.HdrContentEncoding, "gzip")
+	req.Header.Set(mesh.HdrAcceptEncoding, "gzip")
+	recorder := httptest.NewRecorder()
+	serviceMesh(recorder, req)
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get(mesh.HdrContentEncoding) != "gzip" {
+		t.Fatalf("Expected gzip encoded 200, got %d %v", recorder.Code, recorder.Header())
+	}
+
+	if authPayload != payload || appPayload != payload {
+		t.Errorf("Expected decompressed payload authenticated and forwarded, got '%s' and '%s'", authPayload, appPayload)
+	}
+
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(reader); string(body) != strings.Repeat(`{"ok":true}`, 100) {
+		t.Errorf("Unexpected response body %s", body)
+	}
+}
@@ -0,0 +1,217 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_ConcurrencyLimiterGlobalLimit(t *testing.T) {
+	concurrency := conf.Concurrency{Enable: true, MaxInFlight: 1, QueueSize: 1, QueueTimeout: time.Second}
+	limiter := mesh.NewConcurrencyLimiter()
+
+	release, err := limiter.Acquire(context.Background(), concurrency, MockOrgID18)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queued until first request is released
+	admitted := make(chan func())
+	go func() {
+		queuedRelease, err := limiter.Acquire(context.Background(), concurrency, MockOtherOrgID18)
+		if err != nil {
+			t.Error(err)
+		}
+		admitted <- queuedRelease
+	}()
+
+	// Queue is full
+	time.Sleep(50 * time.Millisecond)
+	_, err = limiter.Acquire(context.Background(), concurrency, MockOrgID18)
+	if !errors.Is(err, mesh.ErrQueueFull) {
+		t.Errorf("Expected %v, got %v", mesh.ErrQueueFull, err)
+	}
+
+	release()
+	select {
+	case queuedRelease := <-admitted:
+		queuedRelease()
+	case <-time.After(time.Second):
+		t.Fatal("Queued request should be admitted")
+	}
+}
+
+func Test_ConcurrencyLimiterQueueTimeout(t *testing.T) {
+	concurrency := conf.Concurrency{Enable: true, MaxInFlight: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond}
+	limiter := mesh.NewConcurrencyLimiter()
+
+	release, err := limiter.Acquire(context.Background(), concurrency, MockOrgID18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	_, err = limiter.Acquire(context.Background(), concurrency, MockOrgID18)
+	if !errors.Is(err, mesh.ErrQueueTimeout) {
+		t.Errorf("Expected %v, got %v", mesh.ErrQueueTimeout, err)
+	}
+}
+
+func Test_ConcurrencyLimiterPerOrgLimit(t *testing.T) {
+	concurrency := conf.Concurrency{Enable: true, MaxInFlight: 2, MaxInFlightPerOrg: 1, QueueTimeout: time.Second}
+	limiter := mesh.NewConcurrencyLimiter()
+
+	release, err := limiter.Acquire(context.Background(), concurrency, MockOrgID18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Org at its limit, no queue
+	_, err = limiter.Acquire(context.Background(), concurrency, MockOrgID18)
+	if !errors.Is(err, mesh.ErrQueueFull) {
+		t.Errorf("Expected %v, got %v", mesh.ErrQueueFull, err)
+	}
+
+	// 15 and 18-character org IDs are the same org
+	_, err = limiter.Acquire(context.Background(), concurrency, MockOrgID15)
+	if !errors.Is(err, mesh.ErrQueueFull) {
+		t.Errorf("Expected %v for 15-character org ID, got %v", mesh.ErrQueueFull, err)
+	}
+
+	// Other orgs are admitted
+	otherRelease, err := limiter.Acquire(context.Background(), concurrency, MockOtherOrgID18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRelease()
+}
+
+func Test_ConcurrencyLimiterAdaptive(t *testing.T) {
+	concurrency := conf.Concurrency{
+		Enable:      true,
+		MaxInFlight: 10,
+		Adaptive: conf.AdaptiveConcurrency{
+			Enable:           true,
+			MinLimit:         2,
+			LatencyThreshold: time.Second,
+			DecreaseFactor:   0.5,
+			Window:           time.Second,
+		},
+	}
+	limiter := mesh.NewConcurrencyLimiter()
+	now := time.Now()
+
+	// A burst of slow app responses decreases the limit once per window
+	for i := 0; i < 5; i++ {
+		limiter.ObserveLatency(concurrency, 2*time.Second, now)
+	}
+
+	if limiter.Limit() != 5 {
+		t.Errorf("Expected limit 5, got %d", limiter.Limit())
+	}
+
+	// Slow app responses decrease the limit to minimum
+	for i := 1; i <= 5; i++ {
+		limiter.ObserveLatency(concurrency, 2*time.Second, now.Add(time.Duration(i)*time.Second))
+	}
+
+	if limiter.Limit() != 2 {
+		t.Errorf("Expected limit 2, got %d", limiter.Limit())
+	}
+
+	// Fast app responses increase the limit
+	for i := 0; i < 10; i++ {
+		limiter.ObserveLatency(concurrency, time.Millisecond, now)
+	}
+
+	if limiter.Limit() <= 2 {
+		t.Errorf("Expected limit greater than 2, got %d", limiter.Limit())
+	}
+}
+
+func Test_ServiceMeshConcurrencyLatencyExcludesStreaming(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	// The app responds with headers immediately, then streams slowly
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Set(mesh.HdrContentType, mesh.ContentTypeEventStream)
+		responseWriter.WriteHeader(http.StatusOK)
+		responseWriter.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		responseWriter.Write([]byte("data: done\n\n"))
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.Concurrency = conf.Concurrency{
+		Enable:       true,
+		MaxInFlight:  10,
+		QueueTimeout: time.Second,
+		Adaptive: conf.AdaptiveConcurrency{
+			Enable:           true,
+			MinLimit:         1,
+			LatencyThreshold: 50 * time.Millisecond,
+			DecreaseFactor:   0.5,
+			Window:           time.Second,
+		},
+	}
+	meshServer := httptest.NewServer(mesh.NewRoutesWithConfig(config).ServiceMesh())
+	defer meshServer.Close()
+
+	resp, err := http.DefaultClient.Do(newStreamingRequest(t, context.Background(), meshServer.URL+"/events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if limit := mesh.GetMetrics().Gauge(mesh.MetricConcurrencyLimit); limit != 10 {
+		t.Errorf("Expected limit 10, got %v", limit)
+	}
+}
+
+func Test_ConcurrencyLimiterLimitRequest(t *testing.T) {
+	config := &conf.Config{
+		YamlConfig: &conf.YamlConfig{
+			Mesh: conf.Mesh{
+				Concurrency: conf.Concurrency{Enable: true, MaxInFlight: 1, QueueTimeout: 2 * time.Second},
+			},
+		},
+	}
+	limiter := mesh.NewConcurrencyLimiter()
+	incomingReq, err := http.NewRequest(http.MethodPost, "/my-api", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := limiter.LimitRequest(MockRequestID, config, MockOrgID18, httptest.NewRecorder(), incomingReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	incomingRespWriter := httptest.NewRecorder()
+	_, err = limiter.LimitRequest(MockRequestID, config, MockOrgID18, incomingRespWriter, incomingReq)
+	if err == nil {
+		t.Fatal("Expected request to be shed")
+	}
+
+	if err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d, got %d", http.StatusServiceUnavailable, err.(*mesh.InvalidRequest).HttpStatusCode())
+	}
+
+	if incomingRespWriter.Header().Get(mesh.HdrRetryAfter) != "2" {
+		t.Errorf("Expected Retry-After 2, got '%s'", incomingRespWriter.Header().Get(mesh.HdrRetryAfter))
+	}
+}
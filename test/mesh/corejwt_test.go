@@ -0,0 +1,108 @@
+package mesh
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+var MockCoreJWTPreValidation = conf.CoreJWTPreValidation{Enable: true, ClockSkew: 30 * time.Second}
+
+func newCoreJWT(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claimsJson, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claimsJson) + ".signature"
+}
+
+func Test_PreValidateCoreJWT(t *testing.T) {
+	now := time.Now()
+	valid := map[string]any{
+		"iss":   MockValidXRequestContext.LoginUrl,
+		"aud":   []string{MockValidXRequestContext.OrgDomainUrl},
+		"exp":   now.Add(time.Minute).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+		"orgId": MockOrgID18[:15],
+	}
+	with := func(key string, value any) map[string]any {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", newCoreJWT(valid), true},
+		{"audience string", newCoreJWT(with("aud", MockOrgID18)), true},
+		{"expired within skew", newCoreJWT(with("exp", now.Add(-10*time.Second).Unix())), true},
+		{"not a JWT", "auth", false},
+		{"unsigned", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + ".e30.", false},
+		{"expired", newCoreJWT(with("exp", now.Add(-time.Minute).Unix())), false},
+		{"missing exp", newCoreJWT(with("exp", nil)), false},
+		{"not yet valid", newCoreJWT(with("nbf", now.Add(time.Minute).Unix())), false},
+		{"issuer mismatch", newCoreJWT(with("iss", "https://evil.example.com")), false},
+		{"audience mismatch", newCoreJWT(with("aud", "https://evil.example.com")), false},
+		{"org mismatch", newCoreJWT(with("orgId", "00Dxx0000000001EAA")), false},
+	}
+
+	for _, test := range tests {
+		requestContext := *MockValidXRequestContext
+		requestContext.Auth = test.token
+
+		err := mesh.PreValidateCoreJWT(MockRequestID, MockCoreJWTPreValidation, &requestContext, now)
+		if test.valid && err != nil {
+			t.Errorf("%s: expected valid, got %v", test.name, err)
+		}
+
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: expected invalid", test.name)
+			} else if err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusUnauthorized {
+				t.Errorf("%s: expected %d, got %d", test.name, http.StatusUnauthorized, err.(*mesh.InvalidRequest).HttpStatusCode())
+			}
+		}
+	}
+}
+
+func Test_AuthenticateSkipsRemoteAuthForInvalidCoreJWT(t *testing.T) {
+	authRequests := 0
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		authRequests++
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	config := NewMockConfig(authServer.URL, authServer.URL)
+	config.YamlConfig.Mesh.Authentication.CoreJWTPreValidation = MockCoreJWTPreValidation
+
+	requestHeader := &mesh.RequestHeader{
+		XRequestID:          MockRequestID,
+		XRequestContext:     *MockValidXRequestContext,
+		IsSalesforceRequest: true,
+	}
+	incomingReq := httptest.NewRequest(http.MethodPost, "/my-api", nil)
+
+	err := mesh.Authenticate(MockRequestID, config, requestHeader, incomingReq, nil)
+	if err == nil || err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %v", http.StatusUnauthorized, err)
+	}
+
+	if authRequests != 0 {
+		t.Errorf("Expected no Heroku Integration auth requests, got %d", authRequests)
+	}
+}
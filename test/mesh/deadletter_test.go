@@ -0,0 +1,200 @@
+package mesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_RequestStore(t *testing.T) {
+	store := mesh.NewRequestStore(t.TempDir())
+	first, second := newStoredRequest(t), newStoredRequest(t)
+	for _, storedRequest := range []*mesh.StoredRequest{second, first} {
+		if err := store.Put(storedRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storedRequests, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(storedRequests) != 2 || storedRequests[0].ID != first.ID || storedRequests[1].ID != second.ID {
+		t.Errorf("Expected stored requests oldest first, got %v", storedRequests)
+	}
+
+	storedRequest, err := store.Get(first.ID)
+	if err != nil || string(storedRequest.Body) != string(first.Body) || storedRequest.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected stored request %v: %v", storedRequest, err)
+	}
+
+	if _, err := store.Get("../" + first.ID); !errors.Is(err, mesh.ErrStoredRequestNotFound) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+
+	if err := store.Delete(first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(first.ID); !errors.Is(err, mesh.ErrStoredRequestNotFound) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func Test_ServiceMeshDeadLettersFailedDataActionTargetRequests(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appStatus := http.StatusServiceUnavailable
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(appStatus)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.HerokuIntegrationUrl = authServer.URL
+	routes := mesh.NewRoutesWithConfig(config)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(`{"events":[]}`)))
+	req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	req.Header.Set(mesh.HdrSignature, "signature")
+	recorder := httptest.NewRecorder()
+	routes.ServiceMesh()(recorder, req)
+	routes.FlushDeadLetters()
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+
+	deadLetters := mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.DeadLetterDir)
+	storedRequests, err := deadLetters.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(storedRequests) != 1 {
+		t.Fatalf("Expected 1 dead-lettered request, got %d", len(storedRequests))
+	}
+
+	storedRequest := storedRequests[0]
+	if storedRequest.Reason != "app responded 503" || storedRequest.OrgID != MockOrgID18 || storedRequest.RequestID != MockRequestID {
+		t.Errorf("Unexpected dead letter %+v", storedRequest)
+	}
+
+	if string(storedRequest.Body) != `{"events":[]}` || storedRequest.Header.Get(mesh.HdrSignature) != "signature" {
+		t.Errorf("Unexpected dead-lettered request %s %v", storedRequest.Body, storedRequest.Header)
+	}
+
+	// Replay fails again
+	client := &http.Client{}
+	statusCode, err := mesh.ReplayDeadLetter(context.Background(), config, client, deadLetters, storedRequest, nil)
+	if err == nil || statusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected replay failure, got %d: %v", statusCode, err)
+	}
+
+	if storedRequest, err = deadLetters.Get(storedRequest.ID); err != nil || storedRequest.Attempts != 2 {
+		t.Errorf("Expected dead letter retained, got %v: %v", storedRequest, err)
+	}
+
+	// Replay succeeds
+	appStatus = http.StatusOK
+	statusCode, err = mesh.ReplayDeadLetter(context.Background(), config, client, deadLetters, storedRequest, nil)
+	if err != nil || statusCode != http.StatusOK {
+		t.Errorf("Expected replay, got %d: %v", statusCode, err)
+	}
+
+	if _, err := deadLetters.Get(storedRequest.ID); !errors.Is(err, mesh.ErrStoredRequestNotFound) {
+		t.Errorf("Expected dead letter removed, got %v", err)
+	}
+}
+
+func Test_ServiceMeshDeadLettersOnlyDataActionTargetRequests(t *testing.T) {
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.ShouldBypassAllRoutes = true
+	routes := mesh.NewRoutesWithConfig(config)
+	routes.ServiceMesh()(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/my-api", nil))
+	routes.FlushDeadLetters()
+
+	storedRequests, _ := mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.DeadLetterDir).List()
+	if len(storedRequests) != 0 {
+		t.Errorf("Expected no dead-lettered requests, got %d", len(storedRequests))
+	}
+}
+
+func Test_ServiceMeshDeadLetterCapture(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("apiName") == "Slow" {
+			io.ReadAll(request.Body)
+			<-request.Context().Done()
+			return
+		}
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer appServer.Close()
+
+	newRequest := func(ctx context.Context, apiName string, payload string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName="+apiName, bytes.NewReader([]byte(payload))).WithContext(ctx)
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, "signature")
+		return req
+	}
+
+	// Not captured unless enabled
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.HerokuIntegrationUrl = authServer.URL
+	config.YamlConfig.Mesh.AsyncDelivery.CaptureFailed = false
+	routes := mesh.NewRoutesWithConfig(config)
+	routes.ServiceMesh()(httptest.NewRecorder(), newRequest(context.Background(), "DAT", `{}`))
+	routes.FlushDeadLetters()
+
+	deadLetters := mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.DeadLetterDir)
+	if count, _ := deadLetters.Count(); count != 0 {
+		t.Errorf("Expected no dead letters when not enabled, got %d", count)
+	}
+
+	// Captured up to the store's limit
+	config.YamlConfig.Mesh.AsyncDelivery.CaptureFailed = true
+	config.YamlConfig.Mesh.AsyncDelivery.MaxDeadLetters = 2
+	routes = mesh.NewRoutesWithConfig(config)
+	for i := 0; i < 3; i++ {
+		routes.ServiceMesh()(httptest.NewRecorder(), newRequest(context.Background(), "DAT", `{"i":`+strconv.Itoa(i)+`}`))
+	}
+
+	routes.FlushDeadLetters()
+	if count, _ := deadLetters.Count(); count != 2 {
+		t.Errorf("Expected 2 dead letters, got %d", count)
+	}
+
+	// Requests canceled by the client are NOT captured
+	config.YamlConfig.Mesh.AsyncDelivery.MaxDeadLetters = 10
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	routes = mesh.NewRoutesWithConfig(config)
+	routes.ServiceMesh()(httptest.NewRecorder(), newRequest(ctx, "Slow", `{}`))
+
+	routes.FlushDeadLetters()
+	if count, _ := deadLetters.Count(); count != 2 {
+		t.Errorf("Expected canceled request NOT dead-lettered, got %d dead letters", count)
+	}
+}
@@ -0,0 +1,316 @@
+package mesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func newAsyncDeliveryConfig(t *testing.T, appUrl string) *conf.Config {
+	config := NewMockConfig(appUrl, appUrl)
+	dir := t.TempDir()
+	config.YamlConfig.Mesh.AsyncDelivery = conf.AsyncDelivery{
+		Dir:            filepath.Join(dir, "queue"),
+		DeadLetterDir:  filepath.Join(dir, "dead-letter"),
+		MaxAttempts:    2,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Timeout:        time.Second,
+		MaxParallel:    2,
+		MaxQueued:      10,
+		CaptureFailed:  true,
+		MaxDeadLetters: 10,
+	}
+	return config
+}
+
+func newStoredRequest(t *testing.T) *mesh.StoredRequest {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18, nil)
+	req.Header.Set("Content-Type", "application/json")
+	return mesh.NewStoredRequest(MockRequestID, MockOrgID18, "/webhooks/*", req, []byte(`{"events":[]}`), nil)
+}
+
+func Test_AsyncDeliveryBackoff(t *testing.T) {
+	asyncDelivery := conf.AsyncDelivery{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempts, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if actual := mesh.AsyncDeliveryBackoff(asyncDelivery, attempts); actual != expected {
+			t.Errorf("Expected %v after %d attempts, got %v", expected, attempts, actual)
+		}
+	}
+}
+
+func Test_AsyncDeliveryDelivers(t *testing.T) {
+	var body, uri string
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		data, _ := io.ReadAll(request.Body)
+		body, uri = string(data), request.URL.RequestURI()
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	asyncDelivery := mesh.NewAsyncDelivery(config, http.DefaultTransport, mesh.NewConcurrencyLimiter(), nil)
+	if err := asyncDelivery.Enqueue(newStoredRequest(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	if next := asyncDelivery.DeliverDue(time.Now()); !next.IsZero() {
+		t.Errorf("Expected empty queue, next attempt at %v", next)
+	}
+
+	if body != `{"events":[]}` || uri != "/webhooks/dataChange?orgId="+MockOrgID18 {
+		t.Errorf("Unexpected delivered request %s %s", uri, body)
+	}
+
+	queued, _ := mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.Dir).List()
+	if len(queued) != 0 {
+		t.Errorf("Expected empty queue, got %d", len(queued))
+	}
+}
+
+func Test_AsyncDeliveryRetriesAndDeadLetters(t *testing.T) {
+	appRequests := 0
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appRequests++
+		responseWriter.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	asyncDelivery := mesh.NewAsyncDelivery(config, http.DefaultTransport, mesh.NewConcurrencyLimiter(), nil)
+	storedRequest := newStoredRequest(t)
+	if err := asyncDelivery.Enqueue(storedRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	next := asyncDelivery.DeliverDue(now)
+	if !next.Equal(now.Add(time.Second)) {
+		t.Errorf("Expected retry in 1s, got %v", next.Sub(now))
+	}
+
+	// Not yet due
+	asyncDelivery.DeliverDue(now.Add(500 * time.Millisecond))
+	if appRequests != 1 {
+		t.Errorf("Expected 1 app request, got %d", appRequests)
+	}
+
+	if next := asyncDelivery.DeliverDue(now.Add(time.Second)); !next.IsZero() {
+		t.Errorf("Expected empty queue, next attempt at %v", next)
+	}
+
+	deadLetters, err := mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.DeadLetterDir).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deadLetters) != 1 || deadLetters[0].ID != storedRequest.ID || deadLetters[0].Attempts != 2 {
+		t.Fatalf("Expected dead-lettered request, got %v", deadLetters)
+	}
+
+	if !strings.Contains(deadLetters[0].Reason, "503") || deadLetters[0].OrgID != MockOrgID18 {
+		t.Errorf("Unexpected dead letter %+v", deadLetters[0])
+	}
+}
+
+func Test_AsyncDeliveryDeliversInParallel(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan string, 2)
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("apiName") == "Slow" {
+			<-release
+		}
+		delivered <- request.URL.Query().Get("apiName")
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	asyncDelivery := mesh.NewAsyncDelivery(config, http.DefaultTransport, mesh.NewConcurrencyLimiter(), nil)
+	for _, apiName := range []string{"Slow", "Fast"} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName="+apiName, nil)
+		if err := asyncDelivery.Enqueue(mesh.NewStoredRequest(MockRequestID, MockOrgID18, "/webhooks/*", req, nil, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		asyncDelivery.DeliverDue(time.Now())
+		close(done)
+	}()
+
+	// A slow app request does NOT delay other requests
+	select {
+	case apiName := <-delivered:
+		if apiName != "Fast" {
+			t.Errorf("Expected Fast delivered first, got %s", apiName)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Fast delivered while Slow in flight")
+	}
+
+	// Requests being delivered are NOT delivered again
+	if next := asyncDelivery.DeliverDue(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no other queued requests, next attempt at %v", next)
+	}
+
+	close(release)
+	<-done
+	if len(delivered) != 1 {
+		t.Errorf("Expected Slow delivered once, got %d deliveries", len(delivered))
+	}
+}
+
+func Test_AsyncDeliveryConcurrencyLimit(t *testing.T) {
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.YamlConfig.Mesh.Concurrency = conf.Concurrency{Enable: true, MaxInFlight: 1, QueueTimeout: time.Second}
+	limiter := mesh.NewConcurrencyLimiter()
+	asyncDelivery := mesh.NewAsyncDelivery(config, http.DefaultTransport, limiter, nil)
+	if err := asyncDelivery.Enqueue(newStoredRequest(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deferred, without counting the attempt, while the app is at capacity
+	release, err := limiter.Acquire(context.Background(), config.YamlConfig.Mesh.Concurrency, MockOtherOrgID18)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if next := asyncDelivery.DeliverDue(now); !next.Equal(now.Add(time.Second)) {
+		t.Errorf("Expected delivery deferred 1s, got %v", next.Sub(now))
+	}
+
+	queued, _ := mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.Dir).List()
+	if len(queued) != 1 || queued[0].Attempts != 0 {
+		t.Errorf("Expected request queued without attempts, got %v", queued)
+	}
+
+	release()
+	if next := asyncDelivery.DeliverDue(now); !next.IsZero() {
+		t.Errorf("Expected empty queue, next attempt at %v", next)
+	}
+}
+
+func Test_ServiceMeshAsyncRoute(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	delivered := make(chan string, 1)
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		delivered <- string(body)
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.HerokuIntegrationUrl = authServer.URL
+	config.YamlConfig.Mesh.Routes = []conf.Route{{Path: "/webhooks/*", Async: true}}
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(`{"events":[]}`)))
+	req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	req.Header.Set(mesh.HdrSignature, "signature")
+	recorder := httptest.NewRecorder()
+	serviceMesh(recorder, req)
+
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected %d, got %d", http.StatusAccepted, recorder.Code)
+	}
+
+	select {
+	case body := <-delivered:
+		if body != `{"events":[]}` {
+			t.Errorf("Unexpected delivered body %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected request delivered to app")
+	}
+}
+
+func Test_AsyncDeliveryMaxQueued(t *testing.T) {
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.YamlConfig.Mesh.AsyncDelivery.MaxQueued = 1
+	asyncDelivery := mesh.NewAsyncDelivery(config, http.DefaultTransport, mesh.NewConcurrencyLimiter(), nil)
+	if err := asyncDelivery.Enqueue(newStoredRequest(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := asyncDelivery.Enqueue(newStoredRequest(t)); !errors.Is(err, mesh.ErrAsyncQueueFull) {
+		t.Errorf("Expected %v, got %v", mesh.ErrAsyncQueueFull, err)
+	}
+
+	// Delivered requests free the queue
+	asyncDelivery.DeliverDue(time.Now())
+	if err := asyncDelivery.Enqueue(newStoredRequest(t)); err != nil {
+		t.Errorf("Expected request queued after delivery, got %v", err)
+	}
+
+	// Requests queued before a restart count towards the limit
+	restarted := mesh.NewAsyncDelivery(config, http.DefaultTransport, mesh.NewConcurrencyLimiter(), nil)
+	if err := restarted.Enqueue(newStoredRequest(t)); !errors.Is(err, mesh.ErrAsyncQueueFull) {
+		t.Errorf("Expected %v after restart, got %v", mesh.ErrAsyncQueueFull, err)
+	}
+}
+
+func Test_ServiceMeshAsyncRouteQueueFull(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	// The app is down
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.HerokuIntegrationUrl = authServer.URL
+	config.YamlConfig.Mesh.AsyncDelivery.MaxQueued = 1
+	config.YamlConfig.Mesh.Routes = []conf.Route{{Path: "/webhooks/*", Async: true}}
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	var recorders []*httptest.ResponseRecorder
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(`{"i":`+strconv.Itoa(i)+`}`)))
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, "signature")
+		recorder := httptest.NewRecorder()
+		serviceMesh(recorder, req)
+		recorders = append(recorders, recorder)
+	}
+
+	if recorders[0].Code != http.StatusAccepted {
+		t.Errorf("Expected %d, got %d", http.StatusAccepted, recorders[0].Code)
+	}
+
+	if recorders[1].Code != http.StatusServiceUnavailable || recorders[1].Header().Get(mesh.HdrRetryAfter) != "1" {
+		t.Errorf("Expected %d with Retry-After, got %d %v", http.StatusServiceUnavailable, recorders[1].Code, recorders[1].Header())
+	}
+}
@@ -0,0 +1,219 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_SplitEvents(t *testing.T) {
+	events, ok := mesh.SplitEvents([]byte(`{"events":[{"id":1},{"id":2}]}`))
+	if !ok || len(events) != 2 || string(events[1]) != `{"id":2}` {
+		t.Errorf("Unexpected events %s", events)
+	}
+
+	if events, ok := mesh.SplitEvents([]byte(`{"events":[]}`)); !ok || len(events) != 0 {
+		t.Errorf("Expected empty events, got %s", events)
+	}
+
+	for _, payload := range []string{`{}`, `{"events":{}}`, `not json`} {
+		if _, ok := mesh.SplitEvents([]byte(payload)); ok {
+			t.Errorf("Expected no events in %s", payload)
+		}
+	}
+}
+
+func Test_FanOutResponseStatusCode(t *testing.T) {
+	for expected, fanOutResponse := range map[int]mesh.FanOutResponse{
+		http.StatusOK:          {Succeeded: 2},
+		http.StatusMultiStatus: {Succeeded: 1, Failed: 1},
+		http.StatusBadGateway:  {Failed: 2},
+	} {
+		if actual := fanOutResponse.StatusCode(); actual != expected {
+			t.Errorf("Expected %d, got %d", expected, actual)
+		}
+	}
+}
+
+// serveFanOut serves a batch of events to a fan-out route, waiting for failed events to be dead-lettered, returning
+// the app's events, in the order received
+func serveFanOut(t *testing.T, fanOut conf.FanOut, payload string) (*httptest.ResponseRecorder, []string, *conf.Config) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(authServer.Close)
+
+	var mu sync.Mutex
+	var received []string
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		mu.Lock()
+		received = append(received, request.Header.Get(mesh.HdrEventIndex)+":"+string(body))
+		mu.Unlock()
+
+		if bytes.Contains(body, []byte("fail")) {
+			responseWriter.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(appServer.Close)
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.HerokuIntegrationUrl = authServer.URL
+	config.YamlConfig.Mesh.Routes = []conf.Route{{Path: "/webhooks/*", FanOut: &fanOut}}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(payload)))
+	req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	req.Header.Set(mesh.HdrSignature, "signature")
+	recorder := httptest.NewRecorder()
+	routes := mesh.NewRoutesWithConfig(config)
+	routes.ServiceMesh()(recorder, req)
+	routes.FlushDeadLetters()
+
+	return recorder, received, config
+}
+
+func Test_ServiceMeshFanOut(t *testing.T) {
+	recorder, received, config := serveFanOut(t, conf.FanOut{Enable: true, MaxParallel: 2},
+		`{"events":[{"id":0},{"id":1,"fail":true},{"id":2}]}`)
+
+	if recorder.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected %d, got %d", http.StatusMultiStatus, recorder.Code)
+	}
+
+	slices.Sort(received)
+	if !slices.Equal(received, []string{`0:{"id":0}`, `1:{"id":1,"fail":true}`, `2:{"id":2}`}) {
+		t.Errorf("Unexpected app events %v", received)
+	}
+
+	var fanOutResponse mesh.FanOutResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &fanOutResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	if fanOutResponse.Succeeded != 2 || fanOutResponse.Failed != 1 || len(fanOutResponse.Results) != 3 {
+		t.Fatalf("Unexpected fan-out response %s", recorder.Body.String())
+	}
+
+	for i, result := range fanOutResponse.Results {
+		expected := http.StatusOK
+		if i == 1 {
+			expected = http.StatusInternalServerError
+		}
+		if result.Index != i || result.Status != expected {
+			t.Errorf("Unexpected result %v", result)
+		}
+	}
+
+	if string(fanOutResponse.Results[0].Body) != `{"ok":true}` {
+		t.Errorf("Expected app response body, got %s", fanOutResponse.Results[0].Body)
+	}
+
+	// Failed events are dead-lettered
+	deadLetters, _ := mesh.NewRequestStore(config.YamlConfig.Mesh.AsyncDelivery.DeadLetterDir).List()
+	if len(deadLetters) != 1 || string(deadLetters[0].Body) != `{"id":1,"fail":true}` {
+		t.Errorf("Expected failed event dead-lettered, got %v", deadLetters)
+	}
+}
+
+func Test_ServiceMeshFanOutOrdered(t *testing.T) {
+	payload := `{"events":[`
+	var expected []string
+	for i := range 10 {
+		if i > 0 {
+			payload += ","
+		}
+		payload += strconv.Itoa(i)
+		expected = append(expected, strconv.Itoa(i)+":"+strconv.Itoa(i))
+	}
+	payload += `]}`
+
+	recorder, received, _ := serveFanOut(t, conf.FanOut{Enable: true, MaxParallel: 4, Ordered: true}, payload)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	if !slices.Equal(received, expected) {
+		t.Errorf("Expected events in order, got %v", received)
+	}
+}
+
+func Test_ServiceMeshFanOutWithoutEvents(t *testing.T) {
+	recorder, received, _ := serveFanOut(t, conf.FanOut{Enable: true, MaxParallel: 1}, `{"id":0}`)
+	if recorder.Code != http.StatusOK || len(received) != 1 || received[0] != `:{"id":0}` {
+		t.Errorf("Expected payload forwarded as is, got %d %v", recorder.Code, received)
+	}
+}
+
+func Test_ServiceMeshFanOutConcurrencyLimit(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.Routes = []conf.Route{{Path: "/webhooks/*", FanOut: &conf.FanOut{Enable: true, MaxParallel: 4}}}
+	config.YamlConfig.Mesh.Concurrency = conf.Concurrency{
+		Enable:       true,
+		MaxInFlight:  2,
+		QueueSize:    10,
+		QueueTimeout: 5 * time.Second,
+		Adaptive: conf.AdaptiveConcurrency{
+			Enable:           true,
+			MinLimit:         1,
+			LatencyThreshold: 10 * time.Millisecond,
+			DecreaseFactor:   0.5,
+			Window:           time.Minute,
+		},
+	}
+
+	payload := `{"events":[{"id":0},{"id":1},{"id":2},{"id":3},{"id":4},{"id":5}]}`
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(payload)))
+	req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	req.Header.Set(mesh.HdrSignature, "signature")
+	recorder := httptest.NewRecorder()
+	mesh.NewRoutesWithConfig(config).ServiceMesh()(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	// Each event holds a concurrency slot
+	if maxInFlight > 2 {
+		t.Errorf("Expected at most 2 events in flight, got %d", maxInFlight)
+	}
+
+	// Each event's latency adapts the limit
+	if limit := mesh.GetMetrics().Gauge(mesh.MetricConcurrencyLimit); limit != 1 {
+		t.Errorf("Expected limit 1, got %v", limit)
+	}
+}
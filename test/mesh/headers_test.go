@@ -0,0 +1,185 @@
+package mesh
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_RemoveHopByHopHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  http.Header
+		expected http.Header
+	}{
+		{
+			"standard hop-by-hop headers",
+			http.Header{
+				"Connection":        {"keep-alive"},
+				"Keep-Alive":        {"timeout=5"},
+				"Te":                {"trailers"},
+				"Transfer-Encoding": {"chunked"},
+				"Upgrade":           {"websocket"},
+				"Content-Type":      {"application/json"},
+			},
+			http.Header{"Content-Type": {"application/json"}},
+		},
+		{
+			"headers listed in Connection",
+			http.Header{
+				"Connection":   {"X-Hop, X-Other-Hop", "close"},
+				"X-Hop":        {"1"},
+				"X-Other-Hop":  {"2"},
+				"X-End-To-End": {"3"},
+			},
+			http.Header{"X-End-To-End": {"3"}},
+		},
+		{
+			"no hop-by-hop headers",
+			http.Header{"Accept": {"text/html", "application/json"}},
+			http.Header{"Accept": {"text/html", "application/json"}},
+		},
+	}
+
+	for _, test := range tests {
+		mesh.RemoveHopByHopHeaders(test.headers)
+		if len(test.headers) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, test.headers)
+			continue
+		}
+
+		for header, values := range test.expected {
+			if !slices.Equal(test.headers.Values(header), values) {
+				t.Errorf("%s: expected %s %v, got %v", test.name, header, values, test.headers.Values(header))
+			}
+		}
+	}
+}
+
+func Test_SetForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name            string
+		remoteAddr      string
+		tls             bool
+		headers         http.Header
+		xForwardedFor   string
+		xForwardedProto string
+		xForwardedHost  string
+		forwarded       string
+	}{
+		{
+			"direct request",
+			"10.0.0.1:5555", false,
+			http.Header{},
+			"10.0.0.1", "http", "example.com",
+			"for=10.0.0.1;host=example.com;proto=http",
+		},
+		{
+			"direct TLS request",
+			"10.0.0.1:5555", true,
+			http.Header{},
+			"10.0.0.1", "https", "example.com",
+			"for=10.0.0.1;host=example.com;proto=https",
+		},
+		{
+			"behind Heroku router",
+			"10.0.0.1:5555", false,
+			http.Header{
+				"X-Forwarded-For":   {"203.0.113.7, 10.1.1.1"},
+				"X-Forwarded-Proto": {"https"},
+			},
+			"203.0.113.7, 10.1.1.1", "https", "example.com",
+			"for=203.0.113.7;host=example.com;proto=https",
+		},
+		{
+			"IPv6 client and existing Forwarded",
+			"[2001:db8::1]:5555", false,
+			http.Header{"Forwarded": {"for=192.0.2.60"}},
+			"2001:db8::1", "http", "example.com",
+			`for=192.0.2.60, for="[2001:db8::1]";host=example.com;proto=http`,
+		},
+	}
+
+	for _, test := range tests {
+		incomingReq := httptest.NewRequest(http.MethodGet, "http://example.com/my-api", nil)
+		incomingReq.RemoteAddr = test.remoteAddr
+		if test.tls {
+			incomingReq.TLS = &tls.ConnectionState{}
+		}
+
+		mesh.SetForwardedHeaders(test.headers, incomingReq)
+
+		if test.headers.Get(mesh.HdrXForwardedFor) != test.xForwardedFor {
+			t.Errorf("%s: expected X-Forwarded-For '%s', got '%s'", test.name, test.xForwardedFor, test.headers.Get(mesh.HdrXForwardedFor))
+		}
+
+		if test.headers.Get(mesh.HdrXForwardedProto) != test.xForwardedProto {
+			t.Errorf("%s: expected X-Forwarded-Proto '%s', got '%s'", test.name, test.xForwardedProto, test.headers.Get(mesh.HdrXForwardedProto))
+		}
+
+		if test.headers.Get(mesh.HdrXForwardedHost) != test.xForwardedHost {
+			t.Errorf("%s: expected X-Forwarded-Host '%s', got '%s'", test.name, test.xForwardedHost, test.headers.Get(mesh.HdrXForwardedHost))
+		}
+
+		if test.headers.Get(mesh.HdrForwarded) != test.forwarded {
+			t.Errorf("%s: expected Forwarded '%s', got '%s'", test.name, test.forwarded, test.headers.Get(mesh.HdrForwarded))
+		}
+	}
+}
+
+func Test_NewForwardRequest(t *testing.T) {
+	incomingReq := httptest.NewRequest(http.MethodPost, "http://example.com/my-api?id=1", nil)
+	incomingReq.Header.Add("Accept", "text/html")
+	incomingReq.Header.Add("Accept", "application/json")
+	incomingReq.Header.Add("Cookie", "a=1")
+	incomingReq.Header.Add("Cookie", "b=2")
+	incomingReq.Header.Set("Connection", "keep-alive, X-Hop")
+	incomingReq.Header.Set("X-Hop", "hop")
+	incomingReq.Header.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+
+	forwardReq, err := mesh.NewForwardRequest("http://127.0.0.1:3000/my-api?id=1", incomingReq, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(forwardReq.Header.Values("Accept"), []string{"text/html", "application/json"}) {
+		t.Errorf("Expected multi-value Accept header, got %v", forwardReq.Header.Values("Accept"))
+	}
+
+	if !slices.Equal(forwardReq.Header.Values("Cookie"), []string{"a=1", "b=2"}) {
+		t.Errorf("Expected multi-value Cookie header, got %v", forwardReq.Header.Values("Cookie"))
+	}
+
+	for _, header := range []string{"Connection", "X-Hop", mesh.HdrRequestContext} {
+		if forwardReq.Header.Get(header) != "" {
+			t.Errorf("Expected %s header removed, got '%s'", header, forwardReq.Header.Get(header))
+		}
+	}
+
+	if forwardReq.Host != "example.com" {
+		t.Errorf("Expected Host example.com, got '%s'", forwardReq.Host)
+	}
+}
+
+func Test_ReplyToIncomingRequestRemovesHopByHopHeaders(t *testing.T) {
+	forwardResp := httptest.NewRecorder()
+	forwardResp.Header().Set("Keep-Alive", "timeout=5")
+	forwardResp.Header().Add("Set-Cookie", "a=1")
+	forwardResp.Header().Add("Set-Cookie", "b=2")
+	forwardResp.WriteHeader(http.StatusOK)
+
+	incomingRespWriter := httptest.NewRecorder()
+	mesh.ReplyToIncomingRequest(MockRequestID, forwardResp.Result(), incomingRespWriter)
+
+	if incomingRespWriter.Header().Get("Keep-Alive") != "" {
+		t.Error("Expected Keep-Alive header removed")
+	}
+
+	if !slices.Equal(incomingRespWriter.Header().Values("Set-Cookie"), []string{"a=1", "b=2"}) {
+		t.Errorf("Expected multi-value Set-Cookie header, got %v", incomingRespWriter.Header().Values("Set-Cookie"))
+	}
+}
@@ -0,0 +1,129 @@
+package mesh
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newH2CClient returns a client speaking h2c with prior knowledge, counting its connections
+func newH2CClient(dials *atomic.Int32) *http.Client {
+	return &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network string, addr string, _ *tls.Config) (net.Conn, error) {
+				dials.Add(1)
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+}
+
+func Test_ServiceMeshHTTP2(t *testing.T) {
+	const concurrentRequests = 10
+
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	// The app replies only once every request is in flight, so requests must be multiplexed
+	var inFlight sync.WaitGroup
+	inFlight.Add(concurrentRequests)
+	var appConns atomic.Int32
+	appServer := httptest.NewUnstartedServer(h2c.NewHandler(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		inFlight.Done()
+		inFlight.Wait()
+
+		responseWriter.Write([]byte(request.Proto + " " + request.URL.Query().Get("i")))
+	}), &http2.Server{}))
+	appServer.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			appConns.Add(1)
+		}
+	}
+	appServer.Start()
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.App.HTTP2 = true
+	config.YamlConfig.Mesh.HTTP2.Enable = true
+	config.YamlConfig.Mesh.HTTP2.MaxConcurrentStreams = 100
+	meshServer := httptest.NewServer(mesh.H2CHandler(config, mesh.NewRoutesWithConfig(config).ServiceMesh()))
+	defer meshServer.Close()
+
+	var dials atomic.Int32
+	client := newH2CClient(&dials)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := newStreamingRequest(t, context.Background(), meshServer.URL+"/my-api?i="+strconv.Itoa(i))
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK || string(body) != "HTTP/2.0 "+strconv.Itoa(i) {
+				t.Errorf("Expected HTTP/2 response from app over HTTP/2, got %s %d '%s'", resp.Proto, resp.StatusCode, body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if dials.Load() != 1 {
+		t.Errorf("Expected 1 client connection, got %d", dials.Load())
+	}
+
+	if appConns.Load() != 1 {
+		t.Errorf("Expected 1 app connection, got %d", appConns.Load())
+	}
+}
+
+func Test_ServiceMeshHTTP1WithH2C(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Write([]byte(request.Proto))
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.HTTP2.Enable = true
+	meshServer := httptest.NewServer(mesh.H2CHandler(config, mesh.NewRoutesWithConfig(config).ServiceMesh()))
+	defer meshServer.Close()
+
+	resp, err := http.DefaultClient.Do(newStreamingRequest(t, context.Background(), meshServer.URL+"/my-api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 1 || string(body) != "HTTP/1.1" {
+		t.Errorf("Expected HTTP/1.1 request and response, got %s '%s'", resp.Proto, body)
+	}
+}
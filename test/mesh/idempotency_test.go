@@ -0,0 +1,261 @@
+package mesh
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func MockIdempotency(keyBy string) conf.Idempotency {
+	return conf.Idempotency{
+		Enable:           true,
+		KeyBy:            keyBy,
+		Header:           conf.IdempotencyHeader,
+		Path:             "events.0.id",
+		TTL:              time.Minute,
+		MaxEntries:       10,
+		MaxResponseBytes: 1024,
+	}
+}
+
+func Test_IdempotencyKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/my-api", nil)
+	req.Header.Set(conf.IdempotencyHeader, "key-1")
+	payload := []byte(`{"events":[{"id":"event-1"}]}`)
+
+	for _, keyBy := range []string{conf.IdempotencyKeyByHeader, conf.IdempotencyKeyByJSONPath, conf.IdempotencyKeyByDigest} {
+		idempotency := MockIdempotency(keyBy)
+		key := mesh.IdempotencyKey(idempotency, req, payload)
+		if key == "" {
+			t.Errorf("Expected %s key", keyBy)
+		}
+
+		if mesh.IdempotencyKey(idempotency, httptest.NewRequest(http.MethodPost, "/my-api", nil), []byte(`{"events":[]}`)) == key {
+			t.Errorf("Expected different %s key for different request", keyBy)
+		}
+
+		// Requests to other routes and methods are not duplicates
+		otherRoute := httptest.NewRequest(http.MethodPost, "/my-other-api", nil)
+		otherRoute.Header = req.Header
+		if mesh.IdempotencyKey(idempotency, otherRoute, payload) == key {
+			t.Errorf("Expected different %s key for different route", keyBy)
+		}
+
+		otherMethod := httptest.NewRequest(http.MethodPut, "/my-api", nil)
+		otherMethod.Header = req.Header
+		if mesh.IdempotencyKey(idempotency, otherMethod, payload) == key {
+			t.Errorf("Expected different %s key for different method", keyBy)
+		}
+	}
+
+	if key := mesh.IdempotencyKey(MockIdempotency(conf.IdempotencyKeyByHeader), httptest.NewRequest(http.MethodPost, "/my-api", nil), payload); key != "" {
+		t.Errorf("Expected no key without header, got %s", key)
+	}
+
+	if key := mesh.IdempotencyKey(MockIdempotency(conf.IdempotencyKeyByJSONPath), req, []byte(`{}`)); key != "" {
+		t.Errorf("Expected no key without JSON path value, got %s", key)
+	}
+}
+
+func Test_IdempotencyCache(t *testing.T) {
+	cache := mesh.NewIdempotencyCache()
+	idempotency := MockIdempotency(conf.IdempotencyKeyByDigest)
+	now := time.Now()
+
+	if cachedResponse, err := cache.Begin(MockRequestID, idempotency, "", MockOrgID18, "key", now); cachedResponse != nil || err != nil {
+		t.Fatalf("Expected new request, got %v: %v", cachedResponse, err)
+	}
+
+	_, err := cache.Begin(MockRequestID, idempotency, "", MockOrgID18, "key", now)
+	if !errors.Is(err, meshErrors.Conflict) {
+		t.Errorf("Expected in flight request rejected as conflict, got %v", err)
+	}
+
+	// Keys are per org
+	if cachedResponse, err := cache.Begin(MockRequestID, idempotency, "", "00Dxx0000000001EAA", "key", now); cachedResponse != nil || err != nil {
+		t.Errorf("Expected new request for other org, got %v: %v", cachedResponse, err)
+	}
+
+	cache.Complete(idempotency, MockOrgID18, "key", &mesh.CachedResponse{StatusCode: http.StatusOK, Body: []byte("ok")}, now)
+	cachedResponse, err := cache.Begin(MockRequestID, idempotency, "", MockOrgID18, "key", now)
+	if err != nil || cachedResponse == nil || string(cachedResponse.Body) != "ok" {
+		t.Errorf("Expected cached response, got %v: %v", cachedResponse, err)
+	}
+
+	// 15 and 18-character org IDs are the same org
+	if cachedResponse, err := cache.Begin(MockRequestID, idempotency, "", MockOrgID15, "key", now); err != nil || cachedResponse == nil {
+		t.Errorf("Expected cached response for 15-character org ID, got %v: %v", cachedResponse, err)
+	}
+
+	if cachedResponse, _ := cache.Begin(MockRequestID, idempotency, "", MockOrgID18, "key", now.Add(time.Minute)); cachedResponse != nil {
+		t.Errorf("Expected cached response expired, got %v", cachedResponse)
+	}
+
+	// Failed requests may be retried
+	cache.Complete(idempotency, MockOrgID18, "key", nil, now)
+	if cachedResponse, err := cache.Begin(MockRequestID, idempotency, "", MockOrgID18, "key", now); cachedResponse != nil || err != nil {
+		t.Errorf("Expected new request, got %v: %v", cachedResponse, err)
+	}
+}
+
+func Test_ServiceMeshIdempotency(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appRequests := 0
+	appStatus := http.StatusCreated
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appRequests++
+		responseWriter.Header().Set("x-app", "app")
+		responseWriter.WriteHeader(appStatus)
+		responseWriter.Write([]byte("created"))
+	}))
+	defer appServer.Close()
+
+	config := newAsyncDeliveryConfig(t, appServer.URL)
+	config.HerokuIntegrationUrl = authServer.URL
+	config.YamlConfig.Mesh.Idempotency = MockIdempotency(conf.IdempotencyKeyByHeader)
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	serve := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(`{"events":[]}`)))
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, "signature")
+		req.Header.Set(conf.IdempotencyHeader, key)
+		recorder := httptest.NewRecorder()
+		serviceMesh(recorder, req)
+		return recorder
+	}
+
+	serve("key-1")
+	duplicate := serve("key-1")
+	if appRequests != 1 {
+		t.Errorf("Expected 1 app request, got %d", appRequests)
+	}
+
+	if duplicate.Code != http.StatusCreated || duplicate.Body.String() != "created" || duplicate.Header().Get("x-app") != "app" {
+		t.Errorf("Expected cached response, got %d %s %v", duplicate.Code, duplicate.Body.String(), duplicate.Header())
+	}
+
+	if duplicate.Header().Get(mesh.HdrIdempotentReplayed) != "true" {
+		t.Errorf("Expected %s header", mesh.HdrIdempotentReplayed)
+	}
+
+	// Failed requests are not cached
+	appStatus = http.StatusServiceUnavailable
+	serve("key-2")
+	serve("key-2")
+	if appRequests != 3 {
+		t.Errorf("Expected 3 app requests, got %d", appRequests)
+	}
+}
+
+func Test_ServiceMeshIdempotencyWithReplayProtection(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appRequests := 0
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appRequests++
+		responseWriter.WriteHeader(http.StatusCreated)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.ReplayProtection = MockReplayProtection
+	config.YamlConfig.Mesh.Idempotency = MockIdempotency(conf.IdempotencyKeyByHeader)
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	payload := []byte(`{"events":[{"timestamp":` + strconv.FormatInt(time.Now().Unix(), 10) + `}]}`)
+	serve := func(signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader(payload))
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, signature)
+		req.Header.Set(conf.IdempotencyHeader, "key")
+		recorder := httptest.NewRecorder()
+		serviceMesh(recorder, req)
+		return recorder
+	}
+
+	if original := serve("signature-1"); original.Code != http.StatusCreated {
+		t.Fatalf("Expected %d, got %d", http.StatusCreated, original.Code)
+	}
+
+	// Replays are rejected rather than receiving the cached response
+	replay := serve("signature-1")
+	if replay.Code != http.StatusConflict || !bytes.Contains(replay.Body.Bytes(), []byte(`"code":"replay"`)) {
+		t.Errorf("Expected replay rejected, got %d %s", replay.Code, replay.Body.String())
+	}
+
+	// Duplicates that are not replays receive the cached response
+	duplicate := serve("signature-2")
+	if duplicate.Code != http.StatusCreated || duplicate.Header().Get(mesh.HdrIdempotentReplayed) != "true" {
+		t.Errorf("Expected cached response, got %d %v", duplicate.Code, duplicate.Header())
+	}
+
+	// Duplicates answered from the cache are recorded by the replay guard
+	if replay := serve("signature-2"); replay.Code != http.StatusConflict || replay.Header().Get(mesh.HdrIdempotentReplayed) != "" {
+		t.Errorf("Expected replay of duplicate rejected, got %d %s", replay.Code, replay.Body.String())
+	}
+
+	if appRequests != 1 {
+		t.Errorf("Expected 1 app request, got %d", appRequests)
+	}
+}
+
+func Test_ServiceMeshIdempotencyRejectsInFlightDuplicates(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	received := make(chan struct{})
+	respond := make(chan struct{})
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		close(received)
+		<-respond
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.Idempotency = MockIdempotency(conf.IdempotencyKeyByHeader)
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(`{}`)))
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, "signature")
+		req.Header.Set(conf.IdempotencyHeader, "key")
+		recorder := httptest.NewRecorder()
+		serviceMesh(recorder, req)
+		return recorder
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve()
+	}()
+	<-received
+
+	duplicate := serve()
+	close(respond)
+	<-done
+
+	if duplicate.Code != http.StatusConflict || !bytes.Contains(duplicate.Body.Bytes(), []byte(`"code":"conflict"`)) {
+		t.Errorf("Expected in flight duplicate rejected as conflict, got %d %s", duplicate.Code, duplicate.Body.String())
+	}
+}
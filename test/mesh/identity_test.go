@@ -0,0 +1,145 @@
+package mesh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+var MockIdentityHeaders = conf.IdentityHeaders{
+	Enable:       "true",
+	OrgID:        conf.IdentityHeaderOrgID,
+	OrgDomainUrl: conf.IdentityHeaderOrgDomainUrl,
+	AppUUID:      conf.IdentityHeaderAppUUID,
+	ContextType:  conf.IdentityHeaderContextType,
+	Resource:     conf.IdentityHeaderResource,
+	RequestType:  conf.IdentityHeaderRequestType,
+	AuthOutcome:  conf.IdentityHeaderAuthOutcome,
+}
+
+func Test_SetIdentityHeaders(t *testing.T) {
+	config := &conf.Config{
+		YamlConfig: &conf.YamlConfig{Mesh: conf.Mesh{IdentityHeaders: MockIdentityHeaders}},
+	}
+	incomingReq := httptest.NewRequest(http.MethodPost, "/my-api", nil)
+	requestHeader := &mesh.RequestHeader{XRequestContext: *MockValidXRequestContext, IsSalesforceRequest: true}
+
+	identity := mesh.NewIdentity()
+	identity.SetRequestHeader(requestHeader, incomingReq)
+
+	headers := http.Header{}
+	mesh.SetIdentityHeaders(config, headers, identity)
+
+	expected := map[string]string{
+		conf.IdentityHeaderOrgID:        MockValidXRequestContext.OrgID,
+		conf.IdentityHeaderOrgDomainUrl: MockValidXRequestContext.OrgDomainUrl,
+		conf.IdentityHeaderAppUUID:      MockValidXRequestContext.AppUUID,
+		conf.IdentityHeaderContextType:  MockValidXRequestContext.Type,
+		conf.IdentityHeaderResource:     MockValidXRequestContext.Resource,
+		conf.IdentityHeaderRequestType:  conf.RequestTypeSalesforce,
+		conf.IdentityHeaderAuthOutcome:  "pass-through",
+	}
+	for header, value := range expected {
+		if headers.Get(header) != value {
+			t.Errorf("Expected %s '%s', got '%s'", header, value, headers.Get(header))
+		}
+	}
+
+	// Disabled
+	config.YamlConfig.Mesh.IdentityHeaders.Enable = "false"
+	headers = http.Header{}
+	mesh.SetIdentityHeaders(config, headers, identity)
+	if len(headers) != 0 {
+		t.Errorf("Expected no identity headers, got %v", headers)
+	}
+}
+
+func Test_StripIdentityHeaders(t *testing.T) {
+	config := &conf.Config{
+		YamlConfig: &conf.YamlConfig{Mesh: conf.Mesh{IdentityHeaders: MockIdentityHeaders}},
+	}
+
+	headers := http.Header{}
+	headers.Set(conf.IdentityHeaderOrgID, MockOrgID18)
+	headers.Set(conf.IdentityTokenHeader, "forged")
+	headers.Set(mesh.HdrMeshVerdict, "allow")
+	headers.Set("x-app-header", "kept")
+	mesh.StripIdentityHeaders(config, headers)
+
+	// Identity tokens are stripped even when tokens are disabled
+	for _, header := range []string{conf.IdentityHeaderOrgID, conf.IdentityTokenHeader, mesh.HdrMeshVerdict} {
+		if headers.Get(header) != "" {
+			t.Errorf("Expected %s stripped, got '%s'", header, headers.Get(header))
+		}
+	}
+
+	if headers.Get("x-app-header") != "kept" {
+		t.Error("Expected other headers kept")
+	}
+}
+
+func Test_ServiceMeshForwardsIdentityHeaders(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	var appHeaders http.Header
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appHeaders = request.Header
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.IdentityHeaders = MockIdentityHeaders
+	config.YamlConfig.Mesh.IdentityHeaders.OrgID = "x-verified-org-id"
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	// Data Action Target request with spoofed identity headers
+	incomingReq := httptest.NewRequest(http.MethodPost, "/my-api?orgId="+MockOrgID18+"&apiName=DAT", nil)
+	incomingReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	incomingReq.Header.Set(mesh.HdrSignature, MockRequestID)
+	incomingReq.Header.Set("x-verified-org-id", MockOtherOrgID18)
+	incomingReq.Header.Set(conf.IdentityHeaderAppUUID, MockUUID)
+	incomingReq.Header.Set(conf.IdentityHeaderAuthOutcome, "allow")
+
+	incomingRespWriter := httptest.NewRecorder()
+	serviceMesh(incomingRespWriter, incomingReq)
+	if incomingRespWriter.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, incomingRespWriter.Code)
+	}
+
+	if appHeaders.Get("x-verified-org-id") != MockOrgID18 {
+		t.Errorf("Expected verified org ID %s, got '%s'", MockOrgID18, appHeaders.Get("x-verified-org-id"))
+	}
+
+	if appHeaders.Get(conf.IdentityHeaderAppUUID) != "" {
+		t.Errorf("Expected spoofed app UUID removed, got '%s'", appHeaders.Get(conf.IdentityHeaderAppUUID))
+	}
+
+	if appHeaders.Get(conf.IdentityHeaderRequestType) != conf.RequestTypeDataActionTarget {
+		t.Errorf("Expected request type %s, got '%s'", conf.RequestTypeDataActionTarget, appHeaders.Get(conf.IdentityHeaderRequestType))
+	}
+
+	if appHeaders.Get(conf.IdentityHeaderAuthOutcome) != "allow" {
+		t.Errorf("Expected allow outcome, got '%s'", appHeaders.Get(conf.IdentityHeaderAuthOutcome))
+	}
+
+	// Bypassed request with spoofed identity headers
+	config.ShouldBypassAllRoutes = true
+	incomingReq = httptest.NewRequest(http.MethodGet, "/my-api", nil)
+	incomingReq.Header.Set("x-verified-org-id", MockOtherOrgID18)
+	serviceMesh(httptest.NewRecorder(), incomingReq)
+
+	if appHeaders.Get("x-verified-org-id") != "" {
+		t.Errorf("Expected spoofed org ID removed, got '%s'", appHeaders.Get("x-verified-org-id"))
+	}
+
+	if appHeaders.Get(conf.IdentityHeaderAuthOutcome) != "pass-through" {
+		t.Errorf("Expected pass-through outcome, got '%s'", appHeaders.Get(conf.IdentityHeaderAuthOutcome))
+	}
+}
@@ -0,0 +1,76 @@
+package mesh
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_LRUEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	lru := mesh.NewLRU[string, int](2, time.Minute)
+	lru.Add("a", 1, now)
+	lru.Add("b", 2, now)
+
+	// a is now most recently used
+	if value, ok := lru.Get("a", now); !ok || value != 1 {
+		t.Errorf("Expected a=1, got %d %v", value, ok)
+	}
+
+	lru.Add("c", 3, now)
+	if _, ok := lru.Get("b", now); ok {
+		t.Error("Expected b to be evicted")
+	}
+
+	if lru.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", lru.Len())
+	}
+}
+
+func Test_LRUExpiresEntries(t *testing.T) {
+	now := time.Now()
+	lru := mesh.NewLRU[string, int](10, time.Minute)
+	lru.Add("a", 1, now)
+	lru.Add("b", 2, now.Add(30*time.Second))
+
+	if _, ok := lru.Get("a", now.Add(time.Minute)); ok {
+		t.Error("Expected a to be expired")
+	}
+
+	if _, ok := lru.Get("b", now.Add(time.Minute)); !ok {
+		t.Error("Expected b to be unexpired")
+	}
+
+	// Adding prunes expired entries
+	lru.Add("c", 3, now.Add(2*time.Minute))
+	if lru.Len() != 1 {
+		t.Errorf("Expected 1 entry, got %d", lru.Len())
+	}
+
+	lru.Remove("c")
+	if lru.Len() != 0 {
+		t.Errorf("Expected 0 entries, got %d", lru.Len())
+	}
+}
+
+func Test_LRUExpiresRecentlyUsedEntries(t *testing.T) {
+	now := time.Now()
+	lru := mesh.NewLRU[string, int](10, time.Minute)
+	lru.Add("a", 1, now)
+	lru.Add("b", 2, now.Add(30*time.Second))
+
+	// Using a does NOT extend its TTL
+	if _, ok := lru.Get("a", now.Add(45*time.Second)); !ok {
+		t.Error("Expected a to be unexpired")
+	}
+
+	lru.Add("c", 3, now.Add(time.Minute))
+	if lru.Len() != 2 {
+		t.Errorf("Expected a pruned leaving 2 entries, got %d", lru.Len())
+	}
+
+	if _, ok := lru.Get("b", now.Add(time.Minute)); !ok {
+		t.Error("Expected b to be unexpired")
+	}
+}
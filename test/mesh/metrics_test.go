@@ -0,0 +1,28 @@
+package mesh
+
+import (
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_Metrics(t *testing.T) {
+	metrics := mesh.NewMetrics()
+	metrics.IncrCounter("requests_total", "status", "200")
+	metrics.IncrCounter("requests_total", "status", "200")
+	metrics.AddGauge("in_flight", 3)
+	metrics.AddGauge("in_flight", -1)
+
+	if metrics.Counter("requests_total", "status", "200") != 2 {
+		t.Errorf("Expected counter 2, got %v", metrics.Counter("requests_total", "status", "200"))
+	}
+
+	if metrics.Gauge("in_flight") != 2 {
+		t.Errorf("Expected gauge 2, got %v", metrics.Gauge("in_flight"))
+	}
+
+	expected := "# TYPE requests_total counter\nrequests_total{status=\"200\"} 2\n# TYPE in_flight gauge\nin_flight 2\n"
+	if metrics.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, metrics.String())
+	}
+}
@@ -0,0 +1,232 @@
+package mesh
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+const MockOpenAPISpec = `openapi: 3.0.3
+info:
+  title: My API
+  version: 1.0.0
+servers:
+  - url: https://my-app.herokuapp.com/api
+paths:
+  /accounts:
+    post:
+      operationId: createAccount
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name:
+                  type: string
+                employees:
+                  type: integer
+      responses:
+        "201":
+          description: Created
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id:
+                    type: string
+  /accounts/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            maximum: 100
+      responses:
+        "200":
+          description: OK
+`
+
+func newOpenAPIConfig(t *testing.T, authUrl string, appUrl string) *conf.Config {
+	specFile := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := os.WriteFile(specFile, []byte(MockOpenAPISpec), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewMockConfig(authUrl, appUrl)
+	config.YamlConfig.Mesh.OpenAPI = conf.OpenAPI{Enable: true, SpecFile: specFile, ValidateResponses: true}
+	return config
+}
+
+func newOpenAPIRequest(method string, path string, body string) *http.Request {
+	incomingReq := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	incomingReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	incomingReq.Header.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+	incomingReq.Header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+	if body != "" {
+		incomingReq.Header.Set("Content-Type", "application/json")
+	}
+	return incomingReq
+}
+
+func Test_ValidateOpenAPIRequest(t *testing.T) {
+	validator, err := mesh.NewOpenAPIValidator(newOpenAPIConfig(t, "http://localhost:1", "http://localhost:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{http.MethodPost, "/api/accounts", `{"name":"Acme","employees":10}`, 0},
+		{http.MethodGet, "/api/accounts/1?limit=10", "", 0},
+		{http.MethodGet, "/api/contacts", "", http.StatusNotFound},
+		{http.MethodGet, "/accounts/1", "", http.StatusNotFound},
+		{http.MethodDelete, "/api/accounts/1", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/accounts/1?limit=1000", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/accounts/one", "", http.StatusBadRequest},
+		{http.MethodPost, "/api/accounts", `{"employees":"10"}`, http.StatusUnprocessableEntity},
+	} {
+		operation, err := validator.ValidateRequest(MockRequestID, newOpenAPIRequest(test.method, test.path, test.body), []byte(test.body))
+		if test.expected == 0 {
+			if err != nil || operation == nil {
+				t.Errorf("Expected %s %s valid, got %v", test.method, test.path, err)
+			}
+			continue
+		}
+
+		var serverError *meshErrors.ServerError
+		if !errors.As(err, &serverError) || serverError.HttpStatusCode() != test.expected {
+			t.Errorf("Expected %d for %s %s, got %v", test.expected, test.method, test.path, err)
+		}
+	}
+}
+
+func Test_ValidateOpenAPIRequestViolations(t *testing.T) {
+	validator, err := mesh.NewOpenAPIValidator(newOpenAPIConfig(t, "http://localhost:1", "http://localhost:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"employees":"10"}`
+	operation, err := validator.ValidateRequest(MockRequestID, newOpenAPIRequest(http.MethodPost, "/api/accounts", body), []byte(body))
+	if operation == nil || operation.Name != "createAccount" {
+		t.Errorf("Expected createAccount operation, got %v", operation)
+	}
+
+	var serverError *meshErrors.ServerError
+	if !errors.As(err, &serverError) || !errors.Is(err, meshErrors.Unprocessable) {
+		t.Fatalf("Expected unprocessable, got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, violation := range serverError.Violations {
+		fields[violation.Field] = true
+	}
+	if !fields["body/name"] || !fields["body/employees"] {
+		t.Errorf("Unexpected violations %v", serverError.Violations)
+	}
+
+	_, err = validator.ValidateRequest(MockRequestID, newOpenAPIRequest(http.MethodGet, "/api/accounts/1?limit=1000", ""), nil)
+	if !errors.As(err, &serverError) || len(serverError.Violations) != 1 || serverError.Violations[0].Field != "query.limit" {
+		t.Errorf("Expected query.limit violation, got %v", err)
+	}
+}
+
+func Test_InvalidOpenAPISpec(t *testing.T) {
+	config := newOpenAPIConfig(t, "http://localhost:1", "http://localhost:2")
+	if err := os.WriteFile(config.YamlConfig.Mesh.OpenAPI.SpecFile, []byte("openapi: 3.0.3\npaths: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mesh.NewOpenAPIValidator(config); err == nil {
+		t.Error("Expected invalid OpenAPI document error")
+	}
+
+	config.YamlConfig.Mesh.OpenAPI.SpecFile = filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := mesh.NewOpenAPIValidator(config); err == nil {
+		t.Error("Expected missing OpenAPI document error")
+	}
+}
+
+func Test_ServiceMeshOpenAPIValidation(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appRequests := 0
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appRequests++
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+		responseWriter.Write([]byte(`{"name":"Acme"}`))
+	}))
+	defer appServer.Close()
+
+	config := newOpenAPIConfig(t, authServer.URL, appServer.URL)
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	// Undeclared and invalid requests are NOT forwarded
+	for path, expected := range map[string]int{
+		"/api/contacts": http.StatusNotFound,
+		"/api/accounts": http.StatusUnprocessableEntity,
+	} {
+		incomingRespWriter := httptest.NewRecorder()
+		serviceMesh(incomingRespWriter, newOpenAPIRequest(http.MethodPost, path, `{}`))
+		if incomingRespWriter.Code != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, path, incomingRespWriter.Code)
+		}
+	}
+
+	if appRequests != 0 {
+		t.Errorf("Expected no app requests, got %d", appRequests)
+	}
+
+	// Response violations are reported only
+	violations := mesh.GetMetrics().Counter(mesh.MetricOpenAPIResponseViolationsTotal, "operation", "createAccount")
+	incomingRespWriter := httptest.NewRecorder()
+	serviceMesh(incomingRespWriter, newOpenAPIRequest(http.MethodPost, "/api/accounts", `{"name":"Acme"}`))
+	if incomingRespWriter.Code != http.StatusCreated || incomingRespWriter.Body.String() != `{"name":"Acme"}` {
+		t.Errorf("Expected app response, got %d %s", incomingRespWriter.Code, incomingRespWriter.Body.String())
+	}
+
+	if appRequests != 1 {
+		t.Errorf("Expected 1 app request, got %d", appRequests)
+	}
+
+	if mesh.GetMetrics().Counter(mesh.MetricOpenAPIResponseViolationsTotal, "operation", "createAccount") != violations+1 {
+		t.Error("Should count response violation")
+	}
+
+	// Data Action Target requests are NOT validated
+	datReq := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(`{}`)))
+	datReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	datReq.Header.Set(mesh.HdrSignature, "signature")
+	incomingRespWriter = httptest.NewRecorder()
+	serviceMesh(incomingRespWriter, datReq)
+	if appRequests != 2 {
+		t.Errorf("Expected Data Action Target request forwarded, got %d", incomingRespWriter.Code)
+	}
+}
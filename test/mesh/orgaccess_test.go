@@ -0,0 +1,83 @@
+package mesh
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+var MockOrgID15 = MockOrgID18[:15]
+var MockOtherOrgID18 = "00Dxx0000000001EAA"
+
+func Test_GetOrgID(t *testing.T) {
+	incomingReq, err := http.NewRequest(http.MethodPost, "/my-api?orgId="+MockOtherOrgID18, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestHeader := &mesh.RequestHeader{XRequestContext: *MockValidXRequestContext, IsSalesforceRequest: true}
+	if orgId := mesh.GetOrgID(requestHeader, incomingReq); orgId != MockOrgID18 {
+		t.Errorf("Expected Salesforce org %s, got %s", MockOrgID18, orgId)
+	}
+
+	requestHeader = &mesh.RequestHeader{XSignature: MockRequestID}
+	if orgId := mesh.GetOrgID(requestHeader, incomingReq); orgId != MockOtherOrgID18 {
+		t.Errorf("Expected Data Action Target org %s, got %s", MockOtherOrgID18, orgId)
+	}
+}
+
+func Test_OrgIDEquals(t *testing.T) {
+	if !mesh.OrgIDEquals(MockOrgID18, MockOrgID15) {
+		t.Error("18 and 15-character org IDs should be equal")
+	}
+
+	if mesh.OrgIDEquals(MockOrgID18, MockOtherOrgID18) {
+		t.Error("Org IDs should NOT be equal")
+	}
+
+	if mesh.OrgIDEquals(MockOrgID18, "") {
+		t.Error("Empty org ID should NOT be equal")
+	}
+}
+
+func Test_AuthorizeOrg(t *testing.T) {
+	tests := []struct {
+		name    string
+		orgs    conf.Orgs
+		route   *conf.Route
+		orgId   string
+		allowed bool
+	}{
+		{"no lists", conf.Orgs{}, nil, MockOrgID18, true},
+		{"globally allowed", conf.Orgs{Allow: []string{MockOrgID15}}, nil, MockOrgID18, true},
+		{"not globally allowed", conf.Orgs{Allow: []string{MockOtherOrgID18}}, nil, MockOrgID18, false},
+		{"missing org not allowed", conf.Orgs{Allow: []string{MockOtherOrgID18}}, nil, "", false},
+		{"globally denied", conf.Orgs{Deny: []string{MockOrgID18}}, nil, MockOrgID18, false},
+		{"deny takes precedence", conf.Orgs{Allow: []string{MockOrgID18}, Deny: []string{MockOrgID18}}, nil, MockOrgID18, false},
+		{"route allowed", conf.Orgs{}, &conf.Route{Path: "/my-api", OrgIDs: []string{MockOrgID18}}, MockOrgID18, true},
+		{"not route allowed", conf.Orgs{}, &conf.Route{Path: "/my-api", OrgIDs: []string{MockOtherOrgID18}}, MockOrgID18, false},
+		{"route denied", conf.Orgs{}, &conf.Route{Path: "/my-api", DenyOrgIDs: []string{MockOrgID18}}, MockOrgID18, false},
+		{"globally allowed, route denied", conf.Orgs{Allow: []string{MockOrgID18}}, &conf.Route{Path: "/my-api", DenyOrgIDs: []string{MockOrgID18}}, MockOrgID18, false},
+	}
+
+	for _, test := range tests {
+		config := &conf.Config{
+			YamlConfig: &conf.YamlConfig{Mesh: conf.Mesh{Orgs: test.orgs}},
+		}
+
+		err := mesh.AuthorizeOrg(MockRequestID, config, test.route, test.orgId)
+		if test.allowed && err != nil {
+			t.Errorf("%s: expected allowed, got %v", test.name, err)
+		}
+
+		if !test.allowed {
+			if err == nil {
+				t.Errorf("%s: expected forbidden", test.name)
+			} else if err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusForbidden {
+				t.Errorf("%s: expected %d, got %d", test.name, http.StatusForbidden, err.(*mesh.InvalidRequest).HttpStatusCode())
+			}
+		}
+	}
+}
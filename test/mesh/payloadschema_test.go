@@ -0,0 +1,142 @@
+package mesh
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+const MockPayloadSchema = `{
+  "type": "object",
+  "required": ["events"],
+  "properties": {
+    "events": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["id"],
+        "properties": {"id": {"type": "string"}, "count": {"type": "integer"}}
+      }
+    }
+  }
+}`
+
+func newPayloadValidationConfig(t *testing.T, appUrl string, strict bool) *conf.Config {
+	schemaDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(schemaDir, "DAT.json"), []byte(MockPayloadSchema), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := newAsyncDeliveryConfig(t, appUrl)
+	config.YamlConfig.Mesh.PayloadValidation = conf.PayloadValidation{Enable: true, SchemaDir: schemaDir, Strict: strict}
+	return config
+}
+
+func Test_ValidatePayload(t *testing.T) {
+	payloadValidator, err := mesh.NewPayloadValidator(newPayloadValidationConfig(t, "http://localhost:1", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := payloadValidator.ValidatePayload(MockRequestID, "DAT", []byte(`{"events":[{"id":"1","count":1}]}`)); err != nil {
+		t.Errorf("Expected valid payload, got %v", err)
+	}
+
+	err = payloadValidator.ValidatePayload(MockRequestID, "DAT", []byte(`{"events":[{"count":"1"},{"id":1}]}`))
+	var serverError *meshErrors.ServerError
+	if !errors.As(err, &serverError) || serverError.HttpStatusCode() != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422, got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, violation := range serverError.Violations {
+		fields[violation.Field] = true
+	}
+	if len(serverError.Violations) != 3 || !fields["/events/0"] || !fields["/events/0/count"] || !fields["/events/1/id"] {
+		t.Errorf("Unexpected violations %v", serverError.Violations)
+	}
+
+	if err := payloadValidator.ValidatePayload(MockRequestID, "DAT", []byte(`not json`)); !errors.Is(err, meshErrors.Unprocessable) {
+		t.Errorf("Expected invalid JSON rejected, got %v", err)
+	}
+
+	if err := payloadValidator.ValidatePayload(MockRequestID, "Other", []byte(`not json`)); err != nil {
+		t.Errorf("Expected apiName without schema allowed, got %v", err)
+	}
+}
+
+func Test_ValidatePayloadStrict(t *testing.T) {
+	payloadValidator, err := mesh.NewPayloadValidator(newPayloadValidationConfig(t, "http://localhost:1", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := payloadValidator.ValidatePayload(MockRequestID, "Other", []byte(`{}`)); !errors.Is(err, meshErrors.Unprocessable) {
+		t.Errorf("Expected apiName without schema rejected, got %v", err)
+	}
+}
+
+func Test_InvalidPayloadSchema(t *testing.T) {
+	config := newPayloadValidationConfig(t, "http://localhost:1", false)
+	schemaFile := filepath.Join(config.YamlConfig.Mesh.PayloadValidation.SchemaDir, "Invalid.json")
+	if err := os.WriteFile(schemaFile, []byte(`{"type": 1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mesh.NewPayloadValidator(config); err == nil {
+		t.Error("Expected invalid schema error")
+	}
+}
+
+func Test_ServiceMeshPayloadValidation(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appRequests := 0
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appRequests++
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := newPayloadValidationConfig(t, appServer.URL, false)
+	config.HerokuIntegrationUrl = authServer.URL
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	for payload, expected := range map[string]int{
+		`{"events":[{"id":"1"}]}`: http.StatusOK,
+		`{"events":[{"id":1}]}`:   http.StatusUnprocessableEntity,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dataChange?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader([]byte(payload)))
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, "signature")
+		recorder := httptest.NewRecorder()
+		serviceMesh(recorder, req)
+
+		if recorder.Code != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, payload, recorder.Code)
+			continue
+		}
+
+		if expected == http.StatusUnprocessableEntity {
+			problem := decodeProblem(t, recorder)
+			if problem.Code != "unprocessable" || len(problem.Errors) != 1 || problem.Errors[0].Field != "/events/0/id" {
+				t.Errorf("Unexpected problem %+v", problem)
+			}
+		}
+	}
+
+	if appRequests != 1 {
+		t.Errorf("Expected 1 app request, got %d", appRequests)
+	}
+}
@@ -0,0 +1,124 @@
+package mesh
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_FindRoutePolicy(t *testing.T) {
+	config := &conf.Config{
+		YamlConfig: &conf.YamlConfig{
+			Mesh: conf.Mesh{
+				Routes: []conf.Route{
+					{Path: "/webhooks/*", RequestTypes: []string{conf.RequestTypeDataActionTarget}},
+					{Path: "/accounts", RequestTypes: []string{conf.RequestTypeSalesforce}},
+				},
+			},
+		},
+	}
+
+	route := mesh.FindRoutePolicy(config, "/webhooks/dataChange")
+	if route == nil || route.Path != "/webhooks/*" {
+		t.Errorf("Expected /webhooks/* route, got %v", route)
+	}
+
+	route = mesh.FindRoutePolicy(config, "/accounts")
+	if route == nil || route.Path != "/accounts" {
+		t.Errorf("Expected /accounts route, got %v", route)
+	}
+
+	route = mesh.FindRoutePolicy(config, "/accounts/1")
+	if route != nil {
+		t.Errorf("Expected no route, got %v", route)
+	}
+}
+
+func Test_ValidateRouteMethod(t *testing.T) {
+	route := &conf.Route{Path: "/accounts", Methods: []string{http.MethodGet}}
+
+	if err := mesh.ValidateRouteMethod(route, http.MethodGet); err != nil {
+		t.Error(err)
+	}
+
+	err := mesh.ValidateRouteMethod(route, http.MethodPost)
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+
+	if err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d, got %d", http.StatusMethodNotAllowed, err.(*mesh.InvalidRequest).HttpStatusCode())
+	}
+
+	if err := mesh.ValidateRouteMethod(nil, http.MethodPost); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ShouldBypassRoutePolicy(t *testing.T) {
+	route := &conf.Route{Path: "/public", RequestTypes: []string{conf.RequestTypeNone, conf.RequestTypeSalesforce}}
+
+	if !mesh.ShouldBypassRoutePolicy(route, http.Header{}) {
+		t.Error("Should bypass request without Salesforce or Data Action Target headers")
+	}
+
+	headers := http.Header{}
+	headers.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+	if mesh.ShouldBypassRoutePolicy(route, headers) {
+		t.Error("Should NOT bypass Salesforce request")
+	}
+
+	route = &conf.Route{Path: "/private", RequestTypes: []string{conf.RequestTypeSalesforce}}
+	if mesh.ShouldBypassRoutePolicy(route, http.Header{}) {
+		t.Error("Should NOT bypass")
+	}
+}
+
+func Test_AuthorizeRoutePolicy(t *testing.T) {
+	salesforceRequestHeader := &mesh.RequestHeader{
+		XRequestID:          MockRequestID,
+		XRequestContext:     *MockValidXRequestContext,
+		ClientContext:       mesh.XClientContext{Namespace: "ns"},
+		IsSalesforceRequest: true,
+	}
+	dataActionTargetRequestHeader := &mesh.RequestHeader{
+		XRequestID: MockRequestID,
+		XSignature: MockRequestID,
+	}
+
+	tests := []struct {
+		name          string
+		route         *conf.Route
+		requestHeader *mesh.RequestHeader
+		allowed       bool
+	}{
+		{"no route", nil, salesforceRequestHeader, true},
+		{"empty route", &conf.Route{Path: "/my-api"}, salesforceRequestHeader, true},
+		{"salesforce allowed", &conf.Route{Path: "/my-api", RequestTypes: []string{conf.RequestTypeSalesforce}}, salesforceRequestHeader, true},
+		{"salesforce not allowed", &conf.Route{Path: "/my-api", RequestTypes: []string{conf.RequestTypeDataActionTarget}}, salesforceRequestHeader, false},
+		{"data action target not allowed", &conf.Route{Path: "/my-api", RequestTypes: []string{conf.RequestTypeSalesforce}}, dataActionTargetRequestHeader, false},
+		{"context type allowed", &conf.Route{Path: "/my-api", ContextTypes: []string{MockValidXRequestContext.Type}}, salesforceRequestHeader, true},
+		{"context type not allowed", &conf.Route{Path: "/my-api", ContextTypes: []string{"other"}}, salesforceRequestHeader, false},
+		{"resource not allowed", &conf.Route{Path: "/my-api", Resources: []string{"other"}}, salesforceRequestHeader, false},
+		{"resource ignored for data action target", &conf.Route{Path: "/my-api", Resources: []string{"other"}}, dataActionTargetRequestHeader, true},
+		{"namespace allowed", &conf.Route{Path: "/my-api", Namespaces: []string{"ns"}}, salesforceRequestHeader, true},
+		{"namespace not allowed", &conf.Route{Path: "/my-api", Namespaces: []string{"other"}}, salesforceRequestHeader, false},
+	}
+
+	for _, test := range tests {
+		err := mesh.AuthorizeRoutePolicy(MockRequestID, test.route, test.requestHeader)
+		if test.allowed && err != nil {
+			t.Errorf("%s: expected allowed, got %v", test.name, err)
+		}
+
+		if !test.allowed {
+			if err == nil {
+				t.Errorf("%s: expected forbidden", test.name)
+			} else if err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusForbidden {
+				t.Errorf("%s: expected %d, got %d", test.name, http.StatusForbidden, err.(*mesh.InvalidRequest).HttpStatusCode())
+			}
+		}
+	}
+}
@@ -295,8 +295,8 @@ func Test_ForwardRequestSendResponse(t *testing.T) {
 			t.Errorf("Expected "+mesh.HdrRequestContext+" '' header, got '%s'", request.Header.Get(mesh.HdrRequestContext))
 		}
 
-		if request.Header.Get(mesh.HdrClientContext) != MockRequestID {
-			t.Errorf("Expected "+mesh.HdrClientContext+" '"+MockRequestID+"' header, got '%s'", request.Header.Get(mesh.HdrClientContext))
+		if request.Header.Get(mesh.HdrClientContext) != ConvertClientContextToString(MockValidXClientContext) {
+			t.Errorf("Expected "+mesh.HdrClientContext+" header, got '%s'", request.Header.Get(mesh.HdrClientContext))
 		}
 
 		// Get the request body from the incoming request
@@ -337,7 +337,7 @@ func Test_ForwardRequestSendResponse(t *testing.T) {
 	}
 	incomingReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
 	incomingReq.Header.Set(mesh.HdrRequestContext, mesh.HdrRequestContext)
-	incomingReq.Header.Set(mesh.HdrClientContext, MockRequestID)
+	incomingReq.Header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
 	incomingReq.Header.Set("Content-Type", "application/json")
 	incomingRespWriter := httptest.NewRecorder()
 
@@ -358,7 +358,7 @@ func Test_ForwardRequestToUnavailableService(t *testing.T) {
 	}
 	incomingReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
 	incomingReq.Header.Set(mesh.HdrRequestContext, mesh.HdrRequestContext)
-	incomingReq.Header.Set(mesh.HdrClientContext, MockRequestID)
+	incomingReq.Header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
 	incomingReq.Header.Set("Content-Type", "application/json")
 	incomingRespWriter := httptest.NewRecorder()
 
@@ -0,0 +1,180 @@
+package mesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_RateLimiterAllow(t *testing.T) {
+	rateLimiter := mesh.NewRateLimiter()
+	rateLimit := conf.RateLimit{Enable: true, RequestsPerSecond: 1, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		result := rateLimiter.Allow(MockOrgID18, rateLimit, now)
+		if !result.Allowed {
+			t.Fatalf("Request %d should be allowed", i)
+		}
+
+		if result.Remaining != 1-i {
+			t.Errorf("Expected %d remaining, got %d", 1-i, result.Remaining)
+		}
+	}
+
+	result := rateLimiter.Allow(MockOrgID18, rateLimit, now)
+	if result.Allowed {
+		t.Error("Request should be limited")
+	}
+
+	if result.RetryAfter != time.Second {
+		t.Errorf("Expected retry after 1s, got %s", result.RetryAfter)
+	}
+
+	// Other orgs have their own bucket
+	result = rateLimiter.Allow(MockOtherOrgID18, rateLimit, now)
+	if !result.Allowed {
+		t.Error("Other org's request should be allowed")
+	}
+
+	// Refills at sustained rate
+	result = rateLimiter.Allow(MockOrgID18, rateLimit, now.Add(time.Second))
+	if !result.Allowed {
+		t.Error("Request should be allowed after refill")
+	}
+}
+
+func Test_RateLimitKey(t *testing.T) {
+	route := &conf.Route{Path: "/my-api"}
+
+	key := mesh.RateLimitKey(conf.RateLimit{}, MockOrgID18, route, conf.RequestTypeSalesforce)
+	if key != MockOrgID15 {
+		t.Errorf("Expected org key, got %s", key)
+	}
+
+	rateLimit := conf.RateLimit{KeyBy: []string{conf.RateLimitKeyRoute, conf.RateLimitKeyRequestType}}
+	key = mesh.RateLimitKey(rateLimit, MockOrgID18, route, conf.RequestTypeSalesforce)
+	if key != MockOrgID15+"|/my-api|salesforce" {
+		t.Errorf("Expected org, route, and request type key, got %s", key)
+	}
+}
+
+func Test_RateLimiterShares15And18CharacterOrgIDBucket(t *testing.T) {
+	config := &conf.Config{
+		YamlConfig: &conf.YamlConfig{
+			Mesh: conf.Mesh{
+				RateLimit: conf.RateLimit{Enable: true, RequestsPerSecond: 1, Burst: 1},
+			},
+		},
+	}
+	rateLimiter := mesh.NewRateLimiter()
+
+	if err := rateLimiter.LimitRequest(MockRequestID, config, nil, MockOrgID18, conf.RequestTypeSalesforce, http.Header{}); err != nil {
+		t.Fatalf("Expected first request allowed, got %v", err)
+	}
+
+	if err := rateLimiter.LimitRequest(MockRequestID, config, nil, MockOrgID15, conf.RequestTypeSalesforce, http.Header{}); err == nil {
+		t.Error("Expected 15-character org ID to share the 18-character org ID's bucket")
+	}
+}
+
+func Test_RateLimiterLimitRequest(t *testing.T) {
+	config := &conf.Config{
+		YamlConfig: &conf.YamlConfig{
+			Mesh: conf.Mesh{
+				RateLimit: conf.RateLimit{Enable: true, RequestsPerSecond: 10, Burst: 1},
+			},
+		},
+	}
+	route := &conf.Route{Path: "/unlimited", RateLimit: &conf.RateLimit{Enable: false}}
+	rateLimiter := mesh.NewRateLimiter()
+
+	respWriter := httptest.NewRecorder()
+	err := rateLimiter.LimitRequest(MockRequestID, config, nil, MockOrgID18, conf.RequestTypeSalesforce, respWriter.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if respWriter.Header().Get(mesh.HdrRateLimitLimit) != "1" || respWriter.Header().Get(mesh.HdrRateLimitRemaining) != "0" {
+		t.Errorf("Unexpected rate limit headers %v", respWriter.Header())
+	}
+
+	respWriter = httptest.NewRecorder()
+	err = rateLimiter.LimitRequest(MockRequestID, config, nil, MockOrgID18, conf.RequestTypeSalesforce, respWriter.Header())
+	if err == nil {
+		t.Fatal("Expected rate limit error")
+	}
+
+	if err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusTooManyRequests {
+		t.Errorf("Expected %d, got %d", http.StatusTooManyRequests, err.(*mesh.InvalidRequest).HttpStatusCode())
+	}
+
+	if respWriter.Header().Get(mesh.HdrRetryAfter) != "1" {
+		t.Errorf("Expected Retry-After 1, got '%s'", respWriter.Header().Get(mesh.HdrRetryAfter))
+	}
+
+	metrics := mesh.GetMetrics().String()
+	if !strings.Contains(metrics, mesh.MetricRateLimitedTotal+`{route="",request_type="salesforce"}`) {
+		t.Errorf("Expected rate limited metric, got %s", metrics)
+	}
+
+	// Route overrides global rate limit
+	err = rateLimiter.LimitRequest(MockRequestID, config, route, MockOrgID18, conf.RequestTypeSalesforce, http.Header{})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ServiceMeshRateLimitsAuthenticatedRequests(t *testing.T) {
+	var authenticated atomic.Bool
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if !authenticated.Load() {
+			responseWriter.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.RateLimit = conf.RateLimit{Enable: true, RequestsPerSecond: 0.001, Burst: 1}
+	meshServer := httptest.NewServer(mesh.NewRoutesWithConfig(config).ServiceMesh())
+	defer meshServer.Close()
+
+	statusCode := func() int {
+		resp, err := http.DefaultClient.Do(newStreamingRequest(t, context.Background(), meshServer.URL+"/my-api"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Unauthenticated requests do NOT exhaust the org's bucket
+	for i := 0; i < 3; i++ {
+		if status := statusCode(); status != http.StatusForbidden {
+			t.Errorf("Expected %d, got %d", http.StatusForbidden, status)
+		}
+	}
+
+	authenticated.Store(true)
+	if status := statusCode(); status != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, status)
+	}
+
+	if status := statusCode(); status != http.StatusTooManyRequests {
+		t.Errorf("Expected %d, got %d", http.StatusTooManyRequests, status)
+	}
+}
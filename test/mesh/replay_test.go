@@ -0,0 +1,194 @@
+package mesh
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+var MockReplayProtection = conf.ReplayProtection{
+	Enable:        true,
+	Window:        5 * time.Minute,
+	MaxEntries:    100,
+	TimestampPath: "events.0.timestamp",
+	MaxAge:        5 * time.Minute,
+}
+
+func Test_LookupJSONBodyPath(t *testing.T) {
+	body := []byte(`{"events":[{"timestamp":1700000000,"name":"a"}],"org":{"id":"x"}}`)
+
+	if value, ok := mesh.LookupJSONBodyPath(body, "org.id"); !ok || value != "x" {
+		t.Errorf("Expected x, got %v", value)
+	}
+
+	if value, ok := mesh.LookupJSONBodyPath(body, "events.0.timestamp"); !ok || value.(interface{ String() string }).String() != "1700000000" {
+		t.Errorf("Expected 1700000000, got %v", value)
+	}
+
+	for _, path := range []string{"events.1.timestamp", "events.x", "org.name", "org.id.value"} {
+		if _, ok := mesh.LookupJSONBodyPath(body, path); ok {
+			t.Errorf("Expected %s not found", path)
+		}
+	}
+}
+
+func Test_CheckTimestamp(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		payload string
+		valid   bool
+	}{
+		{"epoch seconds", `{"events":[{"timestamp":` + strconv.FormatInt(now.Unix(), 10) + `}]}`, true},
+		{"epoch millis", `{"events":[{"timestamp":` + strconv.FormatInt(now.UnixMilli(), 10) + `}]}`, true},
+		{"RFC 3339", `{"events":[{"timestamp":"` + now.Add(-time.Minute).Format(time.RFC3339) + `"}]}`, true},
+		{"stale", `{"events":[{"timestamp":` + strconv.FormatInt(now.Add(-time.Hour).Unix(), 10) + `}]}`, false},
+		{"future", `{"events":[{"timestamp":` + strconv.FormatInt(now.Add(time.Hour).Unix(), 10) + `}]}`, false},
+		{"missing", `{"events":[]}`, false},
+		{"invalid", `{"events":[{"timestamp":"yesterday"}]}`, false},
+	}
+
+	for _, test := range tests {
+		err := mesh.CheckTimestamp(MockRequestID, MockReplayProtection, []byte(test.payload), now)
+		if test.valid && err != nil {
+			t.Errorf("%s: expected valid, got %v", test.name, err)
+		}
+
+		if !test.valid && !errors.Is(err, meshErrors.Unauthenticated) {
+			t.Errorf("%s: expected unauthenticated error, got %v", test.name, err)
+		}
+	}
+}
+
+func Test_CheckReplay(t *testing.T) {
+	now := time.Now()
+	replayGuard := mesh.NewReplayGuard()
+	payload := []byte(`{"events":[]}`)
+
+	if err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOrgID18, "signature", payload, now); err != nil {
+		t.Fatal(err)
+	}
+
+	err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOrgID18, "signature", payload, now)
+	if !errors.Is(err, meshErrors.Replay) || err.(*mesh.InvalidRequest).HttpStatusCode() != http.StatusConflict {
+		t.Errorf("Expected %d replay error, got %v", http.StatusConflict, err)
+	}
+
+	// 15 and 18-character org IDs are the same org
+	if err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOrgID15, "signature", payload, now); !errors.Is(err, meshErrors.Replay) {
+		t.Errorf("Expected replay with 15-character org ID, got %v", err)
+	}
+
+	// Other orgs, signatures and payloads are not replays
+	if err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOtherOrgID18, "signature", payload, now); err != nil {
+		t.Errorf("Expected other org allowed, got %v", err)
+	}
+
+	if err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOrgID18, "signature", []byte(`{}`), now); err != nil {
+		t.Errorf("Expected other payload allowed, got %v", err)
+	}
+
+	// Requests outside the window are not replays
+	if err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOrgID18, "signature", payload, now.Add(6*time.Minute)); err != nil {
+		t.Errorf("Expected request outside window allowed, got %v", err)
+	}
+}
+
+func Test_ServiceMeshRejectsReplayedDataActionTarget(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appRequests := 0
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appRequests++
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.ReplayProtection = MockReplayProtection
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	payload := []byte(`{"events":[{"timestamp":` + strconv.FormatInt(time.Now().Unix(), 10) + `}]}`)
+	var statuses []int
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/my-api?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader(payload))
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, "signature")
+		recorder := httptest.NewRecorder()
+		serviceMesh(recorder, req)
+		statuses = append(statuses, recorder.Code)
+	}
+
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusConflict {
+		t.Errorf("Expected [200 409], got %v", statuses)
+	}
+
+	if appRequests != 1 {
+		t.Errorf("Expected 1 app request, got %d", appRequests)
+	}
+}
+
+func Test_ServiceMeshAcceptsRedeliveryOfFailedDataActionTarget(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	appStatuses := []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK}
+	appRequests := 0
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(appStatuses[appRequests])
+		appRequests++
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.ReplayProtection = MockReplayProtection
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	payload := []byte(`{"events":[{"timestamp":` + strconv.FormatInt(time.Now().Unix(), 10) + `}]}`)
+	var statuses []int
+	for range 3 {
+		req := httptest.NewRequest(http.MethodPost, "/my-api?orgId="+MockOrgID18+"&apiName=DAT", bytes.NewReader(payload))
+		req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		req.Header.Set(mesh.HdrSignature, "signature")
+		recorder := httptest.NewRecorder()
+		serviceMesh(recorder, req)
+		statuses = append(statuses, recorder.Code)
+	}
+
+	// Redelivery after the app's failure is accepted, redelivery after success is a replay
+	if statuses[0] != http.StatusServiceUnavailable || statuses[1] != http.StatusOK || statuses[2] != http.StatusConflict {
+		t.Errorf("Expected [503 200 409], got %v", statuses)
+	}
+
+	if appRequests != 2 {
+		t.Errorf("Expected 2 app requests, got %d", appRequests)
+	}
+}
+
+func Test_ReplayGuardForget(t *testing.T) {
+	now := time.Now()
+	replayGuard := mesh.NewReplayGuard()
+	payload := []byte(`{"events":[]}`)
+
+	if err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOrgID18, "signature", payload, now); err != nil {
+		t.Fatal(err)
+	}
+
+	replayGuard.Forget(MockOrgID18, "signature", payload)
+	if err := replayGuard.CheckReplay(MockRequestID, MockReplayProtection, MockOrgID18, "signature", payload, now); err != nil {
+		t.Errorf("Expected forgotten request allowed, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package mesh
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func Test_IsReportOnly(t *testing.T) {
+	enforce := false
+	config := &conf.Config{
+		YamlConfig: &conf.YamlConfig{
+			Mesh: conf.Mesh{Authentication: conf.Authentication{ReportOnly: true}},
+		},
+	}
+
+	if !mesh.IsReportOnly(config, nil) {
+		t.Error("Should be report-only")
+	}
+
+	if mesh.IsReportOnly(config, &conf.Route{Path: "/my-api", ReportOnly: &enforce}) {
+		t.Error("Route should override report-only")
+	}
+
+	if !mesh.IsReportOnly(config, &conf.Route{Path: "/my-api"}) {
+		t.Error("Route should inherit report-only")
+	}
+}
+
+func Test_ServiceMeshReportOnly(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer authServer.Close()
+
+	appRequests := 0
+	verdict := ""
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		appRequests++
+		verdict = request.Header.Get(mesh.HdrMeshVerdict)
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	newRequest := func() *http.Request {
+		incomingReq := httptest.NewRequest(http.MethodPost, "/my-api", nil)
+		incomingReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+		incomingReq.Header.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+		incomingReq.Header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+		incomingReq.Header.Set(mesh.HdrMeshVerdict, "allow")
+		return incomingReq
+	}
+
+	// Enforced
+	incomingRespWriter := httptest.NewRecorder()
+	serviceMesh(incomingRespWriter, newRequest())
+	if incomingRespWriter.Code != http.StatusForbidden {
+		t.Errorf("Expected %d, got %d", http.StatusForbidden, incomingRespWriter.Code)
+	}
+
+	if appRequests != 0 {
+		t.Error("Should NOT forward denied request")
+	}
+
+	// Report-only
+	config.YamlConfig.Mesh.Authentication.ReportOnly = true
+	incomingRespWriter = httptest.NewRecorder()
+	serviceMesh(incomingRespWriter, newRequest())
+	if incomingRespWriter.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, incomingRespWriter.Code)
+	}
+
+	if appRequests != 1 {
+		t.Error("Should forward report-only request")
+	}
+
+	if verdict != "would-deny" {
+		t.Errorf("Expected would-deny verdict, got '%s'", verdict)
+	}
+
+	if mesh.GetMetrics().Counter(mesh.MetricWouldDenyTotal, "route", "", "kind", "forbidden", "status", "403") < 1 {
+		t.Error("Should count would deny request")
+	}
+}
+
+func Test_ServiceMeshReportOnlyDoesNotForwardUnauthenticatedIdentity(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer authServer.Close()
+
+	var forwardedHeaders http.Header
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		forwardedHeaders = request.Header.Clone()
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.IdentityTokenSecret = MockIdentityTokenSecret
+	config.YamlConfig.Mesh.IdentityHeaders = MockIdentityHeaders
+	config.YamlConfig.Mesh.IdentityToken = newIdentityTokenConfig(conf.IdentityTokenAlgorithmHS256, "").YamlConfig.Mesh.IdentityToken
+	config.YamlConfig.Mesh.Authentication.ReportOnly = true
+
+	// Spoofed org
+	incomingReq := httptest.NewRequest(http.MethodPost, "/my-api", nil)
+	incomingReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	incomingReq.Header.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+	incomingReq.Header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+	incomingRespWriter := httptest.NewRecorder()
+	mesh.NewRoutesWithConfig(config).ServiceMesh()(incomingRespWriter, incomingReq)
+
+	if incomingRespWriter.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, incomingRespWriter.Code)
+	}
+
+	if forwardedHeaders.Get(conf.IdentityTokenHeader) != "" {
+		t.Error("Should NOT sign identity token for would deny request")
+	}
+
+	if forwardedHeaders.Get(conf.IdentityHeaderOrgID) != "" || forwardedHeaders.Get(conf.IdentityHeaderRequestType) != "" {
+		t.Errorf("Should NOT forward identity headers for would deny request, got %v", forwardedHeaders)
+	}
+
+	if forwardedHeaders.Get(mesh.HdrMeshVerdict) != "would-deny" {
+		t.Errorf("Expected would-deny verdict, got '%s'", forwardedHeaders.Get(mesh.HdrMeshVerdict))
+	}
+}
+
+func Test_VerdictReason(t *testing.T) {
+	if reason := mesh.VerdictReason(mesh.NewForbiddenRequest("Org not allowed")); reason != "forbidden: Org not allowed" {
+		t.Errorf("Expected kind and detail, got '%s'", reason)
+	}
+
+	if reason := mesh.VerdictReason(mesh.NewForbiddenRequest("Org\r\nnot allowed")); reason != "forbidden: Orgnot allowed" {
+		t.Errorf("Expected control characters stripped, got '%s'", reason)
+	}
+
+	if reason := mesh.VerdictReason(errors.New("internal cause")); reason != "internal" {
+		t.Errorf("Expected internal, got '%s'", reason)
+	}
+}
+
+func Test_ServiceMeshReportOnlyOmitsUpstreamAuthResponse(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+		responseWriter.Write([]byte("upstream failure\r\ninternal: secret"))
+	}))
+	defer authServer.Close()
+
+	reason := ""
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		reason = request.Header.Get(mesh.HdrMeshVerdictReason)
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.Authentication.ReportOnly = true
+
+	incomingReq := httptest.NewRequest(http.MethodPost, "/my-api", nil)
+	incomingReq.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	incomingReq.Header.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+	incomingReq.Header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+	incomingRespWriter := httptest.NewRecorder()
+	mesh.NewRoutesWithConfig(config).ServiceMesh()(incomingRespWriter, incomingReq)
+
+	if incomingRespWriter.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, incomingRespWriter.Code)
+	}
+
+	if reason != "upstream-auth-failure" {
+		t.Errorf("Expected upstream-auth-failure reason, got '%s'", reason)
+	}
+}
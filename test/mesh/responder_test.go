@@ -0,0 +1,115 @@
+package mesh
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	meshErrors "github.com/heroku/heroku-integration-service-mesh/errors"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func decodeProblem(t *testing.T, recorder *httptest.ResponseRecorder) meshErrors.Problem {
+	if contentType := recorder.Header().Get("Content-Type"); contentType != meshErrors.ContentTypeProblemJSON {
+		t.Fatalf("Expected %s, got %s", meshErrors.ContentTypeProblemJSON, contentType)
+	}
+
+	var problem meshErrors.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+
+	return problem
+}
+
+func Test_WriteError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	recorder := httptest.NewRecorder()
+	mesh.WriteError(MockRequestID, recorder, req, mesh.NewForbiddenRequest("Org not allowed"))
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", recorder.Code)
+	}
+
+	problem := decodeProblem(t, recorder)
+	if problem.Status != http.StatusForbidden || problem.Code != meshErrors.Forbidden.String() || problem.Title != "Forbidden" {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+
+	if problem.Detail != "Org not allowed" || problem.RequestID != MockRequestID || problem.Type != meshErrors.ProblemTypeDefault {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+}
+
+func Test_WriteErrorSafeDetail(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	// Server errors and unknown errors do not leak their messages
+	for status, err := range map[int]error{
+		http.StatusInternalServerError: errors.New("secret error"),
+		http.StatusBadGateway:          mesh.NewUpstreamAuthFailure(errors.New("secret upstream body")),
+	} {
+		recorder := httptest.NewRecorder()
+		mesh.WriteError(MockRequestID, recorder, req, err)
+
+		problem := decodeProblem(t, recorder)
+		if recorder.Code != status || strings.Contains(problem.Detail, "secret") {
+			t.Errorf("Expected %d without detail, got %d %+v", status, recorder.Code, problem)
+		}
+	}
+}
+
+func Test_WriteErrorPlainText(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Accept", "text/plain")
+	recorder := httptest.NewRecorder()
+	mesh.WriteError(MockRequestID, recorder, req, mesh.NewMalformedRequest("Invalid body"))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", recorder.Code)
+	}
+
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") || recorder.Body.String() != "Invalid body\n" {
+		t.Errorf("Expected plain text detail, got %s", recorder.Body.String())
+	}
+}
+
+func Test_AcceptsJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                    true,
+		"*/*":                                 true,
+		"application/json":                    true,
+		"text/html, application/problem+json": true,
+		"application/json;q=0, text/plain":    false,
+		"text/plain":                          false,
+		"text/html":                           false,
+	} {
+		headers := http.Header{}
+		if accept != "" {
+			headers.Set("Accept", accept)
+		}
+
+		if actual := mesh.AcceptsJSON(headers); actual != expected {
+			t.Errorf("Expected %v for Accept '%s', got %v", expected, accept, actual)
+		}
+	}
+}
+
+func Test_ServiceMeshProblemResponse(t *testing.T) {
+	config := NewMockConfig("http://localhost:1", "http://localhost:1")
+	serviceMesh := mesh.NewRoutesWithConfig(config).ServiceMesh()
+
+	// Missing x-request-context header
+	req := httptest.NewRequest(http.MethodPost, "/accounts", nil)
+	req.Header.Set("x-request-id", MockRequestID)
+	recorder := httptest.NewRecorder()
+	serviceMesh(recorder, req)
+
+	problem := decodeProblem(t, recorder)
+	if problem.Status != recorder.Code || problem.RequestID != MockRequestID || problem.Code == "" {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+}
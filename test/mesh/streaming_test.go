@@ -0,0 +1,146 @@
+package mesh
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func newStreamingRequest(t *testing.T, ctx context.Context, url string) *http.Request {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(mesh.HdrNameRequestID, MockRequestID)
+	req.Header.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+	req.Header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+	return req
+}
+
+func Test_IsStreamingResponse(t *testing.T) {
+	streaming := conf.Streaming{ContentTypes: []string{"application/x-ndjson"}}
+
+	for contentType, expected := range map[string]bool{
+		"text/event-stream":                true,
+		"text/event-stream; charset=utf-8": true,
+		"application/x-ndjson":             true,
+		"application/json":                 false,
+		"":                                 false,
+	} {
+		forwardResp := &http.Response{Header: http.Header{mesh.HdrContentType: {contentType}}}
+		if mesh.IsStreamingResponse(streaming, forwardResp) != expected {
+			t.Errorf("Expected %v for '%s'", expected, contentType)
+		}
+	}
+}
+
+func Test_ServiceMeshStreamsEvents(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	// The app sends each event only once the previous event was received by the client
+	received := make(chan struct{})
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Set(mesh.HdrContentType, mesh.ContentTypeEventStream)
+		responseWriter.Header().Set("Trailer", "X-Event-Count")
+		responseWriter.WriteHeader(http.StatusOK)
+		for _, event := range []string{"one", "two", "three"} {
+			io.WriteString(responseWriter, "data: "+event+"\n\n")
+			responseWriter.(http.Flusher).Flush()
+
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Error("Event NOT flushed to client")
+				return
+			}
+		}
+		responseWriter.Header().Set("X-Event-Count", "3")
+	}))
+	defer appServer.Close()
+
+	meshServer := httptest.NewServer(mesh.NewRoutesWithConfig(NewMockConfig(authServer.URL, appServer.URL)).ServiceMesh())
+	defer meshServer.Close()
+
+	resp, err := http.DefaultClient.Do(newStreamingRequest(t, context.Background(), meshServer.URL+"/events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	events := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if line == "\n" {
+			events++
+			received <- struct{}{}
+		}
+	}
+
+	if events != 3 {
+		t.Errorf("Expected 3 events, got %d", events)
+	}
+
+	if resp.Trailer.Get("X-Event-Count") != "3" {
+		t.Errorf("Expected X-Event-Count trailer, got %v", resp.Trailer)
+	}
+}
+
+func Test_ServiceMeshStreamCancellation(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	canceled := make(chan struct{})
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Set(mesh.HdrContentType, "application/x-ndjson")
+		responseWriter.WriteHeader(http.StatusOK)
+		io.WriteString(responseWriter, `{"token":"hello"}`+"\n")
+		responseWriter.(http.Flusher).Flush()
+
+		select {
+		case <-request.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.Streaming.ContentTypes = []string{"application/x-ndjson"}
+	meshServer := httptest.NewServer(mesh.NewRoutesWithConfig(config).ServiceMesh())
+	defer meshServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err := http.DefaultClient.Do(newStreamingRequest(t, ctx, meshServer.URL+"/tokens"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if line, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil || line != `{"token":"hello"}`+"\n" {
+		t.Fatalf("Expected first token streamed, got '%s' %v", line, err)
+	}
+
+	cancel()
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("Should cancel app request when client disconnects")
+	}
+}
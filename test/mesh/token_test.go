@@ -0,0 +1,171 @@
+package mesh
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+var MockIdentityTokenSecret = []byte("01234567890123456789012345678901")
+
+func newIdentityTokenConfig(algorithm string, keyFile string) *conf.Config {
+	return &conf.Config{
+		IdentityTokenSecret: MockIdentityTokenSecret,
+		YamlConfig: &conf.YamlConfig{
+			Mesh: conf.Mesh{
+				IdentityToken: conf.IdentityToken{
+					Enable:    true,
+					Algorithm: algorithm,
+					KeyFile:   keyFile,
+					Header:    conf.IdentityTokenHeader,
+					Issuer:    conf.IdentityTokenIssuer,
+					TTL:       time.Minute,
+				},
+			},
+		},
+	}
+}
+
+func decodeIdentityToken(t *testing.T, token string) (string, mesh.IdentityClaims, []byte) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected JWT, got %s", token)
+	}
+
+	claimsJson, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims mesh.IdentityClaims
+	if err := json.Unmarshal(claimsJson, &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parts[0] + "." + parts[1], claims, signature
+}
+
+func Test_TokenSignerHS256(t *testing.T) {
+	signer, err := mesh.NewTokenSigner(newIdentityTokenConfig(conf.IdentityTokenAlgorithmHS256, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity := mesh.NewIdentity()
+	identity.SetRequestHeader(&mesh.RequestHeader{XRequestContext: *MockValidXRequestContext, IsSalesforceRequest: true}, nil)
+	now := time.Now()
+
+	token, err := signer.Sign(MockRequestID, identity, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput, claims, signature := decodeIdentityToken(t, token)
+	mac := hmac.New(sha256.New, MockIdentityTokenSecret)
+	mac.Write([]byte(signingInput))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		t.Error("Invalid HS256 signature")
+	}
+
+	if claims.OrgID != MockOrgID18 || claims.AppUUID != MockUUID || claims.RequestID != MockRequestID {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+
+	if claims.RequestType != conf.RequestTypeSalesforce || claims.AuthOutcome != "pass-through" {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+
+	if claims.ExpiresAt != now.Add(time.Minute).Unix() {
+		t.Errorf("Expected exp %d, got %d", now.Add(time.Minute).Unix(), claims.ExpiresAt)
+	}
+
+	if len(signer.JWKS().Keys) != 0 {
+		t.Error("Should NOT publish HS256 secret")
+	}
+}
+
+func Test_TokenSignerEdDSA(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKeyDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "identity-token.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := mesh.NewTokenSigner(newIdentityTokenConfig(conf.IdentityTokenAlgorithmEdDSA, keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signer.Sign(MockRequestID, mesh.NewIdentity(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput, _, signature := decodeIdentityToken(t, token)
+	if !ed25519.Verify(publicKey, []byte(signingInput), signature) {
+		t.Error("Invalid EdDSA signature")
+	}
+
+	jwks := signer.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].X != base64.RawURLEncoding.EncodeToString(publicKey) {
+		t.Errorf("Expected published public key, got %v", jwks)
+	}
+
+	_, err = mesh.NewTokenSigner(newIdentityTokenConfig(conf.IdentityTokenAlgorithmEdDSA, "missing.pem"))
+	if err == nil {
+		t.Error("Expected missing key file error")
+	}
+}
+
+func Test_ServiceMeshForwardsIdentityToken(t *testing.T) {
+	token := ""
+	appServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		token = request.Header.Get(conf.IdentityTokenHeader)
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer appServer.Close()
+
+	config := NewMockConfig("", appServer.URL)
+	config.ShouldBypassAllRoutes = true
+	config.IdentityTokenSecret = MockIdentityTokenSecret
+	config.YamlConfig.Mesh.IdentityToken = newIdentityTokenConfig(conf.IdentityTokenAlgorithmHS256, "").YamlConfig.Mesh.IdentityToken
+
+	incomingReq := httptest.NewRequest(http.MethodGet, "/my-api", nil)
+	incomingReq.Header.Set(conf.IdentityTokenHeader, "spoofed")
+	mesh.NewRoutesWithConfig(config).ServiceMesh()(httptest.NewRecorder(), incomingReq)
+
+	_, claims, _ := decodeIdentityToken(t, token)
+	if claims.AuthOutcome != "pass-through" || claims.RequestType != conf.RequestTypeNone {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+}
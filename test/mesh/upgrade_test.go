@@ -0,0 +1,218 @@
+package mesh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+)
+
+func newUpgradeConfig(authUrl string, appUrl string) *conf.Config {
+	config := NewMockConfig(authUrl, appUrl)
+	config.YamlConfig.Mesh.Upgrade = conf.Upgrade{
+		Enable:      true,
+		Protocols:   []string{conf.UpgradeProtocolWebSocket},
+		IdleTimeout: time.Minute,
+	}
+	return config
+}
+
+func newUpgradeHeader() http.Header {
+	header := http.Header{}
+	header.Set(mesh.HdrNameRequestID, MockRequestID)
+	header.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+	header.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+	return header
+}
+
+// newEchoServer echoes WebSocket messages, recording each handshake's client context
+func newEchoServer(t *testing.T, clientContexts chan<- string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/declined" {
+			responseWriter.WriteHeader(http.StatusTeapot)
+			return
+		}
+
+		clientContexts <- request.Header.Get(mesh.HdrClientContext)
+		conn, err := upgrader.Upgrade(responseWriter, request, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func Test_IsUpgradeRequest(t *testing.T) {
+	upgrade := newUpgradeConfig("http://localhost:1", "http://localhost:2").YamlConfig.Mesh.Upgrade
+
+	for _, test := range []struct {
+		connection string
+		protocol   string
+		expected   bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, Upgrade", "WebSocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "h2c", false},
+		{"Upgrade", "", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		req.Header.Set("Connection", test.connection)
+		req.Header.Set(mesh.HdrUpgrade, test.protocol)
+		if mesh.IsUpgradeRequest(upgrade, req) != test.expected {
+			t.Errorf("Expected %v for Connection '%s' Upgrade '%s'", test.expected, test.connection, test.protocol)
+		}
+	}
+
+	upgrade.Enable = false
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set(mesh.HdrUpgrade, "websocket")
+	if mesh.IsUpgradeRequest(upgrade, req) {
+		t.Error("Should NOT upgrade when disabled")
+	}
+}
+
+func Test_ServiceMeshWebSocket(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	clientContexts := make(chan string, 10)
+	appServer := newEchoServer(t, clientContexts)
+	defer appServer.Close()
+
+	meshServer := httptest.NewServer(mesh.NewRoutesWithConfig(newUpgradeConfig(authServer.URL, appServer.URL)).ServiceMesh())
+	defer meshServer.Close()
+
+	wsUrl := "ws" + strings.TrimPrefix(meshServer.URL, "http") + "/ws"
+	upgraded := mesh.GetMetrics().Counter(mesh.MetricUpgradeConnectionsTotal, "route", "", "protocol", "websocket", "outcome", "upgraded")
+	conn, resp, err := websocket.DefaultDialer.Dial(wsUrl, newUpgradeHeader())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v %v", err, resp)
+	}
+
+	if clientContext := <-clientContexts; clientContext != ConvertClientContextToString(MockValidXClientContext) {
+		t.Errorf("Expected client context forwarded, got '%s'", clientContext)
+	}
+
+	for _, message := range []string{"hello", "there"} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+
+		_, echoed, err := conn.ReadMessage()
+		if err != nil || string(echoed) != message {
+			t.Errorf("Expected '%s' echoed, got '%s' %v", message, echoed, err)
+		}
+	}
+	conn.Close()
+
+	if mesh.GetMetrics().Counter(mesh.MetricUpgradeConnectionsTotal, "route", "", "protocol", "websocket", "outcome", "upgraded") != upgraded+1 {
+		t.Error("Should count upgraded connection")
+	}
+
+	// App declines upgrade
+	_, resp, err = websocket.DefaultDialer.Dial(strings.TrimSuffix(wsUrl, "/ws")+"/declined", newUpgradeHeader())
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTeapot {
+		t.Errorf("Expected app's %d response, got %v", http.StatusTeapot, resp)
+	}
+
+	// Unauthenticated handshakes are NOT forwarded
+	_, resp, err = websocket.DefaultDialer.Dial(wsUrl, http.Header{mesh.HdrNameRequestID: {MockRequestID}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %v", http.StatusUnauthorized, resp)
+	}
+
+	if len(clientContexts) != 0 {
+		t.Error("Should NOT forward unauthenticated handshake")
+	}
+}
+
+func Test_ServiceMeshWebSocketIdleTimeout(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	clientContexts := make(chan string, 10)
+	appServer := newEchoServer(t, clientContexts)
+	defer appServer.Close()
+
+	config := newUpgradeConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.Upgrade.IdleTimeout = 100 * time.Millisecond
+	meshServer := httptest.NewServer(mesh.NewRoutesWithConfig(config).ServiceMesh())
+	defer meshServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(meshServer.URL, "http")+"/ws", newUpgradeHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Expected idle connection closed by mesh, got %v", err)
+	}
+}
+
+func Test_ServiceMeshWebSocketConcurrencyLimit(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	clientContexts := make(chan string, 10)
+	appServer := newEchoServer(t, clientContexts)
+	defer appServer.Close()
+
+	config := newUpgradeConfig(authServer.URL, appServer.URL)
+	config.YamlConfig.Mesh.Concurrency = conf.Concurrency{Enable: true, MaxInFlight: 1, QueueTimeout: time.Second}
+	meshServer := httptest.NewServer(mesh.NewRoutesWithConfig(config).ServiceMesh())
+	defer meshServer.Close()
+
+	wsUrl := "ws" + strings.TrimPrefix(meshServer.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, newUpgradeHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Open connections hold a concurrency slot
+	_, resp, err := websocket.DefaultDialer.Dial(wsUrl, newUpgradeHeader())
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d, got %v", http.StatusServiceUnavailable, resp)
+	}
+
+	// Closed connections release their slot
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, _, err = websocket.DefaultDialer.Dial(wsUrl, newUpgradeHeader())
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected connection after slot released, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"github.com/google/uuid"
+	"strings"
 
+	"github.com/heroku/heroku-integration-service-mesh/conf"
 	"github.com/heroku/heroku-integration-service-mesh/mesh"
 )
 
@@ -22,6 +24,28 @@ var MockValidXRequestContext = &mesh.XRequestContext{
 	AppUUID:      MockUUID,
 }
 
+var MockValidXClientContext = &mesh.XClientContext{
+	AccessToken:  "accessToken",
+	ApiVersion:   "62.0",
+	Namespace:    "",
+	OrgID:        MockOrgID18,
+	OrgDomainUrl: "http://org.salesforce.com",
+	RequestID:    MockRequestID,
+	UserContext: mesh.UserContext{
+		UserID:   "005xx000001X8Uz",
+		Username: "admin@example.com",
+	},
+}
+
+func ConvertClientContextToString(clientContext *mesh.XClientContext) string {
+	clientContextJson, err := json.Marshal(clientContext)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(clientContextJson)
+}
+
 func ConvertContextToString(context *mesh.XRequestContext) string {
 	requestContextJson, err := json.Marshal(context)
 	if err != nil {
@@ -30,3 +54,20 @@ func ConvertContextToString(context *mesh.XRequestContext) string {
 
 	return base64.StdEncoding.EncodeToString(requestContextJson)
 }
+
+// NewMockConfig builds config for the given Heroku Integration API and app URLs
+func NewMockConfig(herokuIntegrationUrl string, appUrl string) *conf.Config {
+	appUrlParts := strings.Split(appUrl, ":")
+	return &conf.Config{
+		HerokuInvocationToken:                     "HerokuInvocationToken",
+		HerokuIntegrationUrl:                      herokuIntegrationUrl,
+		HerokuInvocationSalesforceAuthPath:        conf.HerokuIntegrationSalesforceAuthPath,
+		HerokuIntegrationDataActionTargetAuthPath: conf.HerokuIntegrationDataActionTargetAuthPath,
+		YamlConfig: &conf.YamlConfig{
+			App: conf.App{
+				Host: appUrlParts[0] + ":" + appUrlParts[1],
+				Port: appUrlParts[2],
+			},
+		},
+	}
+}
@@ -1,10 +1,13 @@
 package mesh
 
 import (
+	"fmt"
 	"github.com/google/uuid"
 	"net/http"
+	"reflect"
 	"testing"
 
+	"github.com/heroku/heroku-integration-service-mesh/conf"
 	"github.com/heroku/heroku-integration-service-mesh/mesh"
 )
 
@@ -12,7 +15,7 @@ func Test_ValidateRequest_Success(t *testing.T) {
 	headers := http.Header{}
 	headers.Set(mesh.HdrNameRequestID, MockRequestID)
 	headers.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
-	headers.Set(mesh.HdrClientContext, MockValidXRequestContext.ID)
+	headers.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
 
 	validRequestHeader, err := mesh.ValidateRequest(MockRequestID, headers)
 
@@ -51,7 +54,7 @@ func Test_ValidateRequest_NoExpectedHeaders(t *testing.T) {
 func Test_InvalidRequestID(t *testing.T) {
 	headers := http.Header{}
 	headers.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
-	headers.Set(mesh.HdrClientContext, MockValidXRequestContext.ID)
+	headers.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
 
 	_, err := mesh.ValidateRequest("INVALID-REQUEST-ID", headers)
 
@@ -72,7 +75,7 @@ func Test_InvalidRequestID(t *testing.T) {
 func Test_ValidateRequest_MissingRequestContextHeader(t *testing.T) {
 	headers := http.Header{}
 	headers.Set(mesh.HdrNameRequestID, MockValidXRequestContext.OrgID)
-	headers.Set(mesh.HdrClientContext, MockValidXRequestContext.ID)
+	headers.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
 
 	_, err := mesh.ValidateRequest(MockRequestID, headers)
 
@@ -149,3 +152,130 @@ func Test_IsDataActionTargetRequest(t *testing.T) {
 		t.Error("IsSalesforceRequest should be false")
 	}
 }
+
+func Test_ValidateRequest_CollectsAllViolations(t *testing.T) {
+	incompleteXRequestContext := *MockValidXRequestContext
+	incompleteXRequestContext.ID = "mismatch"
+	incompleteXRequestContext.OrgID = ""
+	incompleteXRequestContext.AppUUID = ""
+
+	headers := http.Header{}
+	headers.Set(mesh.HdrRequestContext, ConvertContextToString(&incompleteXRequestContext))
+
+	_, err := mesh.ValidateRequest(MockRequestID, headers)
+	invalidRequest, ok := err.(*mesh.InvalidRequest)
+	if !ok {
+		t.Fatalf("Expected mesh.InvalidRequest, got %v", err)
+	}
+
+	if invalidRequest.HttpStatusCode() != http.StatusBadRequest {
+		t.Errorf("Expected %d, got %d", http.StatusBadRequest, invalidRequest.HttpStatusCode())
+	}
+
+	var fields []string
+	for _, violation := range invalidRequest.Violations {
+		fields = append(fields, violation.Field)
+	}
+
+	expected := []string{"x-client-context", "x-request-context.orgId", "x-request-context.appUuid", "x-request-context.id"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected violations %v, got %v", expected, fields)
+	}
+}
+
+func Test_ValidateRequest_InvalidEncoding(t *testing.T) {
+	headers := http.Header{}
+	headers.Set(mesh.HdrRequestContext, "not base64!")
+	headers.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+
+	_, err := mesh.ValidateRequest(MockRequestID, headers)
+	invalidRequest, ok := err.(*mesh.InvalidRequest)
+	if !ok || len(invalidRequest.Violations) != 1 || invalidRequest.Violations[0].Message != "Invalid base64 encoding" {
+		t.Errorf("Expected invalid base64 encoding violation, got %v", err)
+	}
+}
+
+func Test_WithValidationVerbosity(t *testing.T) {
+	config := NewMockConfig("http://localhost:1", "http://localhost:1")
+	_, err := mesh.ValidateRequest(MockRequestID, http.Header{})
+
+	minimal := mesh.WithValidationVerbosity(config, err).(*mesh.InvalidRequest)
+	if len(minimal.Violations) != 0 {
+		t.Errorf("Expected no violations, got %v", minimal.Violations)
+	}
+
+	if len(err.(*mesh.InvalidRequest).Violations) == 0 {
+		t.Error("Expected original violations to be preserved")
+	}
+
+	config.YamlConfig.Mesh.Validation.Verbosity = conf.ValidationVerbosityDetailed
+	detailed := mesh.WithValidationVerbosity(config, err).(*mesh.InvalidRequest)
+	if len(detailed.Violations) != 3 {
+		t.Errorf("Expected 3 violations, got %v", detailed.Violations)
+	}
+}
+
+func Test_WithValidationVerbosityWrappedError(t *testing.T) {
+	config := NewMockConfig("http://localhost:1", "http://localhost:1")
+	_, err := mesh.ValidateRequest(MockRequestID, http.Header{})
+
+	minimal, ok := mesh.WithValidationVerbosity(config, fmt.Errorf("validating request: %w", err)).(*mesh.InvalidRequest)
+	if !ok || len(minimal.Violations) != 0 {
+		t.Errorf("Expected InvalidRequest without violations, got %v", minimal)
+	}
+}
+
+func Test_ValidateRequest_ClientContext(t *testing.T) {
+	headers := http.Header{}
+	headers.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+	headers.Set(mesh.HdrClientContext, ConvertClientContextToString(MockValidXClientContext))
+
+	requestHeader, err := mesh.ValidateRequest(MockRequestID, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requestHeader.ClientContext.UserContext.UserID != MockValidXClientContext.UserContext.UserID ||
+		requestHeader.ClientContext.ApiVersion != MockValidXClientContext.ApiVersion {
+		t.Errorf("Expected decoded client context, got %+v", requestHeader.ClientContext)
+	}
+}
+
+func Test_ValidateRequest_InvalidClientContext(t *testing.T) {
+	otherOrgClientContext := *MockValidXClientContext
+	otherOrgClientContext.OrgID = "00Dxx0000000001EAA"
+	otherOrgClientContext.RequestID = "other-request-id"
+
+	for name, test := range map[string]struct {
+		clientContext string
+		fields        []string
+	}{
+		"not base64":  {"not base64!", []string{"x-client-context"}},
+		"not JSON":    {"bm90IEpTT04=", []string{"x-client-context"}},
+		"mismatch":    {ConvertClientContextToString(&otherOrgClientContext), []string{"x-client-context.orgId", "x-client-context.requestId"}},
+		"missing org": {ConvertClientContextToString(&mesh.XClientContext{}), []string{"x-client-context.orgId"}},
+	} {
+		headers := http.Header{}
+		headers.Set(mesh.HdrRequestContext, ConvertContextToString(MockValidXRequestContext))
+		headers.Set(mesh.HdrClientContext, test.clientContext)
+
+		_, err := mesh.ValidateRequest(MockRequestID, headers)
+		invalidRequest, ok := err.(*mesh.InvalidRequest)
+		if !ok {
+			t.Errorf("%s: expected mesh.InvalidRequest, got %v", name, err)
+			continue
+		}
+
+		if invalidRequest.HttpStatusCode() != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", name, http.StatusBadRequest, invalidRequest.HttpStatusCode())
+		}
+
+		var fields []string
+		for _, violation := range invalidRequest.Violations {
+			fields = append(fields, violation.Field)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: expected violations %v, got %v", name, test.fields, fields)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package meshcontext
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+	"github.com/heroku/heroku-integration-service-mesh/meshcontext"
+	"github.com/heroku/heroku-integration-service-mesh/meshcontext/meshcontexttest"
+)
+
+var MockSecret = []byte("01234567890123456789012345678901")
+
+// serve calls the middleware-wrapped handler, returning the response and the handler's mesh context
+func serve(options meshcontext.Options, req *http.Request) (*httptest.ResponseRecorder, *meshcontext.Context) {
+	var meshContext *meshcontext.Context
+	handler := meshcontext.Middleware(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meshContext, _ = meshcontext.FromContext(r.Context())
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder, meshContext
+}
+
+func Test_HeaderNamesMatchMeshDefaults(t *testing.T) {
+	for header, expected := range map[string]string{
+		meshcontext.HdrOrgID:         conf.IdentityHeaderOrgID,
+		meshcontext.HdrOrgDomainUrl:  conf.IdentityHeaderOrgDomainUrl,
+		meshcontext.HdrAppUUID:       conf.IdentityHeaderAppUUID,
+		meshcontext.HdrContextType:   conf.IdentityHeaderContextType,
+		meshcontext.HdrResource:      conf.IdentityHeaderResource,
+		meshcontext.HdrRequestType:   conf.IdentityHeaderRequestType,
+		meshcontext.HdrAuthOutcome:   conf.IdentityHeaderAuthOutcome,
+		meshcontext.HdrIdentityToken: conf.IdentityTokenHeader,
+		meshcontext.TokenIssuer:      conf.IdentityTokenIssuer,
+	} {
+		if header != expected {
+			t.Errorf("Expected %s, got %s", expected, header)
+		}
+	}
+}
+
+func Test_MiddlewareIdentityHeaders(t *testing.T) {
+	expected := meshcontexttest.NewContext()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	meshcontexttest.SetHeaders(req.Header, expected)
+
+	recorder, meshContext := serve(meshcontext.Options{HS256Secret: MockSecret}, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+
+	if *meshContext != *expected {
+		t.Errorf("Expected %+v, got %+v", expected, meshContext)
+	}
+
+	if !meshContext.IsAuthenticated() {
+		t.Error("Expected authenticated context")
+	}
+}
+
+func Test_MiddlewareCustomHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("x-org", meshcontexttest.OrgID)
+
+	_, meshContext := serve(meshcontext.Options{HS256Secret: MockSecret, Headers: meshcontext.Headers{OrgID: "x-org"}}, req)
+	if meshContext.OrgID != meshcontexttest.OrgID {
+		t.Errorf("Expected %s, got %s", meshcontexttest.OrgID, meshContext.OrgID)
+	}
+}
+
+func Test_MiddlewareHS256Token(t *testing.T) {
+	config := &conf.Config{
+		IdentityTokenSecret: MockSecret,
+		YamlConfig: &conf.YamlConfig{Mesh: conf.Mesh{IdentityToken: conf.IdentityToken{
+			Enable:    true,
+			Algorithm: conf.IdentityTokenAlgorithmHS256,
+			Header:    conf.IdentityTokenHeader,
+			Issuer:    conf.IdentityTokenIssuer,
+			TTL:       time.Minute,
+		}}},
+	}
+	signer, err := mesh.NewTokenSigner(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	// Spoofed identity headers are ignored when a token is present
+	req.Header.Set(meshcontext.HdrOrgID, "spoofed")
+	if err := mesh.SetIdentityToken("request-id", signer, req.Header, newMeshIdentity()); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, meshContext := serve(meshcontext.Options{HS256Secret: MockSecret, RequireToken: true}, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+
+	if !meshContext.Verified || meshContext.OrgID != meshcontexttest.OrgID || meshContext.RequestID != "request-id" {
+		t.Errorf("Expected verified context, got %+v", meshContext)
+	}
+
+	if meshContext.RequestType != meshcontext.RequestTypeSalesforce || meshContext.AuthOutcome != meshcontext.AuthOutcomePassThrough {
+		t.Errorf("Unexpected request type or outcome, got %+v", meshContext)
+	}
+}
+
+func Test_MiddlewareHS256SecretFromEnv(t *testing.T) {
+	t.Setenv(meshcontext.TokenSecretEnvVar, "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE")
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(meshcontext.HdrIdentityToken, meshcontexttest.SignHS256(MockSecret, meshcontexttest.NewContext(), time.Minute))
+
+	recorder, meshContext := serve(meshcontext.Options{}, req)
+	if recorder.Code != http.StatusOK || !meshContext.Verified {
+		t.Errorf("Expected verified context, got %d", recorder.Code)
+	}
+}
+
+func Test_MiddlewareEdDSAToken(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signEdDSA(t, privateKey)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(meshcontext.HdrIdentityToken, token)
+
+	recorder, meshContext := serve(meshcontext.Options{Ed25519PublicKey: publicKey, RequireToken: true}, req)
+	if recorder.Code != http.StatusOK || !meshContext.Verified {
+		t.Fatalf("Expected verified context, got %d", recorder.Code)
+	}
+
+	// HS256 secret does not verify EdDSA tokens
+	recorder, _ = serve(meshcontext.Options{HS256Secret: MockSecret}, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", recorder.Code)
+	}
+}
+
+func Test_MiddlewareInvalidToken(t *testing.T) {
+	meshContext := meshcontexttest.NewContext()
+	for name, token := range map[string]string{
+		"malformed":    "not-a-jwt",
+		"wrong secret": meshcontexttest.SignHS256([]byte("wrong"), meshContext, time.Minute),
+		"expired":      meshcontexttest.SignHS256(MockSecret, meshContext, -time.Second),
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(meshcontext.HdrIdentityToken, token)
+
+		recorder, _ := serve(meshcontext.Options{HS256Secret: MockSecret}, req)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, recorder.Code)
+		}
+	}
+}
+
+func Test_MiddlewareRequireToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	meshcontexttest.SetHeaders(req.Header, meshcontexttest.NewContext())
+
+	recorder, _ := serve(meshcontext.Options{HS256Secret: MockSecret, RequireToken: true}, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", recorder.Code)
+	}
+}
+
+func Test_ContextHelpers(t *testing.T) {
+	req := meshcontexttest.NewRequest(http.MethodGet, "/", meshcontexttest.NewContext(func(c *meshcontext.Context) {
+		c.RequestType = meshcontext.RequestTypeDataActionTarget
+	}))
+
+	if meshcontext.OrgID(req.Context()) != meshcontexttest.OrgID {
+		t.Errorf("Expected %s, got %s", meshcontexttest.OrgID, meshcontext.OrgID(req.Context()))
+	}
+
+	if meshcontext.RequestType(req.Context()) != meshcontext.RequestTypeDataActionTarget {
+		t.Errorf("Expected %s, got %s", meshcontext.RequestTypeDataActionTarget, meshcontext.RequestType(req.Context()))
+	}
+
+	if meshcontext.RequestID(req.Context()) != meshcontexttest.RequestID {
+		t.Errorf("Expected %s, got %s", meshcontexttest.RequestID, meshcontext.RequestID(req.Context()))
+	}
+
+	if meshcontext.OrgID(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != "" {
+		t.Error("Expected empty org ID without mesh context")
+	}
+}
@@ -0,0 +1,57 @@
+package meshcontext
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/heroku/heroku-integration-service-mesh/conf"
+	"github.com/heroku/heroku-integration-service-mesh/mesh"
+	"github.com/heroku/heroku-integration-service-mesh/meshcontext/meshcontexttest"
+)
+
+func newMeshIdentity() *mesh.Identity {
+	identity := mesh.NewIdentity()
+	identity.OrgID = meshcontexttest.OrgID
+	identity.OrgDomainUrl = meshcontexttest.OrgDomainUrl
+	identity.RequestType = conf.RequestTypeSalesforce
+	return identity
+}
+
+// signEdDSA mints an EdDSA identity token with the mesh's token signer
+func signEdDSA(t *testing.T, privateKey ed25519.PrivateKey) string {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "identity-token.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := mesh.NewTokenSigner(&conf.Config{
+		YamlConfig: &conf.YamlConfig{Mesh: conf.Mesh{IdentityToken: conf.IdentityToken{
+			Enable:    true,
+			Algorithm: conf.IdentityTokenAlgorithmEdDSA,
+			KeyFile:   keyFile,
+			Header:    conf.IdentityTokenHeader,
+			Issuer:    conf.IdentityTokenIssuer,
+			TTL:       time.Minute,
+		}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signer.Sign("request-id", newMeshIdentity(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}